@@ -0,0 +1,59 @@
+package main
+
+import (
+	"fmt"
+	"path"
+	"strings"
+
+	yaml "gopkg.in/yaml.v2"
+)
+
+// answersFileName is written to the output directory with the spec that a render used, so that 'spiro render -replay'
+// can render the template again without asking anything.
+const answersFileName = ".spiro-answers.yaml"
+
+// writeAnswersFile writes the effective spec of a render (after -edit, prompts, overrides and variable defaults) into
+// dir. Sensitive values are left out so that no secret is stored next to the generated output, they have to be given
+// or asked for again when replaying.
+func writeAnswersFile(sink outputSink, dir string, spec map[string]interface{}, sensitive []string) error {
+	for _, key := range sensitive {
+		spec = withoutSpecPath(spec, key)
+	}
+	content, err := yaml.Marshal(spec)
+	if err != nil {
+		return err
+	}
+	content = append([]byte("# Generated by spiro, the spec this output was rendered with. Render it again with 'spiro render -replay'\n"), content...)
+	file := path.Join(dir, answersFileName)
+	if err := sink.WriteFile(file, content); err != nil {
+		return fmt.Errorf("Error while writing answers file '%s': %s", file, err.Error())
+	}
+	return nil
+}
+
+// withoutSpecPath returns the spec without the value at the dotted path. Only the maps along the path are copied, so
+// the spec itself is left untouched.
+func withoutSpecPath(spec map[string]interface{}, dotted string) map[string]interface{} {
+	key, rest := dotted, ""
+	if i := strings.Index(dotted, "."); i >= 0 {
+		key, rest = dotted[:i], dotted[i+1:]
+	}
+	value, ok := spec[key]
+	if !ok {
+		return spec
+	}
+	out := make(map[string]interface{}, len(spec))
+	for k, v := range spec {
+		out[k] = v
+	}
+	if rest == "" {
+		delete(out, key)
+		return out
+	}
+	child, ok := value.(map[string]interface{})
+	if !ok {
+		return spec
+	}
+	out[key] = withoutSpecPath(child, rest)
+	return out
+}
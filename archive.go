@@ -0,0 +1,312 @@
+package main
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	archiveTarGz = "tar.gz"
+	archiveZip   = "zip"
+)
+
+// archiveRoot is the output directory that the template is rendered into when the output is an archive. The rendered
+// tree is collected in memory and nothing is ever written there.
+const archiveRoot = "/spiro-archive"
+
+// archiveFormat returns the format of the archive written for an output path ending in .tar.gz, .tgz or .zip, or ""
+// when the output is a directory.
+func archiveFormat(output string) string {
+	lower := strings.ToLower(output)
+	switch {
+	case strings.HasSuffix(lower, ".tar.gz") || strings.HasSuffix(lower, ".tgz"):
+		return archiveTarGz
+	case strings.HasSuffix(lower, ".zip"):
+		return archiveZip
+	}
+	return ""
+}
+
+// checkArchiveOutput checks that an archive can be written to the output path, replacing an existing file only when
+// forced.
+func checkArchiveOutput(archive string, force bool) error {
+	if stat, err := os.Stat(filepath.Dir(archive)); err != nil || !stat.IsDir() {
+		return fmt.Errorf("Output archive directory '%s' does not exist!", filepath.Dir(archive))
+	}
+	if stat, err := os.Stat(archive); err == nil {
+		if stat.IsDir() {
+			return fmt.Errorf("Output archive '%s' is a directory!", archive)
+		} else if !force {
+			return fmt.Errorf("Output archive '%s' already exists, use -force to replace it", archive)
+		}
+	}
+	return nil
+}
+
+// archiveEntry is a directory or file in an archive, its name is relative to the archive root.
+type archiveEntry struct {
+	name    string
+	dir     bool
+	mode    os.FileMode
+	content []byte
+}
+
+// archiveEntries lists the directories and files collected in the sink under root, each directory before its content.
+func archiveEntries(root string, sink *memorySink) []archiveEntry {
+	var entries []archiveEntry
+	for dir := range sink.Dirs {
+		if rel, ok := archiveName(root, dir); ok {
+			entries = append(entries, archiveEntry{name: rel, dir: true, mode: 0755})
+		}
+	}
+	for file, f := range sink.Files {
+		if rel, ok := archiveName(root, file); ok {
+			entries = append(entries, archiveEntry{name: rel, mode: f.Mode.Perm(), content: f.Content})
+		}
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].name < entries[j].name })
+	return entries
+}
+
+func archiveName(root string, file string) (string, bool) {
+	rel, err := filepath.Rel(root, file)
+	if err != nil || rel == "." || strings.HasPrefix(rel, "..") {
+		return "", false
+	}
+	return filepath.ToSlash(rel), true
+}
+
+// writeArchive writes the tree collected in the sink under root into a tar.gz or zip archive. The archive is written
+// to a temporary file next to it first so that a failed run never leaves a partial archive behind.
+func writeArchive(archive string, format string, root string, sink *memorySink) (err error) {
+	tmp, err := ioutil.TempFile(filepath.Dir(archive), ".spiro-archive-")
+	if err != nil {
+		return fmt.Errorf("Error while creating output archive '%s': %s", archive, err.Error())
+	}
+	defer func() {
+		if err != nil {
+			os.Remove(tmp.Name())
+		}
+	}()
+
+	entries := archiveEntries(root, sink)
+	if format == archiveZip {
+		err = writeZip(tmp, entries)
+	} else {
+		err = writeTarGz(tmp, entries)
+	}
+	if cerr := tmp.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Chmod(tmp.Name(), 0644)
+	}
+	if err == nil {
+		err = os.Rename(tmp.Name(), archive)
+	}
+	if err != nil {
+		return fmt.Errorf("Error while writing output archive '%s': %s", archive, err.Error())
+	}
+	return nil
+}
+
+func writeTarGz(w io.Writer, entries []archiveEntry) error {
+	gz := gzip.NewWriter(w)
+	tw := tar.NewWriter(gz)
+	now := time.Now()
+	for _, entry := range entries {
+		header := &tar.Header{Name: entry.name, Mode: int64(entry.mode), ModTime: now, Format: tar.FormatPAX}
+		if entry.dir {
+			header.Typeflag = tar.TypeDir
+			header.Name += "/"
+		} else {
+			header.Typeflag = tar.TypeReg
+			header.Size = int64(len(entry.content))
+		}
+		if err := tw.WriteHeader(header); err != nil {
+			return err
+		}
+		if _, err := tw.Write(entry.content); err != nil {
+			return err
+		}
+	}
+	if err := tw.Close(); err != nil {
+		return err
+	}
+	return gz.Close()
+}
+
+func writeZip(w io.Writer, entries []archiveEntry) error {
+	zw := zip.NewWriter(w)
+	now := time.Now()
+	for _, entry := range entries {
+		header := &zip.FileHeader{Name: entry.name, Method: zip.Deflate, Modified: now}
+		if entry.dir {
+			header.Name += "/"
+			header.Method = zip.Store
+			header.SetMode(os.ModeDir | entry.mode)
+		} else {
+			header.SetMode(entry.mode)
+		}
+		fw, err := zw.CreateHeader(header)
+		if err != nil {
+			return err
+		}
+		if _, err := fw.Write(entry.content); err != nil {
+			return err
+		}
+	}
+	return zw.Close()
+}
+
+// isTemplateArchive reports whether the template argument is a local .tar.gz, .tgz or .zip file.
+func isTemplateArchive(arg string) bool {
+	stat, err := os.Stat(arg)
+	return err == nil && !stat.IsDir() && archiveFormat(arg) != ""
+}
+
+// extractTemplateArchive extracts a template bundle into a new temporary directory. When everything in the archive is
+// inside a single directory, that directory is the template, otherwise the template is a directory named after the
+// archive. The returned function removes the temporary directory again and must be called once the template is no
+// longer needed.
+func extractTemplateArchive(archive string) (string, func(), error) {
+	name := filepath.Base(archive)
+	for _, ext := range []string{".tar.gz", ".tgz", ".zip"} {
+		if strings.HasSuffix(strings.ToLower(name), ext) {
+			name = name[:len(name)-len(ext)]
+			break
+		}
+	}
+	if name == "" {
+		name = "template"
+	}
+
+	tmp, err := ioutil.TempDir(os.TempDir(), "spiro-template")
+	if err != nil {
+		return "", nil, fmt.Errorf("Unable to setup temporary directory for extracting '%s': %s", archive, err.Error())
+	}
+	cleanup := func() { os.RemoveAll(tmp) }
+	dir := filepath.Join(tmp, name)
+
+	logs.Infof("Extracting template '%s'", archive)
+	if err = os.Mkdir(dir, 0755); err == nil {
+		if archiveFormat(archive) == archiveZip {
+			err = extractZip(archive, dir)
+		} else {
+			err = extractTarGz(archive, dir)
+		}
+	}
+	if err != nil {
+		cleanup()
+		return "", nil, fmt.Errorf("Could not extract template '%s': %s", archive, err.Error())
+	}
+	if items, err := ioutil.ReadDir(dir); err == nil && len(items) == 1 && items[0].IsDir() {
+		dir = filepath.Join(dir, items[0].Name())
+	}
+	return dir, cleanup, nil
+}
+
+// extractPath returns where an archive entry is extracted to, refusing entries that would end up outside of dir.
+func extractPath(dir string, entry string) (string, error) {
+	clean := path.Clean(strings.Replace(entry, `\`, "/", -1))
+	if path.IsAbs(clean) || clean == ".." || strings.HasPrefix(clean, "../") {
+		return "", fmt.Errorf("the archive entry '%s' is outside of the template", entry)
+	}
+	return filepath.Join(dir, filepath.FromSlash(clean)), nil
+}
+
+// extractFile writes an archive entry with the permissions it was archived with.
+func extractFile(file string, mode os.FileMode, content io.Reader) error {
+	if err := os.MkdirAll(filepath.Dir(file), 0755); err != nil {
+		return err
+	}
+	if mode.Perm() == 0 {
+		mode = 0644
+	}
+	out, err := os.OpenFile(file, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, mode.Perm())
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, content); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
+
+func extractTarGz(archive string, dir string) error {
+	f, err := os.Open(archive)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	gz, err := gzip.NewReader(f)
+	if err != nil {
+		return err
+	}
+	tr := tar.NewReader(gz)
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		} else if err != nil {
+			return err
+		}
+		target, err := extractPath(dir, header.Name)
+		if err != nil {
+			return err
+		}
+		switch header.Typeflag {
+		case tar.TypeDir:
+			err = os.MkdirAll(target, 0755)
+		case tar.TypeReg:
+			err = extractFile(target, os.FileMode(header.Mode), tr)
+		case tar.TypeSymlink, tar.TypeLink:
+			err = fmt.Errorf("the archive entry '%s' is a link, which template archives cannot contain", header.Name)
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+func extractZip(archive string, dir string) error {
+	zr, err := zip.OpenReader(archive)
+	if err != nil {
+		return err
+	}
+	defer zr.Close()
+	for _, entry := range zr.File {
+		target, err := extractPath(dir, entry.Name)
+		if err != nil {
+			return err
+		}
+		mode := entry.Mode()
+		switch {
+		case mode.IsDir():
+			err = os.MkdirAll(target, 0755)
+		case mode&os.ModeSymlink != 0:
+			err = fmt.Errorf("the archive entry '%s' is a link, which template archives cannot contain", entry.Name)
+		default:
+			var content io.ReadCloser
+			if content, err = entry.Open(); err == nil {
+				err = extractFile(target, mode, content)
+				content.Close()
+			}
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
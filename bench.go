@@ -0,0 +1,165 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"runtime"
+	"sort"
+	"time"
+
+	"github.com/AstromechZA/spiro/templatefactory"
+)
+
+// benchSamples are the measurements of one template file, or of whole runs.
+type benchSamples struct {
+	durations []time.Duration
+	mallocs   uint64
+	bytes     uint64
+}
+
+// benchStats collects the measurements of every template file while benchmarking. A nil benchStats only runs the
+// measured functions.
+type benchStats struct {
+	files map[string]*benchSamples
+	order []string
+}
+
+func newBenchStats() *benchStats {
+	return &benchStats{files: make(map[string]*benchSamples)}
+}
+
+// measure runs fn and records its duration and allocations against the name.
+func (s *benchStats) measure(name string, fn func() error) error {
+	if s == nil {
+		return fn()
+	}
+	samples, ok := s.files[name]
+	if !ok {
+		samples = &benchSamples{}
+		s.files[name] = samples
+		s.order = append(s.order, name)
+	}
+	return samples.measure(fn)
+}
+
+func (b *benchSamples) measure(fn func() error) error {
+	var before, after runtime.MemStats
+	runtime.ReadMemStats(&before)
+	start := time.Now()
+	err := fn()
+	elapsed := time.Since(start)
+	runtime.ReadMemStats(&after)
+	b.durations = append(b.durations, elapsed)
+	b.mallocs += after.Mallocs - before.Mallocs
+	b.bytes += after.TotalAlloc - before.TotalAlloc
+	return err
+}
+
+// percentile returns the nearest rank percentile of the durations.
+func (b *benchSamples) percentile(p int) time.Duration {
+	sorted := append([]time.Duration{}, b.durations...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+	rank := (p*len(sorted) + 99) / 100
+	if rank < 1 {
+		rank = 1
+	}
+	return sorted[rank-1]
+}
+
+func (b *benchSamples) mean() time.Duration {
+	var total time.Duration
+	for _, d := range b.durations {
+		total += d
+	}
+	return total / time.Duration(len(b.durations))
+}
+
+// summary formats the mean and percentile durations and the allocations per sample.
+func (b *benchSamples) summary() string {
+	n := uint64(len(b.durations))
+	return fmt.Sprintf("%10s %10s %10s %10s %10d %12d",
+		b.mean(), b.percentile(50), b.percentile(90), b.percentile(99), b.mallocs/n, b.bytes/n)
+}
+
+// runBenchmark renders the template the given number of times, in memory or into temporary directories, and prints
+// the durations and allocations of the whole runs and of each file, slowest files first. Setup registers the template
+// functions on the template factory, whose 'output' function must use the given rendered outputs.
+func runBenchmark(inputTemplate string, specFile string, runs int, disk bool, outputs *renderedOutputs, setup func(tf *templatefactory.TemplateFactory) error) error {
+	if runs < 1 {
+		return fmt.Errorf("The -bench-runs flag must be at least 1")
+	}
+	spec := make(map[string]interface{})
+	if specFile != "" {
+		var err error
+		if spec, err = loadSpecFile(specFile); err != nil {
+			return err
+		}
+	}
+	manifest, err := loadManifest(inputTemplate)
+	if err != nil {
+		return err
+	}
+	setup = manifest.withDelimiters(setup)
+	tf := templatefactory.NewTemplateFactory()
+	if err := setup(tf); err != nil {
+		return err
+	}
+	if err := tf.SetSpec(&spec); err != nil {
+		return err
+	}
+	ignore, err := manifest.ignoreRules(tf)
+	if err != nil {
+		return err
+	}
+
+	stats := newBenchStats()
+	total := &benchSamples{}
+	for i := 0; i < runs; i++ {
+		var sink outputSink = newMemorySink()
+		outputDir := "/spiro-bench"
+		if disk {
+			if outputDir, err = ioutil.TempDir(os.TempDir(), "spiro-bench"); err != nil {
+				return fmt.Errorf("Unable to setup temporary directory for benchmarking: %s", err.Error())
+			}
+			sink = diskSink{}
+		}
+		p := &processor{
+			root: inputTemplate, tf: tf, metadata: manifest.metadata(), out: sink, ignore: ignore,
+			rewrites: manifest.Rewrite, postprocess: manifest.Postprocess, stats: stats, outputs: outputs,
+			foreach: manifest.Foreach, whitespace: manifest.Whitespace, formatters: manifest.formatters,
+		}
+		err := total.measure(func() error {
+			root, err := generatedRoot(inputTemplate, outputDir, tf)
+			if err != nil {
+				return err
+			}
+			outputs.reset(root, outputDir)
+			if err := p.process(outputDir); err != nil {
+				return err
+			}
+			return p.processDeferred()
+		})
+		if disk {
+			os.RemoveAll(outputDir)
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	mode := "in memory"
+	if disk {
+		mode = "on disk"
+	}
+	fmt.Printf("Rendered '%s' %d time(s) %s, %d file(s) per run\n\n", inputTemplate, runs, mode, len(stats.order))
+	fmt.Printf("%-40s %10s %10s %10s %10s %10s %12s\n", "", "mean", "p50", "p90", "p99", "allocs", "bytes")
+	fmt.Printf("%-40s %s\n", "(whole run)", total.summary())
+	sort.SliceStable(stats.order, func(i, j int) bool {
+		return stats.files[stats.order[i]].mean() > stats.files[stats.order[j]].mean()
+	})
+	for _, name := range stats.order {
+		fmt.Printf("%-40s %s\n", name, stats.files[name].summary())
+	}
+	return nil
+}
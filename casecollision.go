@@ -0,0 +1,58 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"golang.org/x/text/unicode/norm"
+)
+
+const (
+	caseCollisionsWarn   = "warn"
+	caseCollisionsError  = "error"
+	caseCollisionsIgnore = "ignore"
+)
+
+// caseCollisions detects rendered paths that only differ by case, eg: README.md and Readme.md, or by Unicode
+// normalization, eg: 'café' with a composed or a decomposed 'é'. They are different files on Linux but the same file
+// on the case-insensitive filesystems macOS and Windows use by default (and macOS is normalization-insensitive too),
+// where one would silently overwrite the other. A nil detector checks nothing.
+type caseCollisions struct {
+	fail bool
+	// seen maps the lower case NFC form of every rendered path to the first path rendered with it
+	seen map[string]string
+}
+
+func newCaseCollisions(policy string) (*caseCollisions, error) {
+	switch policy {
+	case caseCollisionsIgnore:
+		return nil, nil
+	case caseCollisionsWarn, caseCollisionsError:
+		return &caseCollisions{fail: policy == caseCollisionsError, seen: make(map[string]string)}, nil
+	}
+	return nil, fmt.Errorf("Invalid -case-collisions value '%s', expected one of warn, error, ignore", policy)
+}
+
+// check records a rendered path, warning about or failing on a different path that only differs by case.
+func (c *caseCollisions) check(file string, redact *redactor) error {
+	if c == nil {
+		return nil
+	}
+	key := strings.ToLower(norm.NFC.String(file))
+	first, ok := c.seen[key]
+	if !ok {
+		c.seen[key] = file
+		return nil
+	} else if first == file {
+		return nil
+	}
+	msg := fmt.Sprintf("'%s' and '%s' only differ by case and would overwrite each other on case-insensitive filesystems like macOS and Windows", redact.Redact(first), redact.Redact(file))
+	if norm.NFC.String(first) == norm.NFC.String(file) {
+		msg = fmt.Sprintf("'%s' and '%s' only differ in Unicode normalization and would overwrite each other on macOS, use -normalize-names to render a single form", redact.Redact(first), redact.Redact(file))
+	}
+	if c.fail {
+		return fmt.Errorf("The rendered paths %s", msg)
+	}
+	logs.Warnf("the rendered paths %s", msg)
+	return nil
+}
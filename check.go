@@ -0,0 +1,156 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"unicode/utf16"
+
+	"github.com/AstromechZA/spiro/templatefactory"
+)
+
+// diagnosticPosition, diagnosticRange and diagnostic follow the shapes of the Language Server Protocol, lines and
+// characters are 0 based and characters count UTF-16 code units.
+type diagnosticPosition struct {
+	Line      int `json:"line"`
+	Character int `json:"character"`
+}
+
+type diagnosticRange struct {
+	Start diagnosticPosition `json:"start"`
+	End   diagnosticPosition `json:"end"`
+}
+
+// diagnosticError is the LSP severity of every diagnostic reported by 'spiro check'.
+const diagnosticError = 1
+
+type diagnostic struct {
+	Range    diagnosticRange `json:"range"`
+	Severity int             `json:"severity"`
+	Source   string          `json:"source"`
+	Message  string          `json:"message"`
+}
+
+// fileDiagnostics is written by 'spiro check -json', like the parameters of an LSP publishDiagnostics notification.
+type fileDiagnostics struct {
+	URI         string       `json:"uri"`
+	Diagnostics []diagnostic `json:"diagnostics"`
+}
+
+// checkTemplateFile parses a template file and, when a spec is given, renders it with the spec so that references to
+// keys missing from the spec are reported too. Template errors are returned as diagnostics, other errors fail.
+func checkTemplateFile(file string, tf *templatefactory.TemplateFactory, spec map[string]interface{}) ([]diagnostic, error) {
+	content, err := ioutil.ReadFile(longPath(file))
+	if err != nil {
+		return nil, fmt.Errorf("Error while reading '%s': %s", file, err.Error())
+	}
+	err = tf.Parse(file, string(content))
+	if err == nil && spec != nil {
+		if err = tf.SetSpec(&spec); err != nil {
+			return nil, err
+		}
+		_, err = tf.RenderNamed(file, string(content))
+	}
+	if err == nil {
+		return []diagnostic{}, nil
+	}
+	lines := strings.Split(string(content), "\n")
+	var parseErr *templatefactory.TemplateParseError
+	var renderErr *templatefactory.RenderError
+	switch {
+	case errors.As(err, &parseErr):
+		// parse errors only know their line, so they cover all of it
+		return []diagnostic{newDiagnostic(lines, parseErr.Line, -1, "", stripErrorPosition(file, err))}, nil
+	case errors.As(err, &renderErr):
+		// execution errors point at the failing action, eg: 'at <.missing>:'
+		var action string
+		if m := regexp.MustCompile(`at <(.+?)>: `).FindStringSubmatch(err.Error()); m != nil {
+			action = m[1]
+		}
+		return []diagnostic{newDiagnostic(lines, renderErr.Line, renderErr.Column, action, stripErrorPosition(file, err))}, nil
+	}
+	return nil, err
+}
+
+// newDiagnostic builds a diagnostic for a 1 based line and a 0 based byte column in the template. The range covers the
+// action at the column, or the whole line when the column is not known.
+func newDiagnostic(lines []string, line int, column int, action string, message string) diagnostic {
+	d := diagnostic{Severity: diagnosticError, Source: "spiro", Message: message}
+	if line < 1 || line > len(lines) {
+		return d
+	}
+	text := lines[line-1]
+	start, end := 0, len(text)
+	if column >= 0 && column <= len(text) {
+		start, end = column, column
+		if strings.HasPrefix(text[column:], action) {
+			end = column + len(action)
+		}
+	}
+	d.Range.Start = diagnosticPosition{Line: line - 1, Character: utf16Length(text[:start])}
+	d.Range.End = diagnosticPosition{Line: line - 1, Character: utf16Length(text[:end])}
+	return d
+}
+
+func utf16Length(s string) int {
+	return len(utf16.Encode([]rune(s)))
+}
+
+// stripErrorPosition removes the 'template: name:line:column: ' prefix that the diagnostic range replaces.
+func stripErrorPosition(file string, err error) string {
+	return regexp.MustCompile(`^template: `+regexp.QuoteMeta(file)+`:\d+(:\d+)?: `).ReplaceAllString(err.Error(), "")
+}
+
+// fileURI returns the file:// URI of a local path, which is how editors identify documents.
+func fileURI(file string) string {
+	abs, err := filepath.Abs(file)
+	if err != nil {
+		abs = file
+	}
+	abs = filepath.ToSlash(abs)
+	if !strings.HasPrefix(abs, "/") {
+		// windows paths like C:/x become file:///C:/x
+		abs = "/" + abs
+	}
+	return "file://" + abs
+}
+
+// runTemplateCheck checks a single template file for 'spiro check', writing its diagnostics either as
+// 'file:line:column: message' lines or, with asJSON, as one LSP style JSON object.
+func runTemplateCheck(w io.Writer, file string, specFile string, asJSON bool, setup func(tf *templatefactory.TemplateFactory) error) error {
+	var spec map[string]interface{}
+	if specFile != "" {
+		var err error
+		if spec, err = loadSpecFile(specFile); err != nil {
+			return err
+		}
+	}
+	tf := templatefactory.NewTemplateFactory()
+	if err := setup(tf); err != nil {
+		return err
+	}
+	diagnostics, err := checkTemplateFile(file, tf, spec)
+	if err != nil {
+		return err
+	}
+	if asJSON {
+		encoder := json.NewEncoder(w)
+		encoder.SetEscapeHTML(false)
+		if err := encoder.Encode(fileDiagnostics{URI: fileURI(file), Diagnostics: diagnostics}); err != nil {
+			return err
+		}
+	} else {
+		for _, d := range diagnostics {
+			fmt.Fprintf(w, "%s:%d:%d: %s\n", file, d.Range.Start.Line+1, d.Range.Start.Character+1, d.Message)
+		}
+	}
+	if len(diagnostics) > 0 {
+		return fmt.Errorf("Found %s in '%s'", countProblems(len(diagnostics)), file)
+	}
+	return nil
+}
@@ -0,0 +1,167 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+
+	"github.com/AstromechZA/spiro/templatefactory"
+)
+
+// subcommands are the commands spiro understands as its first argument. Running spiro without one renders the
+// template, like 'spiro render'.
+var subcommands = []string{"render", "validate", "check", "diff", "init", "funcs", "docs", "vars", "test", "bench", "update"}
+
+func isSubcommand(arg string) bool {
+	for _, command := range subcommands {
+		if arg == command {
+			return true
+		}
+	}
+	return false
+}
+
+// splitSubcommand separates the subcommand from the rest of the command line arguments. The subcommand is either the
+// first argument, so that its flags can follow it ('spiro render -force ...'), or the first argument after the flags
+// ('spiro -force render ...'), which is how 'spiro test' and 'spiro bench' have always been run. Flags may follow the
+// subcommand in both cases. A local path with the name of a subcommand is a template rather than a subcommand, so
+// that a template directory named 'test' can still be rendered. parse parses the flags and returns the positional
+// arguments.
+func splitSubcommand(args []string, parse func(args []string) []string) (string, []string) {
+	if len(args) > 0 && isSubcommandArg(args[0]) {
+		return args[0], parse(args[1:])
+	}
+	positional := parse(args)
+	if len(positional) > 0 && isSubcommandArg(positional[0]) {
+		return positional[0], parse(positional[1:])
+	}
+	return "", positional
+}
+
+// isSubcommandArg reports whether a command line argument names a subcommand rather than a local template.
+func isSubcommandArg(arg string) bool {
+	if !isSubcommand(arg) {
+		return false
+	}
+	_, err := os.Lstat(arg)
+	return os.IsNotExist(err)
+}
+
+// validateRoot is the output directory that 'spiro validate' renders the template into, in memory.
+const validateRoot = "/spiro-validate"
+
+// starterSpecFileName is the sample spec written by 'spiro init', the starter manifest keeps it out of the output.
+const starterSpecFileName = "spec.example.yaml"
+
+// starterTemplate are the files written by 'spiro init', a minimal directory template showing the manifest, the spec
+// schema, a hook script, a sample spec and a templated file and directory name.
+var starterTemplate = map[string]string{
+	manifestFileName: `# the template manifest, see https://github.com/AstromechZA/spiro#the-template-manifest
+version: 0.1.0
+variables:
+  - name: name
+    description: the project name
+  - name: description
+    default: A new project
+ignore:
+  - /` + starterSpecFileName + `
+# runs the scripts in hooks/, commands can be listed under pre_gen and post_gen too
+hooks: {}
+# validates specs against ` + specSchemaFileName + `
+spec_schema: true
+tests:
+  - name: the title is the project name
+    spec: {name: widget}
+    expr: '# {{ .name }}'
+    expect: '# widget'
+`,
+	starterSpecFileName: `# render the template with: spiro <template directory> ` + starterSpecFileName + ` <output directory>
+name: my-project
+description: Generated from a spiro template
+`,
+	hooksDirName + "/post_gen.sh": `#!/bin/sh
+# runs in the generated project after rendering, see https://github.com/AstromechZA/spiro#generation-hooks
+echo "Generated $SPIRO_VAR_NAME in $SPIRO_OUTPUT"
+`,
+	specSchemaFileName: `{
+  "$schema": "http://json-schema.org/draft-07/schema#",
+  "type": "object",
+  "properties": {
+    "name": {"type": "string", "pattern": "^[a-z][a-z0-9-]*$"},
+    "description": {"type": "string"}
+  },
+  "required": ["name"]
+}
+`,
+	"{{ .name }}/README.md.templated": `# {{ .name }}
+
+{{ .description }}
+`,
+}
+
+// initTemplate writes a starter template into dir, which is created if needed and must otherwise be empty so that
+// nothing is overwritten.
+func initTemplate(dir string) error {
+	if entries, err := ioutil.ReadDir(dir); err == nil && len(entries) > 0 {
+		return fmt.Errorf("Template directory '%s' is not empty!", dir)
+	} else if err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("Template directory '%s' cannot be read! (%s)", dir, err.Error())
+	}
+	names := make([]string, 0, len(starterTemplate))
+	for name := range starterTemplate {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		file := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(file), 0755); err != nil {
+			return fmt.Errorf("Error while creating '%s': %s", filepath.Dir(file), err.Error())
+		}
+		mode := os.FileMode(0644)
+		if path.Dir(name) == hooksDirName {
+			mode = 0755
+		}
+		if err := ioutil.WriteFile(file, []byte(starterTemplate[name]), mode); err != nil {
+			return fmt.Errorf("Error while writing '%s': %s", file, err.Error())
+		}
+		logs.Infof("Created '%s'", file)
+	}
+	logs.Infof("Render it with: spiro %s %s <output directory>", dir, filepath.Join(dir, starterSpecFileName))
+	return nil
+}
+
+// printTemplateFunctions lists the template functions that templates can call, including the builtin text/template
+// functions and any function plugins, leaving out the ones removed by -enable-funcs and -disable-funcs.
+func printTemplateFunctions(w io.Writer, tf *templatefactory.TemplateFactory, enable string, disable string) error {
+	if err := restrictTemplateFunctions(tf, enable, disable); err != nil {
+		return err
+	}
+	enabled := make(map[string]bool)
+	for _, name := range splitList(enable) {
+		enabled[name] = true
+	}
+	disabled := make(map[string]bool)
+	for _, name := range splitList(disable) {
+		disabled[name] = true
+	}
+	var names []string
+	for _, name := range tf.TemplateFunctionNames() {
+		if (len(enabled) == 0 || enabled[name]) && !disabled[name] {
+			names = append(names, name)
+		}
+	}
+	for _, name := range templatefactory.BuiltinFunctions {
+		if !disabled[name] {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		fmt.Fprintln(w, name)
+	}
+	return nil
+}
@@ -0,0 +1,307 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// cronField describes one of the five fields of a cron expression.
+type cronField struct {
+	name  string
+	min   int
+	max   int
+	names []string
+}
+
+var cronFields = []cronField{
+	{name: "minute", min: 0, max: 59},
+	{name: "hour", min: 0, max: 23},
+	{name: "day of month", min: 1, max: 31},
+	{name: "month", min: 1, max: 12, names: []string{"", "jan", "feb", "mar", "apr", "may", "jun", "jul", "aug", "sep", "oct", "nov", "dec"}},
+	{name: "day of week", min: 0, max: 7, names: []string{"sun", "mon", "tue", "wed", "thu", "fri", "sat"}},
+}
+
+var cronMacros = map[string]string{
+	"@yearly":   "0 0 1 1 *",
+	"@annually": "0 0 1 1 *",
+	"@monthly":  "0 0 1 * *",
+	"@weekly":   "0 0 * * 0",
+	"@daily":    "0 0 * * *",
+	"@midnight": "0 0 * * *",
+	"@hourly":   "0 * * * *",
+}
+
+var systemdShorthands = map[string]string{
+	"minutely":     "*-*-* *:*:00",
+	"hourly":       "*-*-* *:00:00",
+	"daily":        "*-*-* 00:00:00",
+	"weekly":       "Mon *-*-* 00:00:00",
+	"monthly":      "*-*-01 00:00:00",
+	"yearly":       "*-01-01 00:00:00",
+	"annually":     "*-01-01 00:00:00",
+	"quarterly":    "*-01,04,07,10-01 00:00:00",
+	"semiannually": "*-01,07-01 00:00:00",
+}
+
+var systemdWeekdays = []string{"Sun", "Mon", "Tue", "Wed", "Thu", "Fri", "Sat"}
+
+// value parses a number or (for months and weekdays) a name in the field, which may be abbreviated to three letters.
+func (f cronField) value(s string) (int, error) {
+	for i, name := range f.names {
+		if name != "" && len(s) >= 3 && strings.HasPrefix(strings.ToLower(s), name) {
+			return i, nil
+		}
+	}
+	n, err := strconv.Atoi(s)
+	if err != nil || n < f.min || n > f.max {
+		return 0, fmt.Errorf("invalid %s '%s'", f.name, s)
+	}
+	return n, nil
+}
+
+// parse returns the set of values matched by a field, written with cron ("a-b", "*/n") or systemd ("a..b", "a/n")
+// syntax. Sunday is always 0 in the result.
+func (f cronField) parse(field string, rangeSep string) (map[int]bool, error) {
+	values := make(map[int]bool)
+	for _, item := range strings.Split(field, ",") {
+		step := 1
+		if parts := strings.SplitN(item, "/", 2); len(parts) == 2 {
+			n, err := strconv.Atoi(parts[1])
+			if err != nil || n < 1 {
+				return nil, fmt.Errorf("invalid step in %s '%s'", f.name, item)
+			}
+			item, step = parts[0], n
+			if !strings.Contains(item, rangeSep) && item != "*" {
+				// systemd style 'a/n' (and the common cron extension) repeats until the end of the range
+				item = item + rangeSep + strconv.Itoa(f.max)
+			}
+		}
+		start, end := f.min, f.max
+		if item != "*" {
+			bounds := strings.SplitN(item, rangeSep, 2)
+			var err error
+			if start, err = f.value(bounds[0]); err != nil {
+				return nil, err
+			}
+			end = start
+			if len(bounds) == 2 {
+				if end, err = f.value(bounds[1]); err != nil {
+					return nil, err
+				}
+			}
+			if end < start {
+				return nil, fmt.Errorf("invalid %s range '%s'", f.name, item)
+			}
+		}
+		for v := start; v <= end; v += step {
+			if f.name == "day of week" {
+				values[v%7] = true
+			} else {
+				values[v] = true
+			}
+		}
+	}
+	return values, nil
+}
+
+// format writes a set of values as compactly as possible, as a cron or systemd field.
+func (f cronField) format(values map[int]bool, systemd bool) string {
+	max := f.max
+	if f.name == "day of week" {
+		max = 6
+	}
+	var sorted []int
+	for v := range values {
+		if systemd && f.name == "day of week" && v == 0 {
+			// systemd weeks start on Monday, so sort Sunday last to allow ranges like Fri..Sun
+			v = 7
+		}
+		sorted = append(sorted, v)
+	}
+	sort.Ints(sorted)
+	if len(sorted) == max-f.min+1 {
+		return "*"
+	}
+	number := func(v int) string {
+		switch {
+		case systemd && f.name == "day of week":
+			return systemdWeekdays[v%7]
+		case systemd:
+			return fmt.Sprintf("%02d", v)
+		}
+		return strconv.Itoa(v)
+	}
+	rangeSep := "-"
+	if systemd {
+		rangeSep = ".."
+	}
+
+	// a progression that runs to the end of the field, eg: */15
+	if len(sorted) >= 3 && f.name != "day of week" {
+		step := sorted[1] - sorted[0]
+		progression := step > 1 && sorted[len(sorted)-1]+step > max
+		for i := 2; i < len(sorted) && progression; i++ {
+			progression = sorted[i]-sorted[i-1] == step
+		}
+		if progression {
+			switch {
+			case systemd:
+				return fmt.Sprintf("%s/%d", number(sorted[0]), step)
+			case sorted[0] == f.min:
+				return fmt.Sprintf("*/%d", step)
+			}
+			return fmt.Sprintf("%d-%d/%d", sorted[0], max, step)
+		}
+	}
+
+	var items []string
+	for i := 0; i < len(sorted); {
+		j := i
+		for j+1 < len(sorted) && sorted[j+1] == sorted[j]+1 {
+			j++
+		}
+		switch {
+		case j-i >= 2:
+			items = append(items, number(sorted[i])+rangeSep+number(sorted[j]))
+		case j == i+1:
+			items = append(items, number(sorted[i]), number(sorted[j]))
+		default:
+			items = append(items, number(sorted[i]))
+		}
+		i = j + 1
+	}
+	return strings.Join(items, ",")
+}
+
+// parseCron parses a five field cron expression (or a macro such as @daily) into the values of each field.
+func parseCron(expr string) ([]map[int]bool, error) {
+	expr = strings.TrimSpace(expr)
+	if macro, ok := cronMacros[strings.ToLower(expr)]; ok {
+		expr = macro
+	}
+	fields := strings.Fields(expr)
+	if len(fields) != 5 {
+		return nil, fmt.Errorf("cron expression '%s' must have 5 fields (minute hour day-of-month month day-of-week)", expr)
+	}
+	out := make([]map[int]bool, 5)
+	for i, field := range fields {
+		values, err := cronFields[i].parse(field, "-")
+		if err != nil {
+			return nil, fmt.Errorf("invalid cron expression '%s': %s", expr, err.Error())
+		}
+		out[i] = values
+	}
+	return out, nil
+}
+
+func formatCron(values []map[int]bool) string {
+	fields := make([]string, 5)
+	for i, v := range values {
+		fields[i] = cronFields[i].format(v, false)
+	}
+	return strings.Join(fields, " ")
+}
+
+// CronValid reports whether a string is a valid five field cron expression or macro.
+func CronValid(expr string) bool {
+	if strings.TrimSpace(strings.ToLower(expr)) == "@reboot" {
+		return true
+	}
+	_, err := parseCron(expr)
+	return err == nil
+}
+
+// CronNormalize validates a cron expression and rewrites it in a canonical form: macros are expanded, month and
+// weekday names become numbers and lists are written as compactly as possible, eg: "0 9 * * MON,TUE,WED,THU,FRI" ->
+// "0 9 * * 1-5".
+func CronNormalize(expr string) (string, error) {
+	if strings.TrimSpace(strings.ToLower(expr)) == "@reboot" {
+		return "@reboot", nil
+	}
+	values, err := parseCron(expr)
+	if err != nil {
+		return "", err
+	}
+	return formatCron(values), nil
+}
+
+// CronToSystemd converts a cron expression into a systemd OnCalendar expression, eg: "*/15 9-17 * * 1-5" ->
+// "Mon..Fri *-*-* 09..17:00/15:00".
+func CronToSystemd(expr string) (string, error) {
+	values, err := parseCron(expr)
+	if err != nil {
+		return "", err
+	}
+	formatted := make([]string, 5)
+	for i, v := range values {
+		formatted[i] = cronFields[i].format(v, true)
+	}
+	if formatted[2] != "*" && formatted[4] != "*" {
+		return "", fmt.Errorf("cron expression '%s' restricts both the day of month and day of week, which cron matches as either one but systemd as both", expr)
+	}
+	calendar := fmt.Sprintf("*-%s-%s %s:%s:00", formatted[3], formatted[2], formatted[1], formatted[0])
+	if formatted[4] != "*" {
+		calendar = formatted[4] + " " + calendar
+	}
+	return calendar, nil
+}
+
+// SystemdToCron converts a systemd OnCalendar expression into a cron expression, eg: "Mon..Fri *-*-* 09:30" ->
+// "30 9 * * 1-5". Expressions that cron cannot represent (specific years, seconds, time zones) are an error.
+func SystemdToCron(calendar string) (string, error) {
+	spec := strings.TrimSpace(calendar)
+	if shorthand, ok := systemdShorthands[strings.ToLower(spec)]; ok {
+		spec = shorthand
+	}
+	fail := func(reason string) (string, error) {
+		return "", fmt.Errorf("cannot convert OnCalendar expression '%s' to cron: %s", calendar, reason)
+	}
+	weekdays, date, clock := "*", "*-*-*", "00:00:00"
+	for i, token := range strings.Fields(spec) {
+		switch {
+		case strings.Contains(token, ":"):
+			clock = token
+		case strings.Contains(token, "-") && !strings.ContainsAny(token, "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ"):
+			date = token
+		case i == 0:
+			weekdays = token
+		default:
+			return fail(fmt.Sprintf("unsupported component '%s'", token))
+		}
+	}
+
+	dateParts := strings.Split(date, "-")
+	if len(dateParts) == 2 {
+		dateParts = append([]string{"*"}, dateParts...)
+	}
+	if len(dateParts) != 3 {
+		return fail(fmt.Sprintf("invalid date '%s'", date))
+	}
+	if dateParts[0] != "*" {
+		return fail("cron cannot restrict the year")
+	}
+	clockParts := strings.Split(clock, ":")
+	if len(clockParts) == 2 {
+		clockParts = append(clockParts, "00")
+	}
+	if len(clockParts) != 3 {
+		return fail(fmt.Sprintf("invalid time '%s'", clock))
+	}
+	if seconds, err := strconv.Atoi(clockParts[2]); err != nil || seconds != 0 {
+		return fail("cron cannot run at seconds other than 0")
+	}
+
+	// systemd writes weekday names with '..' ranges and the cron field parser understands names
+	sources := []string{clockParts[1], clockParts[0], dateParts[2], dateParts[1], weekdays}
+	values := make([]map[int]bool, 5)
+	for i, source := range sources {
+		v, err := cronFields[i].parse(source, "..")
+		if err != nil {
+			return fail(err.Error())
+		}
+		values[i] = v
+	}
+	return formatCron(values), nil
+}
@@ -0,0 +1,240 @@
+package main
+
+import (
+	"bytes"
+	"crypto/md5"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/sha512"
+	"encoding/base64"
+	"fmt"
+	"strings"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// cryptAlphabet is the base64 alphabet used by crypt(3) style password hashes.
+const cryptAlphabet = "./0123456789ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz"
+
+// cryptSalt returns the salt given to a hash function, or a random one of the given length.
+func cryptSalt(salt []string, length int) (string, error) {
+	if len(salt) > 0 {
+		if len(salt[0]) > length {
+			return "", fmt.Errorf("the salt can be at most %d characters long", length)
+		}
+		// anything else, like '$' or ':', would break the hash or the line it is written into
+		if i := strings.IndexFunc(salt[0], func(r rune) bool { return !strings.ContainsRune(cryptAlphabet, r) }); i >= 0 {
+			return "", fmt.Errorf("the salt can only contain the characters '%s', not '%c'", cryptAlphabet, []rune(salt[0][i:])[0])
+		}
+		return salt[0], nil
+	}
+	random := make([]byte, length)
+	if _, err := rand.Read(random); err != nil {
+		return "", err
+	}
+	for i, b := range random {
+		random[i] = cryptAlphabet[int(b)%len(cryptAlphabet)]
+	}
+	return string(random), nil
+}
+
+// cryptEncode appends the n characters that encode the 24 bit value made of three bytes, least significant first.
+func cryptEncode(buf *bytes.Buffer, b2, b1, b0 byte, n int) {
+	w := uint(b2)<<16 | uint(b1)<<8 | uint(b0)
+	for ; n > 0; n-- {
+		buf.WriteByte(cryptAlphabet[w&0x3f])
+		w >>= 6
+	}
+}
+
+// repeatedDigestBytes repeats digest until it is length bytes long.
+func repeatedDigestBytes(digest []byte, length int) []byte {
+	out := make([]byte, 0, length)
+	for len(out) < length {
+		n := length - len(out)
+		if n > len(digest) {
+			n = len(digest)
+		}
+		out = append(out, digest[:n]...)
+	}
+	return out
+}
+
+// SHA512Crypt hashes a password with the SHA-512 based crypt(3) scheme ("$6$") used for system accounts in
+// /etc/shadow. The salt (at most 16 characters) is random unless given.
+func SHA512Crypt(password string, salt ...string) (string, error) {
+	s, err := cryptSalt(salt, 16)
+	if err != nil {
+		return "", err
+	}
+	pw, sb := []byte(password), []byte(s)
+
+	alternate := sha512.Sum512(append(append(append([]byte{}, pw...), sb...), pw...))
+	a := sha512.New()
+	a.Write(pw)
+	a.Write(sb)
+	a.Write(repeatedDigestBytes(alternate[:], len(pw)))
+	for i := len(pw); i > 0; i >>= 1 {
+		if i&1 != 0 {
+			a.Write(alternate[:])
+		} else {
+			a.Write(pw)
+		}
+	}
+	result := a.Sum(nil)
+
+	dp := sha512.New()
+	for range pw {
+		dp.Write(pw)
+	}
+	p := repeatedDigestBytes(dp.Sum(nil), len(pw))
+	ds := sha512.New()
+	for i := 0; i < 16+int(result[0]); i++ {
+		ds.Write(sb)
+	}
+	saltBytes := repeatedDigestBytes(ds.Sum(nil), len(sb))
+
+	for i := 0; i < 5000; i++ {
+		c := sha512.New()
+		if i&1 != 0 {
+			c.Write(p)
+		} else {
+			c.Write(result)
+		}
+		if i%3 != 0 {
+			c.Write(saltBytes)
+		}
+		if i%7 != 0 {
+			c.Write(p)
+		}
+		if i&1 != 0 {
+			c.Write(result)
+		} else {
+			c.Write(p)
+		}
+		result = c.Sum(nil)
+	}
+
+	var buf bytes.Buffer
+	buf.WriteString("$6$" + s + "$")
+	for i := 0; i < 21; i++ {
+		// the bytes are encoded in a fixed interleaved order: (0, 21, 42), (22, 43, 1), (44, 2, 23), ...
+		x, y, z := i, (i+21)%63, (i+42)%63
+		switch i % 3 {
+		case 1:
+			x, y, z = (i+21)%63, (i+42)%63, i
+		case 2:
+			x, y, z = (i+42)%63, i, (i+21)%63
+		}
+		cryptEncode(&buf, result[x], result[y], result[z], 4)
+	}
+	cryptEncode(&buf, 0, 0, result[63], 2)
+	return buf.String(), nil
+}
+
+// APR1 hashes a password with Apache's MD5 based scheme ("$apr1$"), which every htpasswd implementation understands.
+// The salt (at most 8 characters) is random unless given.
+func APR1(password string, salt ...string) (string, error) {
+	s, err := cryptSalt(salt, 8)
+	if err != nil {
+		return "", err
+	}
+	const magic = "$apr1$"
+	pw, sb := []byte(password), []byte(s)
+
+	alternate := md5.Sum(append(append(append([]byte{}, pw...), sb...), pw...))
+	a := md5.New()
+	a.Write(pw)
+	a.Write([]byte(magic))
+	a.Write(sb)
+	a.Write(repeatedDigestBytes(alternate[:], len(pw)))
+	for i := len(pw); i > 0; i >>= 1 {
+		if i&1 != 0 {
+			a.Write([]byte{0})
+		} else {
+			a.Write(pw[:1])
+		}
+	}
+	result := a.Sum(nil)
+
+	for i := 0; i < 1000; i++ {
+		c := md5.New()
+		if i&1 != 0 {
+			c.Write(pw)
+		} else {
+			c.Write(result)
+		}
+		if i%3 != 0 {
+			c.Write(sb)
+		}
+		if i%7 != 0 {
+			c.Write(pw)
+		}
+		if i&1 != 0 {
+			c.Write(result)
+		} else {
+			c.Write(pw)
+		}
+		result = c.Sum(nil)
+	}
+
+	var buf bytes.Buffer
+	buf.WriteString(magic + s + "$")
+	for i := 0; i < 5; i++ {
+		k := i + 12
+		if i == 4 {
+			k = 5
+		}
+		cryptEncode(&buf, result[i], result[i+6], result[k], 4)
+	}
+	cryptEncode(&buf, 0, 0, result[11], 2)
+	return buf.String(), nil
+}
+
+// Bcrypt hashes a password of at most 72 bytes with bcrypt at the given cost (default 10) and a random salt. The hash
+// uses the "$2y$" prefix written by htpasswd, which names the same algorithm as golang.org/x/crypto's "$2a$".
+func Bcrypt(password string, cost ...int) (string, error) {
+	c := 10
+	if len(cost) > 0 {
+		c = cost[0]
+	}
+	if c < 4 || c > 17 {
+		return "", fmt.Errorf("the bcrypt cost must be between 4 and 17")
+	}
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), c)
+	if err != nil {
+		return "", err
+	}
+	return "$2y$" + strings.TrimPrefix(string(hash), "$2a$"), nil
+}
+
+// Htpasswd returns an htpasswd line for the user, hashing the password with the given algorithm: "bcrypt" (the
+// default), "apr1", "sha512" (for servers that use the system crypt, like nginx) or "sha1".
+func Htpasswd(user string, password string, algorithm ...string) (string, error) {
+	if strings.Contains(user, ":") {
+		return "", fmt.Errorf("the user name '%s' cannot contain ':'", user)
+	}
+	alg := "bcrypt"
+	if len(algorithm) > 0 {
+		alg = algorithm[0]
+	}
+	var hash string
+	var err error
+	switch alg {
+	case "bcrypt":
+		hash, err = Bcrypt(password)
+	case "apr1":
+		hash, err = APR1(password)
+	case "sha512":
+		hash, err = SHA512Crypt(password)
+	case "sha1":
+		sum := sha1.Sum([]byte(password))
+		hash = "{SHA}" + base64.StdEncoding.EncodeToString(sum[:])
+	default:
+		err = fmt.Errorf("unknown algorithm '%s' (supported: bcrypt, apr1, sha512, sha1)", alg)
+	}
+	if err != nil {
+		return "", err
+	}
+	return user + ":" + hash, nil
+}
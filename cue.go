@@ -0,0 +1,39 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// cueStdinPosition matches the positions in 'cue' errors for a file read from stdin, eg: '    ./-:3:8'.
+var cueStdinPosition = regexp.MustCompile(`(?m)(^|\s)(\./)?-:(\d+)`)
+
+// exportCUE evaluates a CUE spec by running 'cue export', which must be installed, and returns the result as YAML.
+// CUE checks every type and constraint while exporting, so a spec that breaks its own constraints or leaves a value
+// incomplete fails here before anything is rendered. The content is given on stdin since it may have been decrypted,
+// from the directory of the spec file so that imports from its CUE module resolve.
+func exportCUE(content []byte, specFile string) ([]byte, error) {
+	var stdout, stderr bytes.Buffer
+	cmd := exec.Command("cue", "export", "--out", "yaml", "-")
+	if specFile != "-" {
+		cmd.Dir = filepath.Dir(specFile)
+	}
+	cmd.Stdin = bytes.NewReader(content)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		if _, ok := err.(*exec.Error); ok {
+			return nil, fmt.Errorf("Spec file '%s' is CUE but the 'cue' command needed to evaluate it is not available: %s", specFile, err.Error())
+		}
+		msg := strings.TrimSpace(cueStdinPosition.ReplaceAllString(stderr.String(), "${1}"+strings.Replace(specFile, "$", "$$", -1)+":${3}"))
+		if msg == "" {
+			msg = err.Error()
+		}
+		return nil, fmt.Errorf("The spec in '%s' does not satisfy its CUE constraints:\n%s", specFile, msg)
+	}
+	return stdout.Bytes(), nil
+}
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+// debugFunctions implements the template debugging helpers. When trace is set their output is written to the trace
+// writer (stderr) instead of being inserted into the rendered file.
+type debugFunctions struct {
+	trace io.Writer
+}
+
+// emit returns the text to insert into the render, or writes it to the trace writer and inserts nothing.
+func (d debugFunctions) emit(name string, text string) string {
+	if d.trace == nil {
+		return text
+	}
+	fmt.Fprintf(d.trace, "%s: %s\n", name, strings.Replace(text, "\n", "\n    ", -1))
+	return ""
+}
+
+// TypeOf returns the Go type of a value, such as 'string', 'int' or 'map[string]interface {}', like Sprig's typeOf.
+func (d debugFunctions) TypeOf(in interface{}) string {
+	return d.emit("typeOf", fmt.Sprintf("%T", in))
+}
+
+// DebugDump pretty-prints a value (usually the current context '.') as an indented tree showing the type of every
+// nested value, with map keys in sorted order.
+func (d debugFunctions) DebugDump(in interface{}) string {
+	var b bytes.Buffer
+	dumpValue(&b, reflect.ValueOf(in), "")
+	return d.emit("debugDump", strings.TrimSuffix(b.String(), "\n"))
+}
+
+// dumpValue writes the value to the buffer, finishing with a newline. Nested values are written on the following
+// lines with more indentation.
+func dumpValue(b *bytes.Buffer, v reflect.Value, indent string) {
+	for v.IsValid() && (v.Kind() == reflect.Interface || v.Kind() == reflect.Ptr) {
+		if v.IsNil() {
+			break
+		}
+		v = v.Elem()
+	}
+	if !v.IsValid() || v.Kind() == reflect.Interface || v.Kind() == reflect.Ptr {
+		b.WriteString("nil\n")
+		return
+	}
+	// values like times are more useful in their usual string form than as their internal fields
+	if v.Kind() == reflect.Struct && v.CanInterface() {
+		if stringer, ok := v.Interface().(fmt.Stringer); ok {
+			fmt.Fprintf(b, "%s %s\n", v.Type(), stringer.String())
+			return
+		}
+	}
+	switch v.Kind() {
+	case reflect.Map:
+		fmt.Fprintf(b, "%s (%d keys)\n", v.Type(), v.Len())
+		keys := v.MapKeys()
+		sort.Slice(keys, func(i, j int) bool { return fmt.Sprint(keys[i]) < fmt.Sprint(keys[j]) })
+		for _, key := range keys {
+			fmt.Fprintf(b, "%s  %v: ", indent, key)
+			dumpValue(b, v.MapIndex(key), indent+"  ")
+		}
+	case reflect.Slice, reflect.Array:
+		if v.Kind() == reflect.Slice && v.Type().Elem().Kind() == reflect.Uint8 {
+			fmt.Fprintf(b, "%s %q\n", v.Type(), v.Bytes())
+			return
+		}
+		fmt.Fprintf(b, "%s (%d items)\n", v.Type(), v.Len())
+		for i := 0; i < v.Len(); i++ {
+			fmt.Fprintf(b, "%s  - ", indent)
+			dumpValue(b, v.Index(i), indent+"  ")
+		}
+	case reflect.Struct:
+		fmt.Fprintf(b, "%s\n", v.Type())
+		for i := 0; i < v.NumField(); i++ {
+			field := v.Type().Field(i)
+			if field.PkgPath != "" {
+				continue
+			}
+			fmt.Fprintf(b, "%s  %s: ", indent, field.Name)
+			dumpValue(b, v.Field(i), indent+"  ")
+		}
+	case reflect.String:
+		fmt.Fprintf(b, "%s %q\n", v.Type(), v.String())
+	case reflect.Func:
+		fmt.Fprintf(b, "%s\n", v.Type())
+	default:
+		fmt.Fprintf(b, "%s %v\n", v.Type(), v.Interface())
+	}
+}
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"strings"
+
+	yaml "gopkg.in/yaml.v2"
+)
+
+const (
+	ageBinaryHeader = "age-encryption.org/v1\n"
+	ageArmorHeader  = "-----BEGIN AGE ENCRYPTED FILE-----"
+)
+
+// ageIdentityFile is the age identity (private key) file used to decrypt age encrypted spec files, set by the
+// -age-identity flag or $SPIRO_AGE_IDENTITY.
+var ageIdentityFile = os.Getenv("SPIRO_AGE_IDENTITY")
+
+// isAgeEncrypted reports whether the content is an age encrypted file, in either the binary or the armored format.
+func isAgeEncrypted(content []byte) bool {
+	return bytes.HasPrefix(content, []byte(ageBinaryHeader)) ||
+		bytes.HasPrefix(bytes.TrimSpace(content), []byte(ageArmorHeader))
+}
+
+// isSOPSEncrypted reports whether the content is a YAML or JSON document encrypted by SOPS, which records its metadata
+// under a top level 'sops' key.
+func isSOPSEncrypted(content []byte) bool {
+	var doc struct {
+		SOPS map[string]interface{} `yaml:"sops"`
+	}
+	if err := yaml.Unmarshal(content, &doc); err != nil {
+		return false
+	}
+	_, hasMAC := doc.SOPS["mac"]
+	_, hasVersion := doc.SOPS["version"]
+	return hasMAC || hasVersion
+}
+
+// decryptSpec transparently decrypts SOPS or age encrypted spec content by running the 'sops' or 'age' command, which
+// must be installed. SOPS finds its keys the usual way (eg: $SOPS_AGE_KEY_FILE or a cloud KMS), age uses the
+// identity file given by ageIdentityFile. Content that is not encrypted is returned unchanged.
+func decryptSpec(content []byte) ([]byte, error) {
+	switch {
+	case isAgeEncrypted(content):
+		if ageIdentityFile == "" {
+			return nil, fmt.Errorf("Spec file is age encrypted, give an identity file to decrypt it with -age-identity or $SPIRO_AGE_IDENTITY")
+		}
+		return runDecrypt(content, "age", "--decrypt", "--identity", ageIdentityFile)
+	case isSOPSEncrypted(content):
+		inputType := "yaml"
+		if bytes.HasPrefix(bytes.TrimSpace(content), []byte("{")) {
+			inputType = "json"
+		}
+		// sops picks the format from the file extension, which a temporary file or stdin doesn't have
+		tf, err := ioutil.TempFile(os.TempDir(), "spiro-sops")
+		if err != nil {
+			return nil, fmt.Errorf("Unable to setup temporary file for decryption: %s", err)
+		}
+		defer os.Remove(tf.Name())
+		_, err = tf.Write(content)
+		if cerr := tf.Close(); err == nil {
+			err = cerr
+		}
+		if err != nil {
+			return nil, fmt.Errorf("Failed to write bytes to temporary file: %s", err)
+		}
+		return runDecrypt(nil, "sops", "--decrypt", "--input-type", inputType, "--output-type", "yaml", tf.Name())
+	}
+	return content, nil
+}
+
+// runDecrypt runs a decryption command with the given stdin and returns its stdout.
+func runDecrypt(stdin []byte, name string, args ...string) ([]byte, error) {
+	var stdout, stderr bytes.Buffer
+	cmd := exec.Command(name, args...)
+	cmd.Stdin = bytes.NewReader(stdin)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		if _, ok := err.(*exec.Error); ok {
+			return nil, fmt.Errorf("Spec file is encrypted but the '%s' command needed to decrypt it is not available: %s", name, err.Error())
+		}
+		msg := strings.TrimSpace(stderr.String())
+		if msg == "" {
+			msg = err.Error()
+		}
+		return nil, fmt.Errorf("Could not decrypt spec file with %s: %s", name, msg)
+	}
+	return stdout.Bytes(), nil
+}
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// templateDeprecation marks a whole template as deprecated.
+type templateDeprecation struct {
+	Message string `yaml:"message"`
+	// Replacement optionally points users at the template they should use instead.
+	Replacement string `yaml:"replacement"`
+}
+
+// lookupSpecPath returns the value at the dotted path (eg: 'database.host') of the spec and whether it is set.
+func lookupSpecPath(spec map[string]interface{}, dotted string) (interface{}, bool) {
+	var current interface{} = spec
+	for _, key := range strings.Split(dotted, ".") {
+		m, ok := current.(map[string]interface{})
+		if !ok {
+			return nil, false
+		}
+		if current, ok = m[key]; !ok {
+			return nil, false
+		}
+	}
+	return current, true
+}
+
+// deprecationWarnings returns the warnings for a deprecated template and for any deprecated variables set in the
+// specs being rendered.
+func (m *templateManifest) deprecationWarnings(runs []matrixRun) []string {
+	var warnings []string
+	if m.Deprecated != nil {
+		warning := "This template is deprecated"
+		if m.Deprecated.Message != "" {
+			warning += ": " + m.Deprecated.Message
+		}
+		if m.Deprecated.Replacement != "" {
+			warning += fmt.Sprintf(" (use '%s' instead)", m.Deprecated.Replacement)
+		}
+		warnings = append(warnings, warning)
+	}
+
+	variables := make([]string, 0, len(m.DeprecatedVariables))
+	for variable := range m.DeprecatedVariables {
+		variables = append(variables, variable)
+	}
+	sort.Strings(variables)
+	for _, variable := range variables {
+		for _, run := range runs {
+			if _, ok := lookupSpecPath(run.Spec, variable); ok {
+				warning := fmt.Sprintf("The spec variable '%s' is deprecated", variable)
+				if message := m.DeprecatedVariables[variable]; message != "" {
+					warning += ": " + message
+				}
+				warnings = append(warnings, warning)
+				break
+			}
+		}
+	}
+	return warnings
+}
@@ -0,0 +1,133 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// outputDestinations lists the directories that the rendered output is copied to in addition to the output directory
+// argument: the -also-output flags followed by the manifest's destinations in name order. Environment variables in
+// manifest destinations are expanded so that templates can refer to mounted volumes like $DEPLOY_DIR.
+func outputDestinations(flags []string, destinations map[string]string) ([]string, error) {
+	dirs := append([]string{}, flags...)
+	names := make([]string, 0, len(destinations))
+	for name := range destinations {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		dir := os.ExpandEnv(destinations[name])
+		if dir == "" {
+			return nil, fmt.Errorf("Output destination '%s' in the template manifest is empty", name)
+		}
+		dirs = append(dirs, dir)
+	}
+	for _, dir := range dirs {
+		if stat, err := os.Stat(dir); err != nil {
+			if os.IsNotExist(err) {
+				return nil, fmt.Errorf("Output directory '%s' does not exist!", dir)
+			}
+			return nil, fmt.Errorf("Output directory '%s' cannot be read! (%s)", dir, err.Error())
+		} else if !stat.IsDir() {
+			return nil, fmt.Errorf("Output directory '%s' cannot be a file!", dir)
+		}
+	}
+	return dirs, nil
+}
+
+// fanoutSink passes everything written under the output directory through to another sink, and repeats it for the
+// same path under each of the other destinations, so that a single render is written to several places. Conflicts
+// with existing files in the other destinations are resolved with the same overwrite policy as the output directory,
+// and existing files there matching a -protect pattern are kept.
+type fanoutSink struct {
+	outputSink
+	root         string
+	destinations []string
+	overwrite    *overwritePolicy
+	protect      *ignoreRules
+	// rel returns the path of an output file relative to the root of the generated output, it is set for each run
+	rel func(file string) string
+	// kept records the existing files in the other destinations that were left as they were
+	kept map[string]bool
+}
+
+func newFanoutSink(inner outputSink, root string, destinations []string, overwrite *overwritePolicy, protect *ignoreRules) *fanoutSink {
+	return &fanoutSink{
+		outputSink: inner, root: filepath.Clean(root), destinations: destinations, overwrite: overwrite, protect: protect,
+		rel: filepath.Base, kept: make(map[string]bool),
+	}
+}
+
+// mirrors returns the path under each destination of a path under the output directory.
+func (s *fanoutSink) mirrors(file string) []string {
+	rel, err := filepath.Rel(s.root, file)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, "../") {
+		return nil
+	}
+	out := make([]string, len(s.destinations))
+	for i, dir := range s.destinations {
+		out[i] = filepath.Join(dir, rel)
+	}
+	return out
+}
+
+// keep reports whether the existing mirror of an output file is left as it is.
+func (s *fanoutSink) keep(file string, mirror string, content []byte) (bool, error) {
+	if isProtected(s.protect, s.rel(file), mirror) {
+		logs.Infof("Keeping protected file '%s'", mirror)
+		s.kept[mirror] = true
+		return true, nil
+	}
+	write, err := s.overwrite.allowWrite(mirror, content)
+	if err == nil && !write {
+		s.kept[mirror] = true
+	}
+	return !write, err
+}
+
+func (s *fanoutSink) MakeDir(dir string) error {
+	if err := s.outputSink.MakeDir(dir); err != nil {
+		return err
+	}
+	for _, mirror := range s.mirrors(dir) {
+		if err := s.outputSink.MakeDir(mirror); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *fanoutSink) WriteFile(file string, content []byte) error {
+	if err := s.outputSink.WriteFile(file, content); err != nil {
+		return err
+	}
+	for _, mirror := range s.mirrors(file) {
+		if keep, err := s.keep(file, mirror, content); err != nil {
+			return err
+		} else if keep {
+			continue
+		}
+		if err := s.outputSink.WriteFile(mirror, content); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *fanoutSink) Chmod(file string, mode os.FileMode) error {
+	if err := s.outputSink.Chmod(file, mode); err != nil {
+		return err
+	}
+	for _, mirror := range s.mirrors(file) {
+		if s.kept[mirror] {
+			continue
+		}
+		if err := s.outputSink.Chmod(mirror, mode); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,213 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+const diffContextLines = 3
+
+// errNoMiddleSnake is returned if the two searches of middleSnake never meet. That would mean a bug in the search
+// rather than anything about the inputs, so it is reported instead of producing a wrong diff.
+var errNoMiddleSnake = errors.New("diff: the forward and backward searches did not meet")
+
+// diffOp is a single line of an edit script: ' ' for an unchanged line, '-' for a removed line and '+' for an added
+// line. Lines retain their trailing newline (if any).
+type diffOp struct {
+	Kind byte
+	Line string
+}
+
+// splitLines splits content into lines, each of which keeps its trailing newline. The final line will have no
+// newline if the content did not end with one.
+func splitLines(content string) []string {
+	if content == "" {
+		return nil
+	}
+	lines := strings.SplitAfter(content, "\n")
+	if lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+	return lines
+}
+
+// diffLines builds the shortest edit script turning a into b using the linear space variant of the Myers O(ND)
+// algorithm: rather than keeping the furthest reaching paths of every step to walk back through, which takes
+// O(D·(N+M)) memory, it finds the middle of an optimal path and diffs the two halves on either side of it.
+func diffLines(a, b []string) ([]diffOp, error) {
+	return appendDiff(make([]diffOp, 0, len(a)+len(b)), a, b)
+}
+
+// appendDiff appends the shortest edit script turning a into b to ops.
+func appendDiff(ops []diffOp, a, b []string) ([]diffOp, error) {
+	for len(a) > 0 && len(b) > 0 && a[0] == b[0] {
+		ops = append(ops, diffOp{' ', a[0]})
+		a, b = a[1:], b[1:]
+	}
+	common := 0
+	for common < len(a) && common < len(b) && a[len(a)-1-common] == b[len(b)-1-common] {
+		common++
+	}
+	suffix := a[len(a)-common:]
+	a, b = a[:len(a)-common], b[:len(b)-common]
+
+	switch {
+	case len(a) == 0:
+		for _, line := range b {
+			ops = append(ops, diffOp{'+', line})
+		}
+	case len(b) == 0:
+		for _, line := range a {
+			ops = append(ops, diffOp{'-', line})
+		}
+	default:
+		// with the common ends trimmed both halves are strictly smaller, so this always terminates
+		x, y, err := middleSnake(a, b)
+		if err != nil {
+			return nil, err
+		}
+		if ops, err = appendDiff(ops, a[:x], b[:y]); err != nil {
+			return nil, err
+		}
+		if ops, err = appendDiff(ops, a[x:], b[y:]); err != nil {
+			return nil, err
+		}
+	}
+	for _, line := range suffix {
+		ops = append(ops, diffOp{' ', line})
+	}
+	return ops, nil
+}
+
+// middleSnake returns a point (x, y) that lies on a shortest edit path from (0, 0) to (len(a), len(b)), roughly half
+// way along it. It searches forwards from the start and backwards from the end at the same time until the furthest
+// reaching paths of both searches overlap on a diagonal. Both searches only keep their latest paths.
+func middleSnake(a, b []string) (int, int, error) {
+	n, m := len(a), len(b)
+	max := (n + m + 1) / 2
+	offset := max + 1
+	// forward[offset+k] is the furthest x reached on diagonal k = x - y from the start, backward[offset+k] the furthest
+	// reached from the end, in the coordinates of the reversed inputs
+	forward := make([]int, 2*max+3)
+	backward := make([]int, 2*max+3)
+	delta := n - m
+	odd := delta%2 != 0
+	for d := 0; d <= max; d++ {
+		for k := -d; k <= d; k += 2 {
+			var x int
+			if k == -d || (k != d && forward[offset+k-1] < forward[offset+k+1]) {
+				x = forward[offset+k+1]
+			} else {
+				x = forward[offset+k-1] + 1
+			}
+			y := x - k
+			for x < n && y < m && a[x] == b[y] {
+				x++
+				y++
+			}
+			forward[offset+k] = x
+			if reverse := delta - k; odd && reverse >= -(d-1) && reverse <= d-1 && x+backward[offset+reverse] >= n {
+				return x, y, nil
+			}
+		}
+		for k := -d; k <= d; k += 2 {
+			var x int
+			if k == -d || (k != d && backward[offset+k-1] < backward[offset+k+1]) {
+				x = backward[offset+k+1]
+			} else {
+				x = backward[offset+k-1] + 1
+			}
+			y := x - k
+			for x < n && y < m && a[n-1-x] == b[m-1-y] {
+				x++
+				y++
+			}
+			backward[offset+k] = x
+			if ahead := delta - k; !odd && ahead >= -d && ahead <= d && x+forward[offset+ahead] >= n {
+				return n - x, m - y, nil
+			}
+		}
+	}
+	// the searches always meet by the time each has taken half of the longest possible path
+	return 0, 0, errNoMiddleSnake
+}
+
+// hunkRange formats one side of a hunk header the same way GNU diff does.
+func hunkRange(start, length int) string {
+	if length == 0 {
+		return fmt.Sprintf("%d,0", start)
+	}
+	if length == 1 {
+		return fmt.Sprintf("%d", start+1)
+	}
+	return fmt.Sprintf("%d,%d", start+1, length)
+}
+
+// unifiedHunks renders the hunks of a unified diff between two strings. It returns an empty string if the inputs are
+// equal.
+func unifiedHunks(a, b string) (string, error) {
+	ops, err := diffLines(splitLines(a), splitLines(b))
+	if err != nil {
+		return "", err
+	}
+
+	// positions of each op within a and b
+	aPos := make([]int, len(ops)+1)
+	bPos := make([]int, len(ops)+1)
+	var changes []int
+	for i, op := range ops {
+		aPos[i+1], bPos[i+1] = aPos[i], bPos[i]
+		if op.Kind != '+' {
+			aPos[i+1]++
+		}
+		if op.Kind != '-' {
+			bPos[i+1]++
+		}
+		if op.Kind != ' ' {
+			changes = append(changes, i)
+		}
+	}
+	if len(changes) == 0 {
+		return "", nil
+	}
+
+	var buf bytes.Buffer
+	for ci := 0; ci < len(changes); {
+		start := changes[ci] - diffContextLines
+		if start < 0 {
+			start = 0
+		}
+		last := changes[ci]
+		for ci++; ci < len(changes) && changes[ci]-last <= 2*diffContextLines+1; ci++ {
+			last = changes[ci]
+		}
+		end := last + diffContextLines + 1
+		if end > len(ops) {
+			end = len(ops)
+		}
+
+		fmt.Fprintf(
+			&buf, "@@ -%s +%s @@\n",
+			hunkRange(aPos[start], aPos[end]-aPos[start]),
+			hunkRange(bPos[start], bPos[end]-bPos[start]),
+		)
+		for _, op := range ops[start:end] {
+			buf.WriteByte(op.Kind)
+			buf.WriteString(op.Line)
+			if !strings.HasSuffix(op.Line, "\n") {
+				buf.WriteString("\n\\ No newline at end of file\n")
+			}
+		}
+	}
+	return buf.String(), nil
+}
+
+// isBinary uses the same heuristic as git: content containing a NUL byte in its first 8000 bytes is binary.
+func isBinary(content []byte) bool {
+	if len(content) > 8000 {
+		content = content[:8000]
+	}
+	return bytes.IndexByte(content, 0) >= 0
+}
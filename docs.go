@@ -0,0 +1,252 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/AstromechZA/spiro/engine"
+	"github.com/AstromechZA/spiro/templatefactory"
+)
+
+// templateOutput is a file or directory that a template generates, with the conditions under which it is generated.
+type templateOutput struct {
+	path  string
+	dir   bool
+	notes []string
+}
+
+// templateOutputs lists what a template generates, in template order with templated names as they are written. Files
+// and directories below a conditional or foreach directory inherit its notes.
+func templateOutputs(inputTemplate string, tf *templatefactory.TemplateFactory, manifest *templateManifest) ([]templateOutput, error) {
+	startDelim, endDelim := tf.Delimiters()
+	includes := make([]*ignoreRules, len(manifest.Include))
+	for i, include := range manifest.Include {
+		rules, err := newIgnoreRules([]string{include.Path})
+		if err != nil {
+			return nil, err
+		}
+		includes[i] = rules
+	}
+	var outputs []templateOutput
+	dirNotes := make(map[string][]string)
+	dirOutputs := make(map[string]string)
+	err := walkTemplate(inputTemplate, manifest, func(itemPath string, rel string, info os.FileInfo) error {
+		if rel == "." {
+			return nil
+		}
+		parent := filepath.ToSlash(filepath.Dir(rel))
+		notes := append([]string{}, dirNotes[parent]...)
+		for i, include := range manifest.Include {
+			if includes[i].Ignored(rel, info.IsDir()) {
+				notes = append(notes, fmt.Sprintf("only when `%s`", include.When))
+			}
+		}
+		name := info.Name()
+		pipeline, ok := manifest.Foreach[rel]
+		if p, rest, found := engine.ForeachName(name, startDelim, endDelim); found {
+			pipeline, name, ok = p, rest, true
+		}
+		if ok {
+			notes = append(notes, fmt.Sprintf("once for every element of `%s`", strings.TrimSpace(pipeline)))
+		}
+		out := name
+		if !info.IsDir() {
+			out = strings.Replace(name, engine.TemplatedSuffix, "", 1)
+		}
+		if parent != "." {
+			out = dirOutputs[parent] + "/" + out
+		}
+		if info.IsDir() {
+			dirNotes[rel] = notes
+			dirOutputs[rel] = out
+		}
+		outputs = append(outputs, templateOutput{path: out, dir: info.IsDir(), notes: notes})
+		return nil
+	})
+	return outputs, err
+}
+
+// declaresSpecPath reports whether a spec path read by a template is covered by a declared variable: the variable
+// itself, a value inside it or a map containing it.
+func declaresSpecPath(variables []templateVariable, path string) bool {
+	for _, v := range variables {
+		if path == v.Name || strings.HasPrefix(path, v.Name+".") || strings.HasPrefix(v.Name, path+".") {
+			return true
+		}
+	}
+	return false
+}
+
+// markdownCell escapes a value for a Markdown table cell.
+func markdownCell(value string) string {
+	return strings.Replace(strings.Replace(value, "|", "\\|", -1), "\n", " ", -1)
+}
+
+// writeTemplateDocs writes the Markdown documentation of a template for 'spiro docs': its inputs (declared variables
+// and the other spec values its files read), its hooks and the files it generates. name is how users refer to the
+// template on the command line.
+func writeTemplateDocs(w io.Writer, name string, inputTemplate string, tf *templatefactory.TemplateFactory, manifest *templateManifest) error {
+	references, err := specReferences(inputTemplate, tf, manifest)
+	if err != nil {
+		return err
+	}
+	outputs, err := templateOutputs(inputTemplate, tf, manifest)
+	if err != nil {
+		return err
+	}
+	preHooks, err := templateHookCommands(inputTemplate, manifest, "pre_gen")
+	if err != nil {
+		return err
+	}
+	postHooks, err := templateHookCommands(inputTemplate, manifest, "post_gen")
+	if err != nil {
+		return err
+	}
+
+	title := filepath.Base(filepath.Clean(name))
+	if title == "." || title == ".." || title == string(filepath.Separator) {
+		if abs, err := filepath.Abs(inputTemplate); err == nil {
+			title = filepath.Base(abs)
+		}
+	}
+	fmt.Fprintf(w, "# %s\n\n", title)
+	if manifest.Deprecated != nil {
+		fmt.Fprintf(w, "> **Deprecated:** %s", manifest.Deprecated.Message)
+		if manifest.Deprecated.Replacement != "" {
+			fmt.Fprintf(w, " Use `%s` instead.", manifest.Deprecated.Replacement)
+		}
+		fmt.Fprint(w, "\n\n")
+	}
+	if manifest.Version != "" {
+		fmt.Fprintf(w, "Version: `%s`\n\n", manifest.Version)
+	}
+	fmt.Fprintf(w, "## Usage\n\n```\nspiro %s spec.yaml <output directory>\n```\n\n", name)
+
+	fmt.Fprint(w, "## Inputs\n\n")
+	if len(manifest.Variables) > 0 {
+		fmt.Fprint(w, "| Name | Type | Default | Description |\n| --- | --- | --- | --- |\n")
+		for _, v := range manifest.Variables {
+			varType := v.Type
+			if varType == "" {
+				varType = "string"
+			}
+			def := "*required*"
+			if v.Default != nil {
+				def = fmt.Sprintf("`%v`", v.Default)
+			}
+			description := v.Description
+			if len(v.Choices) > 0 {
+				choices := make([]string, len(v.Choices))
+				for i, choice := range v.Choices {
+					choices[i] = fmt.Sprintf("`%v`", choice)
+				}
+				description = strings.TrimSpace(description + " (one of " + strings.Join(choices, ", ") + ")")
+			}
+			fmt.Fprintf(w, "| `%s` | %s | %s | %s |\n", v.Name, varType, markdownCell(def), markdownCell(description))
+		}
+		fmt.Fprintln(w)
+	}
+	var undeclared []string
+	for path := range references {
+		if !declaresSpecPath(manifest.Variables, path) {
+			undeclared = append(undeclared, path)
+		}
+	}
+	sort.Strings(undeclared)
+	if len(undeclared) > 0 {
+		if len(manifest.Variables) > 0 {
+			fmt.Fprint(w, "The template also reads these spec values:\n\n")
+		} else {
+			fmt.Fprint(w, "The template reads these spec values:\n\n")
+		}
+		for _, path := range undeclared {
+			var files []string
+			for _, location := range references[path] {
+				if len(files) == 0 || files[len(files)-1] != location.path {
+					files = append(files, location.path)
+				}
+			}
+			fmt.Fprintf(w, "- `%s` (in `%s`)\n", path, strings.Join(files, "`, `"))
+		}
+		fmt.Fprintln(w)
+	} else if len(manifest.Variables) == 0 {
+		fmt.Fprint(w, "The template does not read any spec values.\n\n")
+	}
+	if stat, err := os.Stat(filepath.Join(inputTemplate, specSchemaFileName)); err == nil && !stat.IsDir() && manifest.SpecSchema {
+		fmt.Fprintf(w, "The spec is validated against the JSON Schema in `%s`.\n\n", specSchemaFileName)
+	}
+	if len(manifest.Sensitive) > 0 {
+		fmt.Fprintf(w, "Sensitive values, never shown in logs or reports: `%s`.\n\n", strings.Join(manifest.Sensitive, "`, `"))
+	}
+	if len(manifest.DeprecatedVariables) > 0 {
+		paths := make([]string, 0, len(manifest.DeprecatedVariables))
+		for path := range manifest.DeprecatedVariables {
+			paths = append(paths, path)
+		}
+		sort.Strings(paths)
+		fmt.Fprint(w, "Deprecated spec values:\n\n")
+		for _, path := range paths {
+			fmt.Fprintf(w, "- `%s`: %s\n", path, manifest.DeprecatedVariables[path])
+		}
+		fmt.Fprintln(w)
+	}
+
+	fmt.Fprint(w, "## Hooks\n\n")
+	if len(preHooks) == 0 && len(postHooks) == 0 {
+		fmt.Fprint(w, "The template has no hooks.\n\n")
+	}
+	for _, stage := range []struct {
+		title string
+		hooks []hook
+	}{
+		{"Run before rendering:", preHooks},
+		{"Run in the generated project after rendering:", postHooks},
+	} {
+		if len(stage.hooks) == 0 {
+			continue
+		}
+		fmt.Fprintf(w, "%s\n\n", stage.title)
+		for _, h := range stage.hooks {
+			fmt.Fprintf(w, "- `%s`\n", filepath.ToSlash(h.name))
+		}
+		fmt.Fprintln(w)
+	}
+
+	fmt.Fprint(w, "## Outputs\n\n")
+	if len(outputs) == 0 {
+		// single file templates render to a file named like the template
+		fmt.Fprintf(w, "- `%s`\n", strings.Replace(filepath.Base(inputTemplate), engine.TemplatedSuffix, "", 1))
+	}
+	for _, output := range outputs {
+		path := output.path
+		if output.dir {
+			path += "/"
+		}
+		fmt.Fprintf(w, "- `%s`", path)
+		if len(output.notes) > 0 {
+			fmt.Fprintf(w, " (%s)", strings.Join(output.notes, ", "))
+		}
+		fmt.Fprintln(w)
+	}
+	if len(manifest.Rewrite) > 0 {
+		fmt.Fprint(w, "\nOutput paths are rewritten by the `rewrite` rules in the template manifest.\n")
+	}
+	return nil
+}
+
+// runTemplateDocs loads a template and writes its documentation for 'spiro docs'.
+func runTemplateDocs(w io.Writer, name string, inputTemplate string, setup func(tf *templatefactory.TemplateFactory) error) error {
+	manifest, err := loadManifest(inputTemplate)
+	if err != nil {
+		return err
+	}
+	tf := templatefactory.NewTemplateFactory()
+	if err := manifest.withDelimiters(setup)(tf); err != nil {
+		return err
+	}
+	return writeTemplateDocs(w, name, inputTemplate, tf, manifest)
+}
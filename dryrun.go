@@ -0,0 +1,99 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// plannedAction records what processing a single template item produced, for the -dry-run report.
+type plannedAction struct {
+	// Template is the template item, it is empty for directories that spiro creates itself (eg: matrix subfolders).
+	Template string
+	// Output is the output path, it is empty when the item was skipped because its name evaluated to ''.
+	Output   string
+	Dir      bool
+	Rendered bool
+}
+
+// actionPlan collects the actions of a run in the order they happened. A nil plan records nothing.
+type actionPlan struct {
+	actions []plannedAction
+}
+
+func (p *actionPlan) add(action plannedAction) {
+	if p != nil {
+		p.actions = append(p.actions, action)
+	}
+}
+
+// reportPlan prints every directory and file that rendering would produce, along with the template item it came from,
+// whether it is rendered or copied, and whether it would be created, updated or left unchanged. Nothing is written.
+func reportPlan(plan *actionPlan, outputDir string, changes []pendingChange, redact *redactor) {
+	pending := make(map[string]pendingChange, len(changes))
+	for _, change := range changes {
+		pending[change.Path] = change
+	}
+	relative := func(output string) string {
+		if rel, err := filepath.Rel(outputDir, output); err == nil {
+			return filepath.ToSlash(rel)
+		}
+		return output
+	}
+
+	reported := make(map[string]bool)
+	for _, action := range plan.actions {
+		if action.Output == "" {
+			suffix := ""
+			if action.Dir {
+				suffix = "/"
+			}
+			fmt.Printf("Would skip '%s%s' since its name evaluated to ''\n", action.Template, suffix)
+			continue
+		}
+		rel := relative(action.Output)
+		source := ""
+		if action.Template != "" {
+			source = fmt.Sprintf(" (copied from '%s')", action.Template)
+			if action.Rendered {
+				source = fmt.Sprintf(" (rendered from '%s')", action.Template)
+			} else if action.Dir {
+				source = fmt.Sprintf(" (from '%s')", action.Template)
+			}
+		}
+		if action.Dir {
+			if _, err := os.Stat(longPath(action.Output)); os.IsNotExist(err) && !reported[rel+"/"] {
+				fmt.Printf("Would create directory '%s/'%s\n", redact.Redact(rel), source)
+			}
+			reported[rel+"/"] = true
+			continue
+		}
+		reported[rel] = true
+		change, ok := pending[rel]
+		switch {
+		case !ok:
+			fmt.Printf("Would leave '%s' unchanged%s\n", redact.Redact(rel), source)
+		case change.IsNew:
+			fmt.Printf("Would create '%s'%s\n", redact.Redact(rel), source)
+		default:
+			fmt.Printf("Would update '%s'%s\n", redact.Redact(rel), source)
+		}
+	}
+	// files that spiro writes itself, such as the generation manifest
+	for _, change := range changes {
+		if reported[change.Path] {
+			continue
+		}
+		if change.IsNew {
+			fmt.Printf("Would create '%s'\n", redact.Redact(change.Path))
+		} else {
+			fmt.Printf("Would update '%s'\n", redact.Redact(change.Path))
+		}
+	}
+
+	if len(changes) == 0 {
+		fmt.Println("The output is up to date, no changes would be made")
+	} else {
+		fmt.Printf("%d file(s) would change\n", len(changes))
+	}
+}
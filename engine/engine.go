@@ -0,0 +1,468 @@
+// Package engine renders spiro templates so that other programs can generate projects without shelling out to the
+// spiro binary. It is the renderer that the spiro command itself uses: file and directory names are templated, files
+// with a '.templated' suffix have their content rendered while other files are copied, items whose name renders to an
+// empty string are skipped, items can be rendered once per element of a list with foreach, and the template's own files
+// (its manifest, ignore file, hooks, ...) are never part of the output. Manifest features such as ignore rules,
+// post-processing or overwrite policies are left to the caller, who plugs them in through the Renderer hooks.
+package engine
+
+import (
+	"fmt"
+	"io/fs"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/AstromechZA/spiro/templatefactory"
+)
+
+// TemplatedSuffix marks template files whose content is rendered rather than copied.
+const TemplatedSuffix = ".templated"
+
+// The entries at the root of a directory template that belong to the template rather than to its output.
+const (
+	ManifestFileName   = "spiro.yaml"
+	IgnoreFileName     = ".spiroignore"
+	HooksDirName       = "hooks"
+	SnippetsDirName    = "snippets"
+	SpecSchemaFileName = "spec.schema.json"
+)
+
+// DefaultMetadata is used by a Renderer that doesn't set Metadata. The hooks and snippets directories and the spec
+// schema only belong to templates whose manifest declares them, add HooksDirName, SnippetsDirName or
+// SpecSchemaFileName to the Metadata of those.
+var DefaultMetadata = []string{ManifestFileName, IgnoreFileName, ".git"}
+
+// Output receives the rendered project. Paths are slash separated and already joined with the output directory.
+type Output interface {
+	MakeDir(dir string) error
+	WriteFile(file string, content []byte) error
+	Chmod(file string, mode fs.FileMode) error
+}
+
+// Outputs records rendered files so that templates can read other generated files, see Renderer.Outputs.
+type Outputs interface {
+	// Record is called with the content of every rendered or copied file
+	Record(file string, content string)
+	// TakeMissing returns and clears the output file that the last render asked for before it was rendered
+	TakeMissing() string
+}
+
+// Progress counts the files that have been rendered.
+type Progress interface {
+	Add(n int)
+	AddTotal(n int)
+}
+
+// Action describes a processed template item: a directory, a rendered or a copied file. Output is empty when the item
+// was skipped because its name rendered to an empty string.
+type Action struct {
+	Template string
+	Output   string
+	Dir      bool
+	Rendered bool
+}
+
+// Renderer renders a template tree into an Output. Every hook is optional.
+type Renderer struct {
+	// Factory renders names and content, register template functions on it before rendering
+	Factory *templatefactory.TemplateFactory
+	// Source is the location the template was read from, template items are shown relative to it in errors and logs
+	Source string
+	// Metadata lists the entries at the root of a directory template that are never rendered, DefaultMetadata when nil
+	Metadata []string
+	// Ignore reports whether a template item (a slash separated path relative to the template root) is skipped
+	Ignore func(name string, dir bool) bool
+	// Only reports whether a template item is rendered at all, unlike ignored items the ones left out are not logged
+	Only func(name string, dir bool) bool
+	// Foreach maps template items to the pipeline producing the list they are rendered once per element of, in
+	// addition to items whose name contains a foreach action
+	Foreach map[string]string
+	// Name is applied to every rendered file and directory name
+	Name func(name string) string
+	// Check is called with every output file and directory before it is created
+	Check func(output string) error
+	// Rewrite returns the path that a file is written to instead of its output path
+	Rewrite func(outputFile string) (string, error)
+	// Prepare is applied to the text of every '.templated' file before it is rendered
+	Prepare func(outputFile string, text string) string
+	// Transform is applied to the rendered content of every '.templated' file before it is written
+	Transform func(outputFile string, content string) (string, error)
+	// AllowWrite reports whether a rendered or copied file is written, eg: to keep existing files
+	AllowWrite func(outputFile string, content []byte) (bool, error)
+	// Outputs records rendered files. Files whose render asks for an output file that hasn't been rendered yet are
+	// deferred until ProcessDeferred.
+	Outputs Outputs
+	// Planned is called with every processed item
+	Planned func(action Action)
+	// Progress counts rendered files, foreach items add to its total
+	Progress Progress
+	// Measure wraps the rendering of every file, eg: to benchmark it
+	Measure func(item string, fn func() error) error
+	// Logf logs every processed item, Debugf how long each file took
+	Logf   func(format string, args ...interface{})
+	Debugf func(format string, args ...interface{})
+	// Problems collects the errors of items that fail to render and carries on with the rest, otherwise rendering stops
+	// at the first error
+	Problems *[]string
+
+	input    fs.FS
+	root     string
+	out      Output
+	deferred []deferredFile
+}
+
+// deferredFile is a template file whose rendering waits for another output file.
+type deferredFile struct {
+	item      string
+	outputDir string
+	waitsFor  string
+	// context is the spec, or foreach element context, that the file is rendered with
+	context *map[string]interface{}
+}
+
+// NewRenderer returns a Renderer with a template factory that has no extra template functions.
+func NewRenderer() *Renderer {
+	return &Renderer{Factory: templatefactory.NewTemplateFactory()}
+}
+
+// Render renders the items at the root of the input directly into the root of the output using the spec.
+func (r *Renderer) Render(input fs.FS, spec map[string]interface{}, out Output) error {
+	if err := r.Factory.SetSpec(&spec); err != nil {
+		return err
+	}
+	if err := r.ProcessInto(input, ".", "", out); err != nil {
+		return err
+	}
+	return r.ProcessDeferred()
+}
+
+// Process renders the template item root of input into outputDir. A directory template becomes a directory of
+// outputDir named after it, a single file template becomes a file of outputDir.
+func (r *Renderer) Process(input fs.FS, root string, outputDir string, out Output) error {
+	r.input, r.root, r.out = input, root, out
+	return r.process(root, outputDir)
+}
+
+// ProcessInto renders the template item root of input so that the content of a directory template lands directly
+// inside outputDir rather than in a new directory of it.
+func (r *Renderer) ProcessInto(input fs.FS, root string, outputDir string, out Output) error {
+	r.input, r.root, r.out = input, root, out
+	stat, err := fs.Stat(input, root)
+	if err != nil {
+		return fmt.Errorf("Error processing template %s: %s", r.display(root), err.Error())
+	}
+	if stat.IsDir() {
+		return r.processChildren(root, outputDir)
+	}
+	return r.forEach(root, func() error {
+		return r.measure(root, func() error {
+			return r.processFile(root, outputDir)
+		})
+	})
+}
+
+// ProcessDeferred renders the files that were deferred because they asked for an output file before it had been
+// rendered. It keeps going as long as files can be rendered, the remaining ones wait for a file that is never rendered
+// or for each other.
+func (r *Renderer) ProcessDeferred() error {
+	parent := r.Factory.Spec()
+	defer r.Factory.SetSpec(parent)
+	for len(r.deferred) > 0 {
+		pending := r.deferred
+		r.deferred = nil
+		for _, d := range pending {
+			if err := r.Factory.SetSpec(d.context); err != nil {
+				return err
+			}
+			if err := r.measure(d.item, func() error {
+				return r.processFile(d.item, d.outputDir)
+			}); err != nil {
+				return err
+			}
+		}
+		if len(r.deferred) == len(pending) {
+			d := r.deferred[0]
+			return fmt.Errorf("Error while rendering template for '%s': '%s' is never rendered, or it depends on this file in turn", r.display(d.item), d.waitsFor)
+		}
+	}
+	return nil
+}
+
+// CountFiles returns the number of files that processing the template item root of input will visit, for progress
+// reporting.
+func (r *Renderer) CountFiles(input fs.FS, root string) int {
+	count := 0
+	fs.WalkDir(input, root, func(item string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return nil
+		}
+		if item != root && r.skipped(root, item, entry.IsDir()) {
+			if entry.IsDir() {
+				return fs.SkipDir
+			}
+			return nil
+		}
+		if !entry.IsDir() {
+			count++
+		}
+		return nil
+	})
+	return count
+}
+
+// IsMetadata reports whether an entry at the root of a directory template belongs to the template itself rather than
+// being part of the output.
+func (r *Renderer) IsMetadata(name string) bool {
+	metadata := r.Metadata
+	if metadata == nil {
+		metadata = DefaultMetadata
+	}
+	for _, m := range metadata {
+		if name == m {
+			return true
+		}
+	}
+	return false
+}
+
+// skipped reports whether a template item below root is left out as template metadata, or by the Ignore or Only hooks.
+func (r *Renderer) skipped(root string, item string, dir bool) bool {
+	if path.Dir(item) == root && r.IsMetadata(path.Base(item)) {
+		return true
+	}
+	rel := r.relativePath(root, item)
+	return r.Ignore != nil && r.Ignore(rel, dir) || r.Only != nil && !r.Only(rel, dir)
+}
+
+// relativePath returns the path of a template item relative to the template root.
+func (r *Renderer) relativePath(root string, item string) string {
+	if root == "." {
+		return item
+	}
+	if item == root {
+		return "."
+	}
+	return strings.TrimPrefix(item, root+"/")
+}
+
+// display returns how a template item is shown in errors and logs.
+func (r *Renderer) display(item string) string {
+	return path.Join(r.Source, item)
+}
+
+func (r *Renderer) logf(format string, args ...interface{}) {
+	if r.Logf != nil {
+		r.Logf(format, args...)
+	}
+}
+
+func (r *Renderer) planned(action Action) {
+	if r.Planned != nil {
+		action.Template = r.display(action.Template)
+		r.Planned(action)
+	}
+}
+
+func (r *Renderer) measure(item string, fn func() error) error {
+	if r.Measure == nil {
+		return fn()
+	}
+	return r.Measure(r.display(item), fn)
+}
+
+func (r *Renderer) process(item string, outputDir string) error {
+	stat, err := fs.Stat(r.input, item)
+	if err != nil {
+		return fmt.Errorf("Error processing template %s: %s", r.display(item), err.Error())
+	}
+	return r.forEach(item, func() error {
+		if stat.IsDir() {
+			return r.processDir(item, outputDir)
+		}
+		return r.measure(item, func() error {
+			return r.processFile(item, outputDir)
+		})
+	})
+}
+
+// outputName renders the output name of a template item, an empty name means the item is skipped.
+func (r *Renderer) outputName(item string) (string, error) {
+	name, err := RenderName(r.Factory, r.display(r.itemName(item)))
+	if err != nil || name == "" {
+		return "", err
+	}
+	if r.Name != nil {
+		name = r.Name(name)
+	}
+	return name, nil
+}
+
+func (r *Renderer) processDir(item string, outputDir string) error {
+	name, err := r.outputName(item)
+	if err != nil {
+		return err
+	}
+	if name == "" {
+		r.logf("Skipping '%s' since the name evaluated to ''", r.display(item))
+		r.planned(Action{Template: item, Dir: true})
+		return nil
+	}
+
+	newOutputDir := path.Join(outputDir, name)
+	if r.Check != nil {
+		if err := r.Check(newOutputDir); err != nil {
+			return err
+		}
+	}
+	r.logf("Processing '%s/' -> '%s/'", r.display(item), newOutputDir)
+	r.planned(Action{Template: item, Output: newOutputDir, Dir: true})
+	if err := r.out.MakeDir(newOutputDir); err != nil {
+		return fmt.Errorf("Error while processing '%s': %s", r.display(item), err.Error())
+	}
+	return r.processChildren(item, newOutputDir)
+}
+
+// processChildren processes every item inside the template directory into the given output directory.
+func (r *Renderer) processChildren(dir string, outputDir string) error {
+	items, err := fs.ReadDir(r.input, dir)
+	if err != nil {
+		return fmt.Errorf("Error while reading '%s': %s", r.display(dir), err.Error())
+	}
+	for _, entry := range items {
+		item := path.Join(dir, entry.Name())
+		if dir == r.root && r.IsMetadata(entry.Name()) {
+			continue
+		}
+		rel := r.relativePath(r.root, item)
+		if r.Ignore != nil && r.Ignore(rel, entry.IsDir()) {
+			r.logf("Ignoring '%s'", r.display(item))
+			continue
+		}
+		if r.Only != nil && !r.Only(rel, entry.IsDir()) {
+			continue
+		}
+		if err := r.process(item, outputDir); err != nil {
+			if r.Problems == nil {
+				return err
+			}
+			*r.Problems = append(*r.Problems, err.Error())
+		}
+	}
+	return nil
+}
+
+func (r *Renderer) processFile(item string, outputDir string) error {
+	name, err := r.outputName(item)
+	if err != nil {
+		return err
+	}
+	name, templated := OutputName(name)
+	if name == "" {
+		r.logf("Skipping '%s' since the name evaluated to ''", r.display(item))
+		r.planned(Action{Template: item})
+		return nil
+	}
+	outputFile := path.Join(outputDir, name)
+	if r.Rewrite != nil {
+		if outputFile, err = r.Rewrite(outputFile); err != nil {
+			return fmt.Errorf("Error while processing '%s': %s", r.display(item), err.Error())
+		}
+	}
+	if r.Check != nil {
+		if err := r.Check(outputFile); err != nil {
+			return err
+		}
+	}
+
+	r.logf("Processing '%s' -> '%s'", r.display(item), outputFile)
+	start := time.Now()
+	content, err := fs.ReadFile(r.input, item)
+	if err != nil {
+		return fmt.Errorf("Error while reading '%s': %s", r.display(item), err.Error())
+	}
+	if templated {
+		if r.Outputs != nil {
+			r.Outputs.TakeMissing()
+		}
+		text := string(content)
+		if r.Prepare != nil {
+			text = r.Prepare(outputFile, text)
+		}
+		rendered, err := r.Factory.RenderNamed(r.display(item), text)
+		if err != nil && r.Outputs != nil {
+			if missing := r.Outputs.TakeMissing(); missing != "" {
+				r.logf("Deferring '%s' until '%s' has been rendered", r.display(item), missing)
+				r.deferred = append(r.deferred, deferredFile{
+					item: item, outputDir: outputDir, waitsFor: missing, context: r.Factory.Spec(),
+				})
+				return nil
+			}
+		}
+		if err != nil {
+			return fmt.Errorf("Error while rendering template for '%s': %s", r.display(item), err.Error())
+		}
+		r.planned(Action{Template: item, Output: outputFile, Rendered: true})
+		if r.Transform != nil {
+			if rendered, err = r.Transform(outputFile, rendered); err != nil {
+				return fmt.Errorf("Error while post-processing '%s': %s", r.display(item), err.Error())
+			}
+		}
+		content = []byte(rendered)
+	} else {
+		r.planned(Action{Template: item, Output: outputFile})
+	}
+	if r.Outputs != nil {
+		r.Outputs.Record(outputFile, string(content))
+	}
+	if r.Progress != nil {
+		r.Progress.Add(1)
+	}
+	if r.AllowWrite != nil {
+		if write, err := r.AllowWrite(outputFile, content); err != nil {
+			return fmt.Errorf("Error while processing '%s': %s", r.display(item), err.Error())
+		} else if !write {
+			return nil
+		}
+	}
+	if err := r.out.WriteFile(outputFile, content); err != nil {
+		return fmt.Errorf("Error while writing file bytes for '%s': %s", r.display(item), err.Error())
+	}
+
+	info, err := fs.Stat(r.input, item)
+	if err != nil {
+		return fmt.Errorf("Error while checking file permissions for '%s': %s", r.display(item), err.Error())
+	}
+	if err := r.out.Chmod(outputFile, info.Mode()); err != nil {
+		return fmt.Errorf("Error while writing file permissions for '%s': %s", r.display(item), err.Error())
+	}
+	if r.Debugf != nil {
+		if templated {
+			r.Debugf("Rendered '%s' in %s", outputFile, time.Since(start))
+		} else {
+			r.Debugf("Copied '%s' in %s", outputFile, time.Since(start))
+		}
+	}
+	return nil
+}
+
+// RenderName renders the base name of a template item, surrounding whitespace is removed from the result.
+func RenderName(tf *templatefactory.TemplateFactory, item string) (string, error) {
+	name := path.Base(item)
+	if tf.StringContainsTemplating(name) {
+		var err error
+		if name, err = tf.Render(name); err != nil {
+			return "", fmt.Errorf("Error while processing '%s': %s", item, err.Error())
+		}
+	}
+	return strings.TrimSpace(name), nil
+}
+
+// OutputName strips the '.templated' suffix from a rendered file name and reports whether the content of the file is
+// rendered. An empty name means the file is skipped.
+func OutputName(rendered string) (string, bool) {
+	if strings.HasSuffix(rendered, TemplatedSuffix) {
+		return strings.TrimSuffix(rendered, TemplatedSuffix), true
+	}
+	return rendered, false
+}
@@ -0,0 +1,128 @@
+package engine
+
+import (
+	"fmt"
+	"path"
+	"reflect"
+	"regexp"
+	"strings"
+)
+
+// ForeachName splits a file or directory name like 'svc-{{foreach .services}}{{.name}}{{end}}', which is rendered once
+// per element of a list, into the pipeline producing the list and the name rendered for each element (here
+// 'svc-{{.name}}'). Names without a foreach action are returned unchanged.
+func ForeachName(name string, startDelim string, endDelim string) (string, string, bool) {
+	if !strings.Contains(name, "foreach") {
+		return "", name, false
+	}
+	start, end := regexp.QuoteMeta(startDelim), regexp.QuoteMeta(endDelim)
+	pattern := regexp.MustCompile(`^(.*?)` + start + `\s*foreach\s+(.+?)\s*` + end + `(.*)` + start + `\s*end\s*` + end + `(.*)$`)
+	m := pattern.FindStringSubmatch(name)
+	if m == nil {
+		return "", name, false
+	}
+	return m[2], m[1] + m[3] + m[4], true
+}
+
+// foreachPipeline returns the pipeline producing the list that a template item is rendered once per element of, from
+// the Foreach map or from the item name.
+func (r *Renderer) foreachPipeline(item string) (string, bool) {
+	if pipeline, ok := r.Foreach[r.relativePath(r.root, item)]; ok {
+		return pipeline, true
+	}
+	startDelim, endDelim := r.Factory.Delimiters()
+	pipeline, _, ok := ForeachName(path.Base(item), startDelim, endDelim)
+	return pipeline, ok
+}
+
+// itemName returns the template path whose base name is rendered for an item, without any foreach action in its name.
+func (r *Renderer) itemName(item string) string {
+	startDelim, endDelim := r.Factory.Delimiters()
+	if _, name, ok := ForeachName(path.Base(item), startDelim, endDelim); ok {
+		return path.Join(path.Dir(item), name)
+	}
+	return item
+}
+
+// forEach calls fn once for a normal template item. For an item expanded with foreach it calls fn once per element of
+// the list, with the element's context in place of the current one.
+func (r *Renderer) forEach(item string, fn func() error) error {
+	pipeline, ok := r.foreachPipeline(item)
+	if !ok {
+		return fn()
+	}
+	value, err := r.Factory.Value(pipeline)
+	if err != nil {
+		return fmt.Errorf("Error while evaluating the foreach list for '%s': %s", r.display(item), err.Error())
+	}
+	items := reflect.ValueOf(value)
+	if value != nil && items.Kind() != reflect.Slice && items.Kind() != reflect.Array {
+		return fmt.Errorf("Error while evaluating the foreach list for '%s': expected a list but got %T", r.display(item), value)
+	}
+	count := 0
+	if value != nil {
+		count = items.Len()
+	}
+	if r.Progress != nil {
+		// the item was counted once up front
+		r.Progress.AddTotal(r.CountFiles(r.input, item) * (count - 1))
+	}
+
+	parent := r.Factory.Spec()
+	defer r.Factory.SetSpec(parent)
+	for i := 0; i < count; i++ {
+		context := eachContext(*parent, items.Index(i).Interface(), i)
+		if err := r.Factory.SetSpec(&context); err != nil {
+			return err
+		}
+		if err := fn(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// eachContext is the context of one foreach element: the parent context with the element available as .item and its
+// position as .index. When the element is a map its keys can also be used directly, eg: .name instead of .item.name.
+func eachContext(parent map[string]interface{}, item interface{}, index int) map[string]interface{} {
+	context := make(map[string]interface{}, len(parent)+2)
+	for k, v := range parent {
+		context[k] = v
+	}
+	item = NormalizeValue(item)
+	if fields, ok := item.(map[string]interface{}); ok {
+		for k, v := range fields {
+			context[k] = v
+		}
+	}
+	context["item"] = item
+	context["index"] = index
+	return context
+}
+
+// NormalizeValue recursively converts the map[interface{}]interface{} values produced by YAML decoders into
+// map[string]interface{}, which is what JSON encoding and most template functions expect. Non-string keys (eg: numbers
+// or booleans) are converted to their string form.
+func NormalizeValue(in interface{}) interface{} {
+	switch v := in.(type) {
+	case map[interface{}]interface{}:
+		out := make(map[string]interface{}, len(v))
+		for k, item := range v {
+			out[fmt.Sprint(k)] = NormalizeValue(item)
+		}
+		return out
+	case map[string]interface{}:
+		out := make(map[string]interface{}, len(v))
+		for k, item := range v {
+			out[k] = NormalizeValue(item)
+		}
+		return out
+	case []interface{}:
+		out := make([]interface{}, len(v))
+		for i, item := range v {
+			out[i] = NormalizeValue(item)
+		}
+		return out
+	}
+	return in
+}
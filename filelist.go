@@ -0,0 +1,78 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// fileSelection is the set of template paths, relative to the template root, that -files-from limits rendering to.
+// Selecting a directory selects everything inside it.
+type fileSelection struct {
+	paths map[string]bool
+}
+
+// readFileSelection reads a newline separated list of template files, such as the output of 'git diff --name-only'.
+// Relative paths are resolved from the working directory when that leads inside the template, and are otherwise taken
+// to be relative to the template root. Paths outside the template, like the other files changed in a commit, select
+// nothing.
+func readFileSelection(r io.Reader, inputTemplate string) (*fileSelection, error) {
+	root, err := filepath.Abs(inputTemplate)
+	if err != nil {
+		return nil, err
+	}
+	s := &fileSelection{paths: make(map[string]bool)}
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := strings.TrimRight(scanner.Text(), " \t\r")
+		if line == "" {
+			continue
+		}
+		if abs, err := filepath.Abs(line); err == nil {
+			if rel, err := filepath.Rel(root, abs); err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+				s.paths[filepath.ToSlash(rel)] = true
+				continue
+			}
+		}
+		if rel := filepath.ToSlash(filepath.Clean(line)); !filepath.IsAbs(line) && rel != ".." && !strings.HasPrefix(rel, "../") {
+			s.paths[rel] = true
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("Could not read the list of template files: %s", err.Error())
+	}
+	return s, nil
+}
+
+// openFileSelection reads the -files-from list from a file, or from stdin when it is '-'.
+func openFileSelection(listFile string, inputTemplate string) (*fileSelection, error) {
+	if listFile == "-" {
+		return readFileSelection(os.Stdin, inputTemplate)
+	}
+	f, err := os.Open(listFile)
+	if err != nil {
+		return nil, fmt.Errorf("Could not read the list of template files: %s", err.Error())
+	}
+	defer f.Close()
+	return readFileSelection(f, inputTemplate)
+}
+
+// includes reports whether the template path rel is rendered: files that are selected or inside a selected directory,
+// and the directories leading to them. A nil selection includes everything.
+func (s *fileSelection) includes(rel string, dir bool) bool {
+	if s == nil || s.paths["."] {
+		return true
+	}
+	for selected := range s.paths {
+		if rel == selected || strings.HasPrefix(rel, selected+"/") {
+			return true
+		}
+		if dir && strings.HasPrefix(selected, rel+"/") {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,54 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// stringSliceFlag is a flag.Value that can be given multiple times, collecting each value in order.
+type stringSliceFlag []string
+
+func (f *stringSliceFlag) String() string {
+	return strings.Join(*f, " ")
+}
+
+func (f *stringSliceFlag) Set(value string) error {
+	*f = append(*f, value)
+	return nil
+}
+
+// specOverride is a single -set or -set-json flag: a dotted spec path and the value to put there.
+type specOverride struct {
+	path  string
+	value string
+	json  bool
+}
+
+// specOverrideFlag collects -set (plain string values) and -set-json (JSON values) flags into one list so that they
+// are applied in the order they were given.
+type specOverrideFlag struct {
+	overrides *[]specOverride
+	json      bool
+}
+
+func (f specOverrideFlag) String() string {
+	if f.overrides == nil {
+		return ""
+	}
+	var parts []string
+	for _, o := range *f.overrides {
+		if o.json == f.json {
+			parts = append(parts, o.path+"="+o.value)
+		}
+	}
+	return strings.Join(parts, " ")
+}
+
+func (f specOverrideFlag) Set(value string) error {
+	parts := strings.SplitN(value, "=", 2)
+	if len(parts) != 2 || parts[0] == "" {
+		return fmt.Errorf("expected key=value but got '%s'", value)
+	}
+	*f.overrides = append(*f.overrides, specOverride{path: parts[0], value: parts[1], json: f.json})
+	return nil
+}
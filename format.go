@@ -0,0 +1,81 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"go/format"
+	"os"
+	"os/exec"
+	"sort"
+	"strings"
+)
+
+// builtinFormatters are the formatters that need no external command, named in the manifest 'format' map.
+var builtinFormatters = map[string]func(content []byte) ([]byte, error){
+	"gofmt": format.Source,
+	"json": func(content []byte) ([]byte, error) {
+		var out bytes.Buffer
+		if err := json.Indent(&out, bytes.TrimSpace(content), "", "  "); err != nil {
+			return nil, err
+		}
+		out.WriteString("\n")
+		return out.Bytes(), nil
+	},
+}
+
+// fileFormatter formats the rendered files matching a gitignore style pattern, relative to the root of the generated
+// output, with a built-in formatter or an external command.
+type fileFormatter struct {
+	pattern string
+	files   *ignoreRules
+	command string
+}
+
+// newFileFormatters compiles the manifest 'format' map. When several patterns match a file, its formatters run in the
+// order of their patterns.
+func newFileFormatters(formats map[string]string) ([]*fileFormatter, error) {
+	patterns := make([]string, 0, len(formats))
+	for pattern := range formats {
+		patterns = append(patterns, pattern)
+	}
+	sort.Strings(patterns)
+	var formatters []*fileFormatter
+	for _, pattern := range patterns {
+		command := strings.TrimSpace(formats[pattern])
+		if command == "" {
+			return nil, fmt.Errorf("the formatter for '%s' is empty", pattern)
+		}
+		files, err := newIgnoreRules([]string{pattern})
+		if err != nil {
+			return nil, err
+		}
+		formatters = append(formatters, &fileFormatter{pattern: pattern, files: files, command: command})
+	}
+	return formatters, nil
+}
+
+// format returns the content of the rendered file at rel formatted. External commands are run with 'sh -c', get the
+// content on stdin and $SPIRO_FILE set to rel, and must write the formatted content to stdout.
+func (f *fileFormatter) format(rel string, content string) (string, error) {
+	if builtin, ok := builtinFormatters[f.command]; ok {
+		out, err := builtin([]byte(content))
+		if err != nil {
+			return "", fmt.Errorf("Error while formatting '%s' with %s: %s", rel, f.command, err.Error())
+		}
+		return string(out), nil
+	}
+	var stdout, stderr bytes.Buffer
+	cmd := exec.Command("sh", "-c", f.command)
+	cmd.Env = append(os.Environ(), "SPIRO_FILE="+rel)
+	cmd.Stdin = strings.NewReader(content)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return "", fmt.Errorf("Error while formatting '%s' with '%s': %s: %s", rel, f.command, err.Error(), msg)
+		}
+		return "", fmt.Errorf("Error while formatting '%s' with '%s': %s", rel, f.command, err.Error())
+	}
+	return stdout.String(), nil
+}
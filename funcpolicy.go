@@ -0,0 +1,55 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/AstromechZA/spiro/templatefactory"
+)
+
+// splitList splits a comma separated list of names, ignoring whitespace and empty entries.
+func splitList(list string) []string {
+	var out []string
+	for _, name := range strings.Split(list, ",") {
+		if name = strings.TrimSpace(name); name != "" {
+			out = append(out, name)
+		}
+	}
+	return out
+}
+
+// restrictTemplateFunctions applies the -enable-funcs and -disable-funcs lists. When an enable list is given, every
+// registered function not on it is disabled; the builtin template functions are only affected by the disable list
+// since templates can hardly be written without them.
+func restrictTemplateFunctions(tf *templatefactory.TemplateFactory, enable string, disable string) error {
+	known := make(map[string]bool)
+	registered := tf.TemplateFunctionNames()
+	for _, name := range registered {
+		known[name] = true
+	}
+	for _, name := range templatefactory.BuiltinFunctions {
+		known[name] = true
+	}
+
+	enabled := make(map[string]bool)
+	for _, name := range splitList(enable) {
+		if !known[name] {
+			return fmt.Errorf("Cannot enable unknown template function '%s'", name)
+		}
+		enabled[name] = true
+	}
+	if len(enabled) > 0 {
+		for _, name := range registered {
+			if !enabled[name] {
+				tf.DisableTemplateFunction(name)
+			}
+		}
+	}
+	for _, name := range splitList(disable) {
+		if !known[name] {
+			return fmt.Errorf("Cannot disable unknown template function '%s'", name)
+		}
+		tf.DisableTemplateFunction(name)
+	}
+	return nil
+}
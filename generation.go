@@ -0,0 +1,106 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+
+	yaml "gopkg.in/yaml.v2"
+)
+
+// generationManifestFileName is written to the root of the generated output with -generation-manifest.
+const generationManifestFileName = ".spiro-manifest.yaml"
+
+// templateRevision identifies the git revision of the template that produced the output. All fields are empty when
+// the template is not inside a git repository.
+type templateRevision struct {
+	Commit   string `yaml:"commit,omitempty"`
+	Tag      string `yaml:"tag,omitempty"`
+	Describe string `yaml:"describe,omitempty"`
+	Dirty    bool   `yaml:"dirty,omitempty"`
+}
+
+// findTemplateRevision asks git which commit the template is at, if any.
+func findTemplateRevision(inputTemplate string) templateRevision {
+	var rev templateRevision
+	dir := inputTemplate
+	if stat, err := os.Stat(inputTemplate); err == nil && !stat.IsDir() {
+		dir = filepath.Dir(inputTemplate)
+	}
+	commit, err := runGit(dir, "rev-parse", "HEAD")
+	if err != nil {
+		return rev
+	}
+	rev.Commit = commit
+	rev.Tag, _ = runGit(dir, "describe", "--tags", "--exact-match", "HEAD")
+	rev.Describe, _ = runGit(dir, "describe", "--tags", "--always", "HEAD")
+	// only changes to the template itself matter, not to the rest of the repository
+	if status, err := runGit(dir, "status", "--porcelain", "--", "."); err == nil && status != "" {
+		rev.Dirty = true
+	}
+	return rev
+}
+
+// lazyTemplateRevision returns a template function that looks up the template revision the first time it is used.
+func lazyTemplateRevision(inputTemplate string) func() templateRevision {
+	var rev *templateRevision
+	return func() templateRevision {
+		if rev == nil {
+			r := findTemplateRevision(inputTemplate)
+			rev = &r
+		}
+		return *rev
+	}
+}
+
+// generationManifest records how a project was generated so that it can later be traced back to (and regenerated
+// from) the exact template revision.
+type generationManifest struct {
+	SpiroVersion     string            `yaml:"spiro_version"`
+	Template         string            `yaml:"template"`
+	TemplateVersion  string            `yaml:"template_version,omitempty"`
+	TemplateRevision *templateRevision `yaml:"template_revision,omitempty"`
+	// Answers holds the answers given to 'ask' prompts, they are reused when the project is regenerated.
+	Answers map[string]string `yaml:"answers,omitempty"`
+}
+
+func newGenerationManifest(inputTemplate string, version string, rev templateRevision, answers map[string]string) *generationManifest {
+	m := &generationManifest{SpiroVersion: Version, Template: inputTemplate, TemplateVersion: version, Answers: answers}
+	if rev.Commit != "" {
+		m.TemplateRevision = &rev
+	}
+	return m
+}
+
+// writeGenerationManifest writes the manifest into the root of the generated output.
+func writeGenerationManifest(sink outputSink, root string, m *generationManifest) error {
+	content, err := yaml.Marshal(m)
+	if err != nil {
+		return err
+	}
+	content = append([]byte("# Generated by spiro, records the template this project was generated from\n"), content...)
+	file := path.Join(root, generationManifestFileName)
+	if err := sink.WriteFile(file, content); err != nil {
+		return fmt.Errorf("Error while writing generation manifest '%s': %s", file, err.Error())
+	}
+	return nil
+}
+
+// readGenerationManifest reads the manifest from the root of previously generated output, returning nil if there is
+// none.
+func readGenerationManifest(root string) (*generationManifest, error) {
+	file := path.Join(root, generationManifestFileName)
+	content, err := ioutil.ReadFile(file)
+	if os.IsNotExist(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("Could not read generation manifest '%s': %s", file, err.Error())
+	}
+	m := &generationManifest{}
+	if err := yaml.Unmarshal(content, m); err != nil {
+		return nil, fmt.Errorf("Could not parse generation manifest '%s': %s", file, err.Error())
+	}
+	return m, nil
+}
@@ -0,0 +1,200 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/AstromechZA/spiro/templatefactory"
+)
+
+const (
+	defaultGitInitMessage   = "Initial commit generated by spiro"
+	defaultGitBranchMessage = "Regenerate from template using spiro"
+)
+
+// runGit runs a git command inside the given directory and returns its trimmed stdout. The error includes whatever
+// git printed to stderr since that is usually the only useful information.
+func runGit(dir string, args ...string) (string, error) {
+	var stdout, stderr bytes.Buffer
+	cmd := exec.Command("git", args...)
+	cmd.Dir = dir
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		msg := strings.TrimSpace(stderr.String())
+		if msg == "" {
+			msg = err.Error()
+		}
+		return "", fmt.Errorf("git %s failed: %s", args[0], msg)
+	}
+	return strings.TrimSpace(stdout.String()), nil
+}
+
+// gitCommitAll stages everything in the repository at dir and commits it with the given message.
+func gitCommitAll(dir string, message string) error {
+	if _, err := runGit(dir, "add", "-A"); err != nil {
+		return err
+	}
+	_, err := runGit(dir, "commit", "-q", "-m", message)
+	return err
+}
+
+// gitInitAndCommit initializes a repository in dir (which is harmless if one already exists) and commits the
+// generated content.
+func gitInitAndCommit(dir string, message string) error {
+	if _, err := runGit(dir, "init", "-q"); err != nil {
+		return err
+	}
+	return gitCommitAll(dir, message)
+}
+
+// generatedRoot returns the root of the generated output. For directory templates this is the rendered top level
+// directory, for single file templates it is the output directory itself. An empty string is returned if the top
+// level directory is skipped.
+func generatedRoot(inputTemplate string, outputDirectory string, tf *templatefactory.TemplateFactory) (string, error) {
+	stat, err := os.Stat(inputTemplate)
+	if err != nil {
+		return "", fmt.Errorf("Error processing template %s: %s", inputTemplate, err.Error())
+	}
+	if !stat.IsDir() {
+		return outputDirectory, nil
+	}
+	name, err := renderName(inputTemplate, tf)
+	if err != nil || name == "" {
+		return "", err
+	}
+	return path.Join(outputDirectory, name), nil
+}
+
+// renderGitMessage renders the templated commit message, falling back to the given default when none was provided.
+func renderGitMessage(messageTemplate string, fallback string, tf *templatefactory.TemplateFactory) (string, error) {
+	if messageTemplate == "" {
+		return fallback, nil
+	}
+	message, err := tf.Render(messageTemplate)
+	if err != nil {
+		return "", fmt.Errorf("Error while rendering git commit message: %s", err.Error())
+	}
+	return message, nil
+}
+
+// gitInitOutput initializes a repository at the root of the generated output. For directory templates this is the
+// rendered top level directory, for single file templates it is the output directory itself.
+func gitInitOutput(inputTemplate string, outputDirectory string, messageTemplate string, tf *templatefactory.TemplateFactory) error {
+	gitDir, err := generatedRoot(inputTemplate, outputDirectory, tf)
+	if err != nil {
+		return err
+	}
+	if gitDir == "" {
+		logs.Infof("Skipping git init since nothing was generated")
+		return nil
+	}
+
+	message, err := renderGitMessage(messageTemplate, defaultGitInitMessage, tf)
+	if err != nil {
+		return err
+	}
+	if err := gitInitAndCommit(gitDir, message); err != nil {
+		return err
+	}
+	logs.Infof("Initialized git repository in '%s'", gitDir)
+	return nil
+}
+
+// gitPrepareBranch creates a new branch in the existing repository at the root of the generated output and returns the
+// directory that should be rendered into. Without a worktree path the branch is checked out in place, which requires
+// a clean working tree so that the regeneration changes are not mixed up with unrelated edits. With a worktree path,
+// the branch is checked out there instead and the existing checkout is not touched at all. When the generated output
+// is a subdirectory of a larger repository, it is rendered into the same subdirectory of the worktree.
+func gitPrepareBranch(inputTemplate string, outputDirectory string, branch string, worktree string, tf *templatefactory.TemplateFactory) (string, error) {
+	gitDir, err := generatedRoot(inputTemplate, outputDirectory, tf)
+	if err != nil {
+		return "", err
+	}
+	if gitDir == "" {
+		return "", fmt.Errorf("Cannot use -git-branch since the template name evaluated to ''")
+	}
+	toplevel, err := runGit(gitDir, "rev-parse", "--show-toplevel")
+	if err != nil {
+		return "", fmt.Errorf("The -git-branch flag requires '%s' to be an existing git repository: %s", gitDir, err.Error())
+	}
+	subdir, err := repositorySubdir(toplevel, gitDir)
+	if err != nil {
+		return "", err
+	}
+
+	if worktree != "" {
+		// git runs inside gitDir so relative worktree paths need resolving against our own working directory first
+		absWorktree, err := filepath.Abs(worktree)
+		if err != nil {
+			return "", err
+		}
+		if _, err := runGit(gitDir, "worktree", "add", "-q", "-b", branch, absWorktree); err != nil {
+			return "", err
+		}
+		logs.Infof("Created worktree '%s' on new branch '%s'", worktree, branch)
+		if subdir != "." {
+			logs.Infof("Rendering into '%s' of the worktree, the path of '%s' in the repository", subdir, gitDir)
+		}
+		return filepath.Join(worktree, subdir), nil
+	}
+
+	status, err := runGit(gitDir, "status", "--porcelain")
+	if err != nil {
+		return "", err
+	}
+	if status != "" {
+		return "", fmt.Errorf("The git repository at '%s' has uncommitted changes, commit or stash them first", gitDir)
+	}
+	if _, err := runGit(gitDir, "checkout", "-q", "-b", branch); err != nil {
+		return "", err
+	}
+	logs.Infof("Switched '%s' to new branch '%s'", gitDir, branch)
+	return gitDir, nil
+}
+
+// repositorySubdir returns the path of dir relative to the toplevel of the git repository it is in, "." at its root.
+// git reports the toplevel with symlinks resolved, so dir is resolved too before comparing them.
+func repositorySubdir(toplevel string, dir string) (string, error) {
+	absDir, err := filepath.Abs(dir)
+	if err != nil {
+		return "", err
+	}
+	if resolved, err := filepath.EvalSymlinks(absDir); err == nil {
+		absDir = resolved
+	}
+	if resolved, err := filepath.EvalSymlinks(toplevel); err == nil {
+		toplevel = resolved
+	}
+	rel, err := filepath.Rel(toplevel, absDir)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return "", fmt.Errorf("Cannot tell where '%s' is in the git repository at '%s'", dir, toplevel)
+	}
+	return rel, nil
+}
+
+// gitCommitBranch commits the regenerated content onto the branch created by gitPrepareBranch.
+func gitCommitBranch(gitDir string, branch string, messageTemplate string, tf *templatefactory.TemplateFactory) error {
+	status, err := runGit(gitDir, "status", "--porcelain")
+	if err != nil {
+		return err
+	}
+	if status == "" {
+		logs.Infof("Nothing changed, branch '%s' has no new commit", branch)
+		return nil
+	}
+	message, err := renderGitMessage(messageTemplate, defaultGitBranchMessage, tf)
+	if err != nil {
+		return err
+	}
+	if err := gitCommitAll(gitDir, message); err != nil {
+		return err
+	}
+	logs.Infof("Committed changes to branch '%s', push it with 'git push -u origin %s'", branch, branch)
+	return nil
+}
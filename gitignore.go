@@ -0,0 +1,58 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// gitignoreAliases maps common alternative names onto the template names in gitignoreTexts.
+var gitignoreAliases = map[string]string{
+	"golang":   "Go",
+	"nodejs":   "Node",
+	"osx":      "macOS",
+	"vscode":   "VisualStudioCode",
+	"intellij": "JetBrains",
+	"cpp":      "C++",
+}
+
+// Gitignore merges the named gitignore templates into a single file, eg: gitignore "Go" "macOS". Each template gets
+// its own section header and is written verbatim: the last matching pattern wins, so dropping a repeated pattern could
+// let a negation between the two copies re-include what the second one excludes.
+func Gitignore(names ...string) (string, error) {
+	var buf bytes.Buffer
+	for i, name := range names {
+		key, text, ok := findGitignore(name)
+		if !ok {
+			return "", fmt.Errorf("unknown template '%s', supported templates are %s", name, strings.Join(gitignoreNames(), ", "))
+		}
+		if i > 0 {
+			buf.WriteString("\n")
+		}
+		fmt.Fprintf(&buf, "### %s ###\n", key)
+		buf.WriteString(text)
+	}
+	return buf.String(), nil
+}
+
+func findGitignore(name string) (string, string, bool) {
+	if alias, ok := gitignoreAliases[strings.ToLower(name)]; ok {
+		name = alias
+	}
+	for key, text := range gitignoreTexts {
+		if strings.EqualFold(key, name) {
+			return key, text, true
+		}
+	}
+	return "", "", false
+}
+
+func gitignoreNames() []string {
+	names := make([]string, 0, len(gitignoreTexts))
+	for name := range gitignoreTexts {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
@@ -0,0 +1,142 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+	"unicode"
+)
+
+var goKeywords = map[string]bool{
+	"break": true, "case": true, "chan": true, "const": true, "continue": true, "default": true, "defer": true,
+	"else": true, "fallthrough": true, "for": true, "func": true, "go": true, "goto": true, "if": true,
+	"import": true, "interface": true, "map": true, "package": true, "range": true, "return": true, "select": true,
+	"struct": true, "switch": true, "type": true, "var": true,
+}
+
+// GoModulePath joins the given parts into a conventional module path, eg: goModulePath "github.com" "My Org"
+// "Cool_Service" -> "github.com/my-org/cool-service". Each part is lower cased, runs of whitespace and underscores
+// become dashes and any characters that are not allowed in module paths are dropped.
+func GoModulePath(parts ...string) (string, error) {
+	var elements []string
+	for _, part := range parts {
+		for _, element := range strings.Split(part, "/") {
+			var b bytes.Buffer
+			for _, r := range strings.ToLower(strings.TrimSpace(element)) {
+				switch {
+				case r >= 'a' && r <= 'z', r >= '0' && r <= '9', r == '.', r == '-', r == '~':
+					b.WriteRune(r)
+				case r == '_' || unicode.IsSpace(r):
+					b.WriteRune('-')
+				}
+			}
+			cleaned := strings.Trim(b.String(), "-.")
+			for strings.Contains(cleaned, "--") {
+				cleaned = strings.Replace(cleaned, "--", "-", -1)
+			}
+			if cleaned != "" {
+				elements = append(elements, cleaned)
+			}
+		}
+	}
+	if len(elements) == 0 {
+		return "", fmt.Errorf("no valid path elements in %q", parts)
+	}
+	return strings.Join(elements, "/"), nil
+}
+
+// GoIdent converts a string into a valid Go identifier in mixedCaps form, eg: "my-cool service" -> "myCoolService".
+// Identifiers that would start with a digit are prefixed with an underscore and keywords get a trailing underscore.
+func GoIdent(in string) string {
+	words := strings.FieldsFunc(in, func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+	var b bytes.Buffer
+	for i, word := range words {
+		if i == 0 {
+			b.WriteString(word)
+			continue
+		}
+		runes := []rune(word)
+		b.WriteString(string(unicode.ToUpper(runes[0])) + string(runes[1:]))
+	}
+	out := b.String()
+	if out == "" {
+		return "_"
+	}
+	if unicode.IsDigit([]rune(out)[0]) {
+		out = "_" + out
+	}
+	if goKeywords[out] {
+		out += "_"
+	}
+	return out
+}
+
+// escapeModulePath applies the module proxy case encoding: upper case letters become '!' followed by the lower case
+// letter.
+func escapeModulePath(module string) string {
+	var b bytes.Buffer
+	for _, r := range module {
+		if unicode.IsUpper(r) {
+			b.WriteRune('!')
+			r = unicode.ToLower(r)
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+// goProxyURL returns the first usable proxy listed in $GOPROXY, falling back to the public module proxy.
+func goProxyURL() (string, error) {
+	proxies := os.Getenv("GOPROXY")
+	if proxies == "" {
+		return "https://proxy.golang.org", nil
+	}
+	for _, proxy := range strings.FieldsFunc(proxies, func(r rune) bool { return r == ',' || r == '|' }) {
+		switch proxy {
+		case "off":
+			return "", fmt.Errorf("module lookups are disabled by GOPROXY=off")
+		case "direct":
+			continue
+		}
+		return strings.TrimSuffix(proxy, "/"), nil
+	}
+	return "", fmt.Errorf("GOPROXY '%s' does not list a module proxy", proxies)
+}
+
+// GoLatestVersion returns a template function that looks up the latest version of a module from the module proxy.
+// Network access must be explicitly allowed since it makes rendering depend on the outside world.
+func GoLatestVersion(allowNetwork bool) func(string) (string, error) {
+	return func(module string) (string, error) {
+		if offline {
+			return "", fmt.Errorf("network access is required but spiro is running with -offline")
+		} else if !allowNetwork {
+			return "", fmt.Errorf("network access is required, use -allow-network to enable it")
+		}
+		proxy, err := goProxyURL()
+		if err != nil {
+			return "", err
+		}
+		client := &http.Client{Timeout: 15 * time.Second}
+		resp, err := client.Get(proxy + "/" + escapeModulePath(module) + "/@latest")
+		if err != nil {
+			return "", err
+		}
+		defer resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			return "", fmt.Errorf("lookup of '%s' failed with status %s", module, resp.Status)
+		}
+		var info struct {
+			Version string
+		}
+		if err := json.NewDecoder(resp.Body).Decode(&info); err != nil {
+			return "", fmt.Errorf("could not parse response for '%s': %s", module, err.Error())
+		}
+		return info.Version, nil
+	}
+}
@@ -0,0 +1,105 @@
+package main
+
+import (
+	"fmt"
+	"path"
+	"strings"
+
+	"github.com/AstromechZA/spiro/templatefactory"
+)
+
+// headerConfig configures the "generated file" header added to the top of rendered files.
+type headerConfig struct {
+	// Text is templated, it defaults to a "Code generated ... DO NOT EDIT." line naming the template.
+	Text string `yaml:"text"`
+	// Files limits the header to paths matching the gitignore style patterns, relative to the root of the output.
+	Files []string `yaml:"files"`
+}
+
+// commentStyle is how a line comment is written in a type of file.
+type commentStyle struct {
+	prefix string
+	suffix string
+}
+
+var (
+	slashComments = commentStyle{prefix: "// "}
+	hashComments  = commentStyle{prefix: "# "}
+	dashComments  = commentStyle{prefix: "-- "}
+	xmlComments   = commentStyle{prefix: "<!-- ", suffix: " -->"}
+	blockComments = commentStyle{prefix: "/* ", suffix: " */"}
+)
+
+// commentStyles maps lower case file extensions (or whole names for files without one) to their comment syntax. Files
+// whose syntax has no comments, such as JSON, are not listed and never get a header.
+var commentStyles = map[string]commentStyle{
+	".go": slashComments, ".c": slashComments, ".h": slashComments, ".cc": slashComments, ".cpp": slashComments,
+	".hpp": slashComments, ".cs": slashComments, ".java": slashComments, ".kt": slashComments, ".scala": slashComments,
+	".js": slashComments, ".jsx": slashComments, ".ts": slashComments, ".tsx": slashComments, ".rs": slashComments,
+	".swift": slashComments, ".dart": slashComments, ".proto": slashComments, ".groovy": slashComments,
+	".gradle": slashComments, ".php": slashComments,
+
+	".py": hashComments, ".sh": hashComments, ".bash": hashComments, ".zsh": hashComments, ".rb": hashComments,
+	".pl": hashComments, ".yaml": hashComments, ".yml": hashComments, ".toml": hashComments, ".tf": hashComments,
+	".hcl": hashComments, ".cfg": hashComments, ".conf": hashComments, ".ini": hashComments, ".r": hashComments,
+	".ps1": hashComments, ".mk": hashComments, ".cmake": hashComments, ".gitignore": hashComments,
+	".dockerignore": hashComments, "makefile": hashComments, "dockerfile": hashComments, ".env": hashComments,
+
+	".sql": dashComments, ".lua": dashComments, ".hs": dashComments,
+
+	".html": xmlComments, ".htm": xmlComments, ".xml": xmlComments, ".svg": xmlComments, ".md": xmlComments,
+	".vue": xmlComments,
+
+	".css": blockComments, ".scss": blockComments, ".less": blockComments,
+}
+
+// commentStyleFor returns the comment syntax for the file, if it is known.
+func commentStyleFor(file string) (commentStyle, bool) {
+	base := strings.ToLower(path.Base(file))
+	if style, ok := commentStyles[base]; ok {
+		return style, true
+	}
+	style, ok := commentStyles[path.Ext(base)]
+	return style, ok
+}
+
+// defaultHeaderText follows the Go convention for generated files, which many other tools recognize as well.
+func defaultHeaderText(inputTemplate string, version string) string {
+	source := path.Base(inputTemplate)
+	if version != "" {
+		source += "@" + version
+	}
+	return "Code generated by spiro from " + source + ". DO NOT EDIT."
+}
+
+// addHeader prepends the text to the content as comments in the syntax of the file. Files of unknown types are
+// returned unchanged. Shebang lines and XML declarations stay at the top since they must come first.
+func addHeader(file string, content string, text string) string {
+	style, ok := commentStyleFor(file)
+	if !ok || text == "" {
+		return content
+	}
+	var header string
+	for _, line := range strings.Split(strings.TrimRight(text, "\n"), "\n") {
+		header += strings.TrimRight(style.prefix+line, " ") + style.suffix + "\n"
+	}
+	if strings.HasPrefix(content, "#!") || strings.HasPrefix(content, "<?xml") {
+		if i := strings.Index(content, "\n"); i >= 0 {
+			return content[:i+1] + header + content[i+1:]
+		}
+		return content + "\n" + header
+	}
+	return header + content
+}
+
+// render returns the header text for the current spec.
+func (h *headerConfig) render(tf *templatefactory.TemplateFactory, inputTemplate string, version string) (string, error) {
+	if h.Text == "" {
+		return defaultHeaderText(inputTemplate, version), nil
+	}
+	text, err := tf.Render(h.Text)
+	if err != nil {
+		return "", fmt.Errorf("Error while rendering the generated file header: %s", err.Error())
+	}
+	return text, nil
+}
@@ -0,0 +1,42 @@
+package main
+
+import (
+	"path/filepath"
+	"strings"
+
+	yaml "gopkg.in/yaml.v2"
+)
+
+// helmContext wraps the spec the same way Helm presents values to chart templates, so that snippets copied from a
+// chart can be used unmodified. The spec itself is available as .Values and the release and chart metadata are
+// filled in with sensible values since there is no real release.
+func helmContext(spec map[string]interface{}, inputTemplate string, releaseName string, namespace string) map[string]interface{} {
+	chartName := strings.TrimSuffix(filepath.Base(inputTemplate), ".templated")
+	if releaseName == "" {
+		releaseName = chartName
+	}
+	return map[string]interface{}{
+		"Values": spec,
+		"Release": map[string]interface{}{
+			"Name":      releaseName,
+			"Namespace": namespace,
+			"Service":   "Spiro",
+			"IsInstall": true,
+			"IsUpgrade": false,
+			"Revision":  1,
+		},
+		"Chart": map[string]interface{}{
+			"Name":    chartName,
+			"Version": "0.0.0",
+		},
+	}
+}
+
+// ToYaml serializes a value as YAML in the same way as Helm's toYaml function (without the trailing newline).
+func ToYaml(in interface{}) (string, error) {
+	out, err := yaml.Marshal(in)
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSuffix(string(out), "\n"), nil
+}
@@ -0,0 +1,157 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/AstromechZA/spiro/engine"
+)
+
+// hooksDirName is the directory at the root of a directory template that holds hook scripts. Like the manifest, it is
+// never copied to the output when the manifest declares hooks.
+const hooksDirName = engine.HooksDirName
+
+// templateHooks are shell commands from the manifest that run before and after the template is rendered.
+type templateHooks struct {
+	PreGen  []string `yaml:"pre_gen"`
+	PostGen []string `yaml:"post_gen"`
+}
+
+// hook is a single command to run: either a shell command from the manifest or an executable script in the hooks
+// directory.
+type hook struct {
+	name string
+	cmd  *exec.Cmd
+}
+
+// templateHookCommands returns the hooks for the given stage ("pre_gen" or "post_gen"): the script in the hooks
+// directory whose name without extension is the stage (eg: hooks/post_gen.sh), followed by the manifest commands.
+// Templates only have hooks when their manifest has a hooks section, otherwise the hooks directory is part of the
+// output like any other directory.
+func templateHookCommands(inputTemplate string, manifest *templateManifest, stage string) ([]hook, error) {
+	var hooks []hook
+	if stat, err := os.Stat(inputTemplate); err != nil || !stat.IsDir() || manifest.Hooks == nil {
+		// single file templates have no hooks
+		return nil, nil
+	}
+	hooksDir := filepath.Join(inputTemplate, hooksDirName)
+	if items, err := ioutil.ReadDir(hooksDir); err == nil {
+		for _, item := range items {
+			name := item.Name()
+			if item.IsDir() || strings.TrimSuffix(name, filepath.Ext(name)) != stage {
+				continue
+			}
+			script, err := filepath.Abs(filepath.Join(hooksDir, name))
+			if err != nil {
+				return nil, err
+			}
+			hooks = append(hooks, hook{name: filepath.Join(hooksDirName, name), cmd: exec.Command(script)})
+		}
+	} else if !os.IsNotExist(err) {
+		return nil, fmt.Errorf("Error while reading '%s': %s", hooksDir, err.Error())
+	}
+	commands := manifest.Hooks.PreGen
+	if stage == "post_gen" {
+		commands = manifest.Hooks.PostGen
+	}
+	for _, command := range commands {
+		hooks = append(hooks, hook{name: command, cmd: exec.Command("sh", "-c", command)})
+	}
+	return hooks, nil
+}
+
+// warnUndeclaredHooks warns about hook scripts in a template whose manifest has no hooks section, which are rendered
+// into the output rather than run.
+func warnUndeclaredHooks(inputTemplate string, manifest *templateManifest) {
+	if manifest.Hooks != nil {
+		return
+	}
+	items, err := ioutil.ReadDir(filepath.Join(inputTemplate, hooksDirName))
+	if err != nil {
+		return
+	}
+	for _, item := range items {
+		stage := strings.TrimSuffix(item.Name(), filepath.Ext(item.Name()))
+		if !item.IsDir() && (stage == "pre_gen" || stage == "post_gen") {
+			logs.Warnf("'%s' is not run and is rendered like any other file, since %s has no hooks section (add 'hooks: {}' to run it)", filepath.Join(inputTemplate, hooksDirName, item.Name()), manifestFileName)
+		}
+	}
+}
+
+// hookEnv returns the environment for hooks: the current environment plus SPIRO_TEMPLATE, SPIRO_OUTPUT,
+// SPIRO_SPEC_FILE (a file holding the spec as JSON) and a SPIRO_VAR_<NAME> variable for every top level spec value
+// that is not a map or list. Sensitive values are left out, since the environment is passed on to every child process
+// and can be read from /proc; hooks read them from the spec file instead.
+func hookEnv(inputTemplate string, dir string, spec map[string]interface{}, specFile string, sensitive []string) []string {
+	env := append(os.Environ(), "SPIRO_TEMPLATE="+inputTemplate, "SPIRO_OUTPUT="+dir, "SPIRO_SPEC_FILE="+specFile)
+	hidden := make(map[string]bool, len(sensitive))
+	for _, key := range sensitive {
+		hidden[key] = true
+	}
+	keys := make([]string, 0, len(spec))
+	for key := range spec {
+		if !hidden[key] {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		switch spec[key].(type) {
+		case map[string]interface{}, []interface{}, nil:
+			continue
+		}
+		name := strings.ToUpper(strings.Map(func(r rune) rune {
+			if (r >= 'a' && r <= 'z') || (r >= 'A' && r <= 'Z') || (r >= '0' && r <= '9') {
+				return r
+			}
+			return '_'
+		}, key))
+		env = append(env, fmt.Sprintf("SPIRO_VAR_%s=%v", name, spec[key]))
+	}
+	return env
+}
+
+// runTemplateHooks runs the hooks of a stage in dir. Every hook receives the spec as JSON on stdin and in a file named
+// by its environment, which is removed once the hooks have run. A hook that exits with an error aborts generation.
+func runTemplateHooks(inputTemplate string, manifest *templateManifest, stage string, dir string, spec map[string]interface{}, sensitive []string) error {
+	hooks, err := templateHookCommands(inputTemplate, manifest, stage)
+	if err != nil || len(hooks) == 0 {
+		return err
+	}
+	specJSON, err := Jsonify(spec)
+	if err != nil {
+		return fmt.Errorf("Error while encoding the spec for the %s hooks: %s", stage, err.Error())
+	}
+	// the spec may hold secrets, the temporary file is only readable by the current user
+	specFile, err := ioutil.TempFile("", "spiro-spec-*.json")
+	if err != nil {
+		return fmt.Errorf("Error while writing the spec for the %s hooks: %s", stage, err.Error())
+	}
+	defer os.Remove(specFile.Name())
+	_, err = specFile.WriteString(specJSON)
+	if cerr := specFile.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return fmt.Errorf("Error while writing the spec for the %s hooks: %s", stage, err.Error())
+	}
+	env := hookEnv(inputTemplate, dir, spec, specFile.Name(), sensitive)
+	for _, h := range hooks {
+		h.cmd.Dir = dir
+		h.cmd.Env = env
+		h.cmd.Stdin = bytes.NewBufferString(specJSON)
+		// hook output is part of the log, stdout is kept for spiro's own output
+		h.cmd.Stdout = os.Stderr
+		h.cmd.Stderr = os.Stderr
+		if err := h.cmd.Run(); err != nil {
+			return fmt.Errorf("Error while running the %s hook '%s': %s", stage, h.name, err.Error())
+		}
+	}
+	return nil
+}
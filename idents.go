@@ -0,0 +1,133 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"unicode"
+)
+
+// identLanguage describes how identifiers are written in a target language.
+type identLanguage struct {
+	// camel produces mixedCaps (or PascalCase for types), otherwise words are joined with underscores
+	camel bool
+	// asciiOnly drops any letters and digits outside of ASCII
+	asciiOnly bool
+	reserved  map[string]bool
+}
+
+func wordSet(words ...string) map[string]bool {
+	set := make(map[string]bool, len(words))
+	for _, w := range words {
+		set[w] = true
+	}
+	return set
+}
+
+var identLanguages = map[string]identLanguage{
+	"go": {camel: true, reserved: goKeywords},
+	"python": {reserved: wordSet(
+		"False", "None", "True", "and", "as", "assert", "async", "await", "break", "class", "continue", "def", "del",
+		"elif", "else", "except", "finally", "for", "from", "global", "if", "import", "in", "is", "lambda", "nonlocal",
+		"not", "or", "pass", "raise", "return", "try", "while", "with", "yield",
+	)},
+	"js": {camel: true, reserved: wordSet(
+		"await", "break", "case", "catch", "class", "const", "continue", "debugger", "default", "delete", "do", "else",
+		"enum", "export", "extends", "false", "finally", "for", "function", "if", "implements", "import", "in",
+		"instanceof", "interface", "let", "new", "null", "package", "private", "protected", "public", "return",
+		"static", "super", "switch", "this", "throw", "true", "try", "typeof", "var", "void", "while", "with", "yield",
+	)},
+	"sql": {asciiOnly: true, reserved: wordSet(
+		"add", "all", "alter", "and", "as", "asc", "between", "by", "case", "check", "column", "constraint", "create",
+		"cross", "default", "delete", "desc", "distinct", "drop", "else", "end", "exists", "foreign", "from", "full",
+		"grant", "group", "having", "in", "index", "inner", "insert", "into", "is", "join", "key", "left", "like",
+		"limit", "not", "null", "offset", "on", "or", "order", "outer", "primary", "references", "revoke", "right",
+		"select", "set", "table", "then", "to", "union", "unique", "update", "user", "using", "values", "view", "when",
+		"where", "with",
+	)},
+}
+
+// identWords splits a string into words at any character that is not a letter or digit and at case changes, so that
+// "myHTTPServer-v2" becomes "my", "HTTP", "Server" and "v2". With asciiOnly other letters and digits are dropped.
+func identWords(in string, asciiOnly bool) []string {
+	var words []string
+	var current []rune
+	flush := func() {
+		if len(current) > 0 {
+			words = append(words, string(current))
+			current = nil
+		}
+	}
+	runes := []rune(in)
+	for i, r := range runes {
+		if !unicode.IsLetter(r) && !unicode.IsDigit(r) {
+			flush()
+			continue
+		}
+		if asciiOnly && r > unicode.MaxASCII {
+			continue
+		}
+		if n := len(current); n > 0 && unicode.IsUpper(r) {
+			nextLower := i+1 < len(runes) && unicode.IsLower(runes[i+1])
+			if unicode.IsLower(current[n-1]) || (unicode.IsUpper(current[n-1]) && nextLower) {
+				flush()
+			}
+		}
+		current = append(current, r)
+	}
+	flush()
+	return words
+}
+
+// makeIdent converts a string into an identifier for the language. Exported makes the first word upper case too, as
+// for type names. Identifiers that would start with a digit are prefixed with an underscore and reserved words get a
+// trailing underscore.
+func makeIdent(language string, in string, exported bool) (string, error) {
+	lang, ok := identLanguages[strings.ToLower(language)]
+	if !ok {
+		return "", fmt.Errorf("unknown language '%s' (supported: go, js, python, sql)", language)
+	}
+	var b bytes.Buffer
+	for i, word := range identWords(in, lang.asciiOnly) {
+		runes := []rune(word)
+		switch {
+		case lang.camel && (i > 0 || exported):
+			b.WriteString(string(unicode.ToUpper(runes[0])) + string(runes[1:]))
+		case lang.camel:
+			b.WriteString(strings.ToLower(word))
+		case exported:
+			b.WriteString(string(unicode.ToUpper(runes[0])) + strings.ToLower(string(runes[1:])))
+		default:
+			if i > 0 {
+				b.WriteRune('_')
+			}
+			b.WriteString(strings.ToLower(word))
+		}
+	}
+	out := b.String()
+	if out == "" {
+		return "_", nil
+	}
+	if unicode.IsDigit([]rune(out)[0]) {
+		out = "_" + out
+	}
+	if lang.reserved[out] {
+		out += "_"
+	}
+	return out, nil
+}
+
+// Ident converts a string into a variable style identifier for the language: mixedCaps for go and js, snake_case for
+// python and sql.
+func Ident(language string, in string) (string, error) {
+	return makeIdent(language, in, false)
+}
+
+// TypeIdent converts a string into a type style identifier for the language: PascalCase for go, js and python and
+// snake_case for sql.
+func TypeIdent(language string, in string) (string, error) {
+	if strings.ToLower(language) == "sql" {
+		return makeIdent(language, in, false)
+	}
+	return makeIdent(language, in, true)
+}
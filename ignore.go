@@ -0,0 +1,159 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"regexp"
+	"strings"
+)
+
+// ignoreFileName is the name of the optional file at the root of a directory template listing gitignore style patterns
+// for template paths that are never copied to the output. Like the manifest, it is never copied itself.
+const ignoreFileName = ".spiroignore"
+
+// readIgnoreFile returns the patterns in an ignore file, skipping blank lines and '#' comments. A missing file has no
+// patterns.
+func readIgnoreFile(ignoreFile string) ([]string, error) {
+	content, err := ioutil.ReadFile(ignoreFile)
+	if os.IsNotExist(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("Could not read ignore file '%s': %s", ignoreFile, err.Error())
+	}
+	var patterns []string
+	for _, line := range strings.Split(string(content), "\n") {
+		line = strings.TrimRight(line, " \t\r")
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		// like gitignore, a backslash escapes a leading '#'
+		if strings.HasPrefix(line, "\\#") {
+			line = line[1:]
+		}
+		patterns = append(patterns, line)
+	}
+	if _, err := newIgnoreRules(patterns); err != nil {
+		return nil, fmt.Errorf("Invalid ignore file '%s': %s", ignoreFile, err.Error())
+	}
+	return patterns, nil
+}
+
+// ignoreRule is a single gitignore style pattern.
+type ignoreRule struct {
+	source  string
+	pattern *regexp.Regexp
+	negate  bool
+	dirOnly bool
+}
+
+// ignoreRules decides which parts of a template tree are skipped. Patterns follow gitignore conventions: a leading
+// '!' re-includes a path excluded by an earlier pattern, a trailing '/' only matches directories, patterns containing
+// a '/' are matched against the full path relative to the template root while other patterns match the name at any
+// depth, and '**' matches any number of directories. The last matching pattern wins.
+type ignoreRules struct {
+	rules []ignoreRule
+}
+
+func newIgnoreRules(patterns []string) (*ignoreRules, error) {
+	r := &ignoreRules{}
+	for _, pattern := range patterns {
+		if err := r.add(pattern); err != nil {
+			return nil, err
+		}
+	}
+	return r, nil
+}
+
+func (r *ignoreRules) add(pattern string) error {
+	rule := ignoreRule{source: pattern}
+	if strings.HasPrefix(pattern, "!") {
+		rule.negate = true
+		pattern = pattern[1:]
+	}
+	if strings.HasSuffix(pattern, "/") {
+		rule.dirOnly = true
+		pattern = strings.TrimRight(pattern, "/")
+	}
+	if pattern == "" {
+		return fmt.Errorf("Invalid ignore pattern '%s'", rule.source)
+	}
+	re, err := globToRegexp(pattern)
+	if err != nil {
+		return fmt.Errorf("Invalid ignore pattern '%s': %s", rule.source, err.Error())
+	}
+	rule.pattern = re
+	r.rules = append(r.rules, rule)
+	return nil
+}
+
+// Ignored reports whether the path (relative to the template root, using forward slashes) should be skipped.
+func (r *ignoreRules) Ignored(rel string, isDir bool) bool {
+	if r == nil {
+		return false
+	}
+	ignored := false
+	for _, rule := range r.rules {
+		if rule.dirOnly && !isDir {
+			continue
+		}
+		if rule.pattern.MatchString(rel) {
+			ignored = !rule.negate
+		}
+	}
+	return ignored
+}
+
+// globToRegexp converts a gitignore style glob into an anchored regular expression over slash separated paths.
+func globToRegexp(glob string) (*regexp.Regexp, error) {
+	anchored := strings.Contains(glob, "/")
+	glob = strings.TrimPrefix(glob, "/")
+
+	var b bytes.Buffer
+	b.WriteString("^")
+	if !anchored {
+		b.WriteString("(?:.*/)?")
+	}
+	for i := 0; i < len(glob); i++ {
+		c := glob[i]
+		switch c {
+		case '*':
+			if i+1 < len(glob) && glob[i+1] == '*' {
+				if i+2 < len(glob) && glob[i+2] == '/' {
+					// '**/' matches zero or more directories
+					b.WriteString("(?:.*/)?")
+					i += 2
+				} else {
+					b.WriteString(".*")
+					i++
+				}
+			} else {
+				b.WriteString("[^/]*")
+			}
+		case '?':
+			b.WriteString("[^/]")
+		case '[':
+			end := strings.IndexByte(glob[i+1:], ']')
+			if end < 0 {
+				b.WriteString(regexp.QuoteMeta("["))
+				continue
+			}
+			class := glob[i+1 : i+1+end]
+			if strings.HasPrefix(class, "!") {
+				class = "^" + class[1:]
+			}
+			b.WriteString("[" + strings.Replace(class, `\`, `\\`, -1) + "]")
+			i += end + 1
+		case '\\':
+			if i+1 < len(glob) {
+				i++
+				b.WriteString(regexp.QuoteMeta(string(glob[i])))
+			}
+		default:
+			b.WriteString(regexp.QuoteMeta(string(c)))
+		}
+	}
+	b.WriteString("$")
+	return regexp.Compile(b.String())
+}
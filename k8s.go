@@ -0,0 +1,230 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	yaml "gopkg.in/yaml.v2"
+
+	"github.com/AstromechZA/spiro/schema"
+)
+
+// k8sSchemas finds the schema for a Kubernetes resource from a directory of schemas. The directory may contain JSON
+// schemas named using the kubernetes-json-schema conventions ('deployment-apps-v1.json', 'service-v1.json'), the CRD
+// catalog convention ('cert-manager.io/certificate_v1.json'), or CustomResourceDefinition manifests whose embedded
+// openAPIV3Schema is used directly.
+type k8sSchemas struct {
+	dir    string
+	crds   map[string]*schema.Schema
+	loaded map[string]*schema.Schema
+}
+
+func isYAMLFile(file string) bool {
+	ext := strings.ToLower(filepath.Ext(file))
+	return ext == ".yaml" || ext == ".yml"
+}
+
+func newK8sSchemas(dir string) (*k8sSchemas, error) {
+	stat, err := os.Stat(dir)
+	if err != nil {
+		return nil, fmt.Errorf("Kubernetes schema directory '%s' cannot be read! (%s)", dir, err.Error())
+	} else if !stat.IsDir() {
+		return nil, fmt.Errorf("Kubernetes schema directory '%s' is not a directory!", dir)
+	}
+	k := &k8sSchemas{dir: dir, crds: make(map[string]*schema.Schema), loaded: make(map[string]*schema.Schema)}
+	err = filepath.Walk(dir, func(p string, info os.FileInfo, err error) error {
+		if err != nil || info.IsDir() || !isYAMLFile(p) {
+			return err
+		}
+		return k.indexCRDs(p)
+	})
+	return k, err
+}
+
+func k8sKey(group, version, kind string) string {
+	return strings.ToLower(group + "/" + version + "/" + kind)
+}
+
+// indexCRDs records the schemas of any CustomResourceDefinitions found in the file.
+func (k *k8sSchemas) indexCRDs(file string) error {
+	content, err := ioutil.ReadFile(file)
+	if err != nil {
+		return fmt.Errorf("Could not read '%s': %s", file, err.Error())
+	}
+	docs, err := decodeYAMLDocuments(content)
+	if err != nil {
+		return fmt.Errorf("Could not parse '%s': %s", file, err.Error())
+	}
+	for _, raw := range docs {
+		doc, _ := schema.Normalize(raw).(map[string]interface{})
+		if doc == nil || doc["kind"] != "CustomResourceDefinition" {
+			continue
+		}
+		spec, _ := doc["spec"].(map[string]interface{})
+		names, _ := spec["names"].(map[string]interface{})
+		group, _ := spec["group"].(string)
+		kind, _ := names["kind"].(string)
+
+		// apiextensions.k8s.io/v1 has a schema per version, v1beta1 may instead have a single top level schema
+		var common interface{}
+		if validation, ok := spec["validation"].(map[string]interface{}); ok {
+			common = validation["openAPIV3Schema"]
+		}
+		if version, ok := spec["version"].(string); ok && common != nil {
+			k.crds[k8sKey(group, version, kind)] = schema.New(common)
+		}
+		versions, _ := spec["versions"].([]interface{})
+		for _, item := range versions {
+			version, _ := item.(map[string]interface{})
+			name, _ := version["name"].(string)
+			openAPI := common
+			if s, ok := version["schema"].(map[string]interface{}); ok && s["openAPIV3Schema"] != nil {
+				openAPI = s["openAPIV3Schema"]
+			}
+			if openAPI != nil {
+				k.crds[k8sKey(group, name, kind)] = schema.New(openAPI)
+			}
+		}
+	}
+	return nil
+}
+
+// schemaFor returns the schema for the given apiVersion and kind or nil if there is none.
+func (k *k8sSchemas) schemaFor(apiVersion, kind string) (*schema.Schema, error) {
+	group, version := "", apiVersion
+	if i := strings.LastIndex(apiVersion, "/"); i >= 0 {
+		group, version = apiVersion[:i], apiVersion[i+1:]
+	}
+	if s, ok := k.crds[k8sKey(group, version, kind)]; ok {
+		return s, nil
+	}
+
+	lowerKind := strings.ToLower(kind)
+	var candidates []string
+	if group == "" {
+		candidates = append(candidates, fmt.Sprintf("%s-%s.json", lowerKind, version))
+	} else {
+		candidates = append(candidates,
+			fmt.Sprintf("%s-%s-%s.json", lowerKind, strings.Split(group, ".")[0], version),
+			fmt.Sprintf("%s-%s-%s.json", lowerKind, strings.Replace(group, ".", "-", -1), version),
+			filepath.Join(group, fmt.Sprintf("%s_%s.json", lowerKind, version)),
+		)
+	}
+	candidates = append(candidates, lowerKind+".json")
+
+	for _, candidate := range candidates {
+		p := filepath.Join(k.dir, candidate)
+		if s, ok := k.loaded[p]; ok {
+			return s, nil
+		}
+		if _, err := os.Stat(p); err != nil {
+			continue
+		}
+		s, err := schema.Load(p)
+		if err != nil {
+			return nil, err
+		}
+		k.loaded[p] = s
+		return s, nil
+	}
+	return nil, nil
+}
+
+// decodeYAMLDocuments decodes every document in a (possibly multi-document) YAML stream.
+func decodeYAMLDocuments(content []byte) ([]interface{}, error) {
+	var docs []interface{}
+	dec := yaml.NewDecoder(bytes.NewReader(content))
+	for {
+		var doc interface{}
+		if err := dec.Decode(&doc); err == io.EOF {
+			return docs, nil
+		} else if err != nil {
+			return nil, err
+		}
+		if doc != nil {
+			docs = append(docs, doc)
+		}
+	}
+}
+
+// validateResource validates a single resource (expanding 'List' kinds) and returns any problems found.
+func (k *k8sSchemas) validateResource(doc map[string]interface{}, label string) (problems []string, skipped []string, err error) {
+	apiVersion, _ := doc["apiVersion"].(string)
+	kind, _ := doc["kind"].(string)
+	if apiVersion == "" || kind == "" {
+		return nil, nil, nil
+	}
+	if metadata, ok := doc["metadata"].(map[string]interface{}); ok {
+		if name, ok := metadata["name"].(string); ok {
+			label = fmt.Sprintf("%s %s/%s", label, kind, name)
+		}
+	}
+	if items, ok := doc["items"].([]interface{}); ok && strings.HasSuffix(kind, "List") {
+		for i, item := range items {
+			if itemDoc, ok := item.(map[string]interface{}); ok {
+				p, s, err := k.validateResource(itemDoc, fmt.Sprintf("%s item %d", label, i))
+				if err != nil {
+					return nil, nil, err
+				}
+				problems, skipped = append(problems, p...), append(skipped, s...)
+			}
+		}
+		return problems, skipped, nil
+	}
+
+	s, err := k.schemaFor(apiVersion, kind)
+	if err != nil {
+		return nil, nil, err
+	}
+	if s == nil {
+		return nil, []string{fmt.Sprintf("%s: no schema found for %s %s", label, apiVersion, kind)}, nil
+	}
+	for _, verr := range s.Validate(doc) {
+		problems = append(problems, fmt.Sprintf("%s: %s", label, verr.Error()))
+	}
+	return problems, nil, nil
+}
+
+// validateK8sManifests validates every captured YAML file that looks like a Kubernetes manifest. Resources for which
+// no schema can be found are reported but do not cause a failure.
+func validateK8sManifests(schemaDir string, manifests *captureSink) error {
+	schemas, err := newK8sSchemas(schemaDir)
+	if err != nil {
+		return err
+	}
+	var problems []string
+	for _, file := range manifests.SortedFiles() {
+		docs, err := decodeYAMLDocuments(manifests.Files[file])
+		if err != nil {
+			problems = append(problems, fmt.Sprintf("%s: could not parse YAML: %s", file, err.Error()))
+			continue
+		}
+		for i, raw := range docs {
+			doc, ok := schema.Normalize(raw).(map[string]interface{})
+			if !ok {
+				continue
+			}
+			label := file
+			if len(docs) > 1 {
+				label = fmt.Sprintf("%s (document %d)", file, i+1)
+			}
+			p, skipped, err := schemas.validateResource(doc, label)
+			if err != nil {
+				return err
+			}
+			problems = append(problems, p...)
+			for _, s := range skipped {
+				logs.Warnf("%s", s)
+			}
+		}
+	}
+	if len(problems) > 0 {
+		return fmt.Errorf("Kubernetes schema validation failed:\n  %s", strings.Join(problems, "\n  "))
+	}
+	return nil
+}
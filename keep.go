@@ -0,0 +1,120 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"regexp"
+	"strings"
+)
+
+// Protected regions are delimited by lines containing these markers, usually inside a comment such as
+// '// spiro:keep-start imports'. The content between the markers in an existing output file survives regeneration.
+const (
+	keepStartMarker = "spiro:keep-start"
+	keepEndMarker   = "spiro:keep-end"
+)
+
+var keepStartPattern = regexp.MustCompile(regexp.QuoteMeta(keepStartMarker) + `(?:[ \t]+([\w.-]+))?`)
+
+// keptRegion is the content between a pair of protected region markers.
+type keptRegion struct {
+	name string
+	// start and end are the indexes of the marker lines
+	start int
+	end   int
+}
+
+// findKeptRegions returns the protected regions in the lines of a file. Regions without a name are identified by their
+// position among the unnamed regions.
+func findKeptRegions(lines []string) ([]keptRegion, error) {
+	var regions []keptRegion
+	var current *keptRegion
+	unnamed := 0
+	for i, line := range lines {
+		if m := keepStartPattern.FindStringSubmatch(line); m != nil {
+			if current != nil {
+				return nil, fmt.Errorf("line %d: %s inside the region started on line %d", i+1, keepStartMarker, current.start+1)
+			}
+			current = &keptRegion{name: m[1], start: i}
+			if current.name == "" {
+				current.name = fmt.Sprintf("#%d", unnamed)
+				unnamed++
+			}
+		} else if strings.Contains(line, keepEndMarker) {
+			if current == nil {
+				return nil, fmt.Errorf("line %d: %s without a matching %s", i+1, keepEndMarker, keepStartMarker)
+			}
+			current.end = i
+			regions = append(regions, *current)
+			current = nil
+		}
+	}
+	if current != nil {
+		return nil, fmt.Errorf("line %d: %s without a matching %s", current.start+1, keepStartMarker, keepEndMarker)
+	}
+	return regions, nil
+}
+
+// preserveKeptRegions replaces the content of the protected regions in the rendered content with the content of the
+// regions of the same name in the existing content. It also returns the names of existing regions that no longer
+// appear in the rendered content, whose content is lost.
+func preserveKeptRegions(rendered string, existing string) (string, []string, error) {
+	renderedLines := strings.Split(rendered, "\n")
+	renderedRegions, err := findKeptRegions(renderedLines)
+	if err != nil {
+		return "", nil, fmt.Errorf("rendered content: %s", err.Error())
+	}
+	existingLines := strings.Split(existing, "\n")
+	existingRegions, err := findKeptRegions(existingLines)
+	if err != nil {
+		return "", nil, fmt.Errorf("existing content: %s", err.Error())
+	}
+
+	kept := make(map[string][]string, len(existingRegions))
+	for _, region := range existingRegions {
+		kept[region.name] = existingLines[region.start+1 : region.end]
+	}
+	var out []string
+	previous := 0
+	for _, region := range renderedRegions {
+		out = append(out, renderedLines[previous:region.start+1]...)
+		if body, ok := kept[region.name]; ok {
+			out = append(out, body...)
+			delete(kept, region.name)
+		} else {
+			out = append(out, renderedLines[region.start+1:region.end]...)
+		}
+		previous = region.end
+	}
+	out = append(out, renderedLines[previous:]...)
+
+	var dropped []string
+	for _, region := range existingRegions {
+		if _, ok := kept[region.name]; ok {
+			dropped = append(dropped, region.name)
+		}
+	}
+	return strings.Join(out, "\n"), dropped, nil
+}
+
+// keepRegions preserves the protected regions of the existing output file, if there is one.
+func keepRegions(outputFile string, rendered string) (string, error) {
+	if !strings.Contains(rendered, keepStartMarker) {
+		return rendered, nil
+	}
+	existing, err := ioutil.ReadFile(longPath(outputFile))
+	if os.IsNotExist(err) {
+		return rendered, nil
+	} else if err != nil {
+		return "", err
+	}
+	out, dropped, err := preserveKeptRegions(rendered, string(existing))
+	if err != nil {
+		return "", err
+	}
+	for _, name := range dropped {
+		logs.Warnf("protected region '%s' in '%s' no longer exists in the template, its content was dropped", name, outputFile)
+	}
+	return out, nil
+}
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+)
+
+// licenseAliases maps deprecated or commonly used identifiers onto the SPDX identifiers in licenseTexts.
+var licenseAliases = map[string]string{
+	"apache2":  "Apache-2.0",
+	"gpl-3.0":  "GPL-3.0-only",
+	"gpl-3.0+": "GPL-3.0-or-later",
+	"gpl3":     "GPL-3.0-only",
+	"bsd-2":    "BSD-2-Clause",
+	"bsd-3":    "BSD-3-Clause",
+}
+
+// LicenseText returns the full text of the license with the given SPDX identifier, eg: licenseText "MIT" .author
+// .year. The optional copyright holder and year replace the placeholders in the copyright line of licenses that have
+// one; the year defaults to the current year. Placeholders elsewhere, like the ones in the GPL's instructions for
+// applying it, are left for the reader to fill in. Licenses such as Apache-2.0 are returned verbatim since their text
+// does not name the copyright holder.
+func LicenseText(id string, args ...interface{}) (string, error) {
+	if len(args) > 2 {
+		return "", fmt.Errorf("licenseText accepts at most a copyright holder and a year")
+	}
+	text, ok := findLicense(id)
+	if !ok {
+		return "", fmt.Errorf("unknown license '%s', supported licenses are %s", id, strings.Join(licenseIDs(), ", "))
+	}
+	holder, year := "", fmt.Sprint(time.Now().Year())
+	if len(args) > 0 {
+		holder = fmt.Sprint(args[0])
+	}
+	if len(args) > 1 {
+		year = fmt.Sprint(args[1])
+	}
+	if strings.Contains(text, "<copyright holders>") && holder == "" {
+		return "", fmt.Errorf("the %s license requires a copyright holder", id)
+	}
+	return copyrightLine.ReplaceAllStringFunc(text, func(line string) string {
+		line = strings.Replace(line, "<copyright holders>", holder, -1)
+		return strings.Replace(line, "<year>", year, -1)
+	}), nil
+}
+
+// copyrightLine matches the line of a license naming its copyright holders.
+var copyrightLine = regexp.MustCompile(`(?m)^Copyright .*<copyright holders>.*$`)
+
+func findLicense(id string) (string, bool) {
+	if alias, ok := licenseAliases[strings.ToLower(id)]; ok {
+		id = alias
+	}
+	for key, text := range licenseTexts {
+		if strings.EqualFold(key, id) {
+			return text, true
+		}
+	}
+	return "", false
+}
+
+func licenseIDs() []string {
+	ids := make([]string, 0, len(licenseTexts))
+	for id := range licenseTexts {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	return ids
+}
@@ -0,0 +1,197 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/AstromechZA/spiro/engine"
+	"github.com/AstromechZA/spiro/templatefactory"
+)
+
+// templateSource is a part of a template that is parsed as a template.
+type templateSource struct {
+	// path is the slash separated template path that the source comes from, relative to the template root, or the
+	// manifest for its pipelines.
+	path string
+	// name is the name that errors refer to the source by and what describes it in messages.
+	name string
+	what string
+	text string
+	// foreach is set for sources rendered once per element of a list, where the element's keys are available too.
+	foreach bool
+	// content is set when text is the content of the file at path, rather than a name or a manifest pipeline.
+	content bool
+}
+
+// walkTemplate calls fn for every item of a template except its metadata and ignored paths, with the slash separated
+// path of the item relative to the template root. Returning filepath.SkipDir from fn skips a directory.
+func walkTemplate(inputTemplate string, manifest *templateManifest, fn func(itemPath string, rel string, info os.FileInfo) error) error {
+	ignore, err := newIgnoreRules(manifest.Ignore)
+	if err != nil {
+		return err
+	}
+	root := filepath.Clean(inputTemplate)
+	return filepath.Walk(root, func(itemPath string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, _ := filepath.Rel(root, itemPath)
+		rel = filepath.ToSlash(rel)
+		if itemPath != root {
+			if filepath.Dir(itemPath) == root && manifest.isMetadata(info.Name()) || ignore.Ignored(rel, info.IsDir()) {
+				if info.IsDir() {
+					return filepath.SkipDir
+				}
+				return nil
+			}
+		}
+		return fn(filepath.ToSlash(itemPath), rel, info)
+	})
+}
+
+// templateSources returns the pipelines in the manifest of a template, its templated path names and the content of its
+// .templated files. Files that are only included under a condition are returned too.
+func templateSources(inputTemplate string, tf *templatefactory.TemplateFactory, manifest *templateManifest) ([]templateSource, error) {
+	startDelim, endDelim := tf.Delimiters()
+	action := func(pipeline string) string {
+		return startDelim + " " + pipeline + " " + endDelim
+	}
+	var sources []templateSource
+	for _, include := range manifest.Include {
+		sources = append(sources, templateSource{
+			path: manifestFileName,
+			name: manifestFileName,
+			what: fmt.Sprintf("the include condition for '%s'", include.Path),
+			text: action("if "+include.When) + action("end"),
+		})
+	}
+	paths := make([]string, 0, len(manifest.Foreach))
+	for rel := range manifest.Foreach {
+		paths = append(paths, rel)
+	}
+	sort.Strings(paths)
+	for _, rel := range paths {
+		sources = append(sources, templateSource{
+			path: manifestFileName,
+			name: manifestFileName,
+			what: fmt.Sprintf("the foreach list for '%s'", rel),
+			text: action(manifest.Foreach[rel]),
+		})
+	}
+
+	foreachDirs := make(map[string]bool)
+	err := walkTemplate(inputTemplate, manifest, func(itemPath string, rel string, info os.FileInfo) error {
+		foreach := foreachDirs[path.Dir(rel)]
+		if rel == "." {
+			// a single file template
+			rel = info.Name()
+		}
+		name := info.Name()
+		if pipeline, rest, ok := engine.ForeachName(name, startDelim, endDelim); ok {
+			sources = append(sources, templateSource{
+				path:    rel,
+				name:    itemPath,
+				what:    fmt.Sprintf("the foreach list in the name of '%s'", itemPath),
+				text:    action(pipeline),
+				foreach: foreach,
+			})
+			name = rest
+			foreach = true
+		} else if _, ok := manifest.Foreach[rel]; ok {
+			foreach = true
+		}
+		if info.IsDir() {
+			foreachDirs[rel] = foreach
+		}
+		if tf.StringContainsTemplating(name) {
+			sources = append(sources, templateSource{path: rel, name: itemPath, what: fmt.Sprintf("the name of '%s'", itemPath), text: name, foreach: foreach})
+		}
+		// the .templated suffix can be inside a condition, eg: '{{ if .docs }}README.md.templated{{ end }}'
+		if info.IsDir() || !strings.Contains(name, engine.TemplatedSuffix) {
+			return nil
+		}
+		content, err := ioutil.ReadFile(longPath(itemPath))
+		if err != nil {
+			return fmt.Errorf("Error while reading '%s': %s", itemPath, err.Error())
+		}
+		sources = append(sources, templateSource{path: rel, name: itemPath, what: fmt.Sprintf("'%s'", itemPath), text: string(content), foreach: foreach, content: true})
+		return nil
+	})
+	return sources, err
+}
+
+// lintTemplate parses every source of a template, and its snippets, without rendering anything. It returns a problem
+// for each syntax error or call to an unknown function so that they can all be fixed at once.
+func lintTemplate(inputTemplate string, tf *templatefactory.TemplateFactory, manifest *templateManifest) ([]string, error) {
+	sources, err := templateSources(inputTemplate, tf, manifest)
+	if err != nil {
+		return nil, err
+	}
+	var problems []string
+	for _, source := range sources {
+		if err := tf.Parse(source.name, source.text); err != nil {
+			problems = append(problems, fmt.Sprintf("%s: %s", source.what, err.Error()))
+		}
+	}
+	if !manifest.Snippets {
+		return problems, nil
+	}
+	// snippets are only rendered when a file calls 'snippet', so they are parsed on their own
+	err = filepath.Walk(filepath.Join(inputTemplate, snippetsDirName), func(file string, info os.FileInfo, err error) error {
+		if os.IsNotExist(err) {
+			return nil
+		} else if err != nil {
+			return err
+		}
+		if info.IsDir() || !isSnippetFile(info.Name()) {
+			return nil
+		}
+		content, err := ioutil.ReadFile(longPath(file))
+		if err != nil {
+			return fmt.Errorf("Error while reading '%s': %s", file, err.Error())
+		}
+		file = filepath.ToSlash(file)
+		if err := tf.Parse(file, string(content)); err != nil {
+			problems = append(problems, fmt.Sprintf("the snippet '%s': %s", file, err.Error()))
+		}
+		return nil
+	})
+	return problems, err
+}
+
+// lintError reports all the problems found in a template as one error.
+func lintError(inputTemplate string, problems []string) error {
+	return fmt.Errorf("Found %s in '%s':\n  %s", countProblems(len(problems)), inputTemplate, strings.Join(problems, "\n  "))
+}
+
+func countProblems(n int) string {
+	if n == 1 {
+		return "1 problem"
+	}
+	return fmt.Sprintf("%d problems", n)
+}
+
+// runTemplateLint checks a template with lintTemplate for 'spiro validate' when no spec is given.
+func runTemplateLint(inputTemplate string, setup func(tf *templatefactory.TemplateFactory) error) error {
+	manifest, err := loadManifest(inputTemplate)
+	if err != nil {
+		return err
+	}
+	tf := templatefactory.NewTemplateFactory()
+	if err := manifest.withDelimiters(setup)(tf); err != nil {
+		return err
+	}
+	problems, err := lintTemplate(inputTemplate, tf, manifest)
+	if err != nil {
+		return err
+	} else if len(problems) > 0 {
+		return lintError(inputTemplate, problems)
+	}
+	logs.Infof("No problems found in '%s'", inputTemplate)
+	return nil
+}
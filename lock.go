@@ -0,0 +1,54 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// lockPollInterval is how often a run waiting for the output directory lock tries again.
+const lockPollInterval = 100 * time.Millisecond
+
+// outputLockPath returns the lock file for an output directory. It lives in the temporary directory rather than the
+// output directory so that it never shows up in the generated project.
+func outputLockPath(dir string) (string, error) {
+	abs, err := filepath.Abs(dir)
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256([]byte(abs))
+	return filepath.Join(os.TempDir(), "spiro-"+hex.EncodeToString(sum[:8])+".lock"), nil
+}
+
+// lockOutput takes an advisory lock on the output directory so that concurrent runs writing to it don't interleave
+// their writes. When another run holds the lock it waits for it to finish, for at most wait unless that is 0, or fails
+// right away with noWait. The returned function releases the lock.
+func lockOutput(dir string, wait time.Duration, noWait bool) (func(), error) {
+	path, err := outputLockPath(dir)
+	if err != nil {
+		return nil, err
+	}
+	start := time.Now()
+	waiting := false
+	for {
+		release, ok, err := tryLockFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("Could not lock the output directory '%s': %s", dir, err.Error())
+		} else if ok {
+			return release, nil
+		}
+		if noWait {
+			return nil, fmt.Errorf("Another spiro run is writing to the output directory '%s', remove -no-wait to wait for it to finish", dir)
+		} else if wait > 0 && time.Since(start) >= wait {
+			return nil, fmt.Errorf("Gave up waiting %s for another spiro run writing to the output directory '%s' to finish", wait, dir)
+		}
+		if !waiting {
+			logs.Infof("Waiting for another spiro run writing to '%s' to finish", dir)
+			waiting = true
+		}
+		time.Sleep(lockPollInterval)
+	}
+}
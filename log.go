@@ -0,0 +1,124 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// logLevel orders log lines by importance, a logger drops the lines below its level.
+type logLevel int
+
+const (
+	levelDebug logLevel = iota
+	levelInfo
+	levelWarn
+	levelError
+)
+
+func (l logLevel) String() string {
+	switch l {
+	case levelDebug:
+		return "debug"
+	case levelInfo:
+		return "info"
+	case levelWarn:
+		return "warn"
+	}
+	return "error"
+}
+
+const (
+	logFormatText = "text"
+	logFormatJSON = "json"
+)
+
+// logger writes spiro's progress, warnings and errors to stderr so that stdout only carries output that is meant to be
+// read or piped, such as -diff or -dry-run. Lines are plain text, or one JSON object per line with the json format.
+type logger struct {
+	mu     sync.Mutex
+	out    io.Writer
+	level  logLevel
+	format string
+	// progress is moved past before each line so that lines are not appended to the progress bar
+	progress *progressBar
+}
+
+// logs is the logger used throughout a run, configured from the -quiet, -verbose and -log-format flags.
+var logs = &logger{out: os.Stderr, level: levelInfo, format: logFormatText}
+
+// configure sets the level and format of the logger from the command line flags.
+func (l *logger) configure(quiet bool, verbose bool, format string) error {
+	if quiet && verbose {
+		return fmt.Errorf("-quiet and -verbose cannot be used together")
+	}
+	switch format {
+	case logFormatText, logFormatJSON:
+	default:
+		return fmt.Errorf("Unknown -log-format '%s', use 'text' or 'json'", format)
+	}
+	l.format = format
+	switch {
+	case quiet:
+		l.level = levelError
+	case verbose:
+		l.level = levelDebug
+	default:
+		l.level = levelInfo
+	}
+	return nil
+}
+
+// enabled reports whether lines at the level are written.
+func (l *logger) enabled(level logLevel) bool {
+	return level >= l.level
+}
+
+func (l *logger) log(level logLevel, format string, args ...interface{}) {
+	if !l.enabled(level) {
+		return
+	}
+	msg := strings.TrimRight(fmt.Sprintf(format, args...), "\n")
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.progress.Stop()
+	if l.format == logFormatJSON {
+		encoder := json.NewEncoder(l.out)
+		encoder.SetEscapeHTML(false)
+		encoder.Encode(struct {
+			Time  string `json:"time"`
+			Level string `json:"level"`
+			Msg   string `json:"msg"`
+		}{time.Now().UTC().Format(time.RFC3339Nano), level.String(), msg})
+		return
+	}
+	if level == levelWarn {
+		msg = "Warning: " + msg
+	}
+	fmt.Fprintln(l.out, msg)
+}
+
+// Debugf logs details that are only shown with -verbose, such as timings.
+func (l *logger) Debugf(format string, args ...interface{}) {
+	l.log(levelDebug, format, args...)
+}
+
+// Infof logs what spiro is doing.
+func (l *logger) Infof(format string, args ...interface{}) {
+	l.log(levelInfo, format, args...)
+}
+
+// Warnf logs problems that do not stop the run.
+func (l *logger) Warnf(format string, args ...interface{}) {
+	l.log(levelWarn, format, args...)
+}
+
+// Errorf logs the error that ended the run, it is the only line written with -quiet.
+func (l *logger) Errorf(format string, args ...interface{}) {
+	l.log(levelError, format, args...)
+}
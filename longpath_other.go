@@ -0,0 +1,8 @@
+//go:build !windows
+
+package main
+
+// longPath returns the path as it is, only Windows limits the length of paths to MAX_PATH.
+func longPath(p string) string {
+	return p
+}
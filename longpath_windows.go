@@ -0,0 +1,32 @@
+//go:build windows
+
+package main
+
+import (
+	"path/filepath"
+	"strings"
+)
+
+// longPathPrefix marks an extended-length path, which Windows accepts beyond MAX_PATH (260 characters).
+const longPathPrefix = `\\?\`
+
+// longPathLimit is the length from which paths get the prefix. Directories are limited to 248 characters, leaving room
+// for an 8.3 file name.
+const longPathLimit = 248
+
+// longPath returns the extended-length form of a long path so that deep trees can be read and written. Extended-length
+// paths are passed to Windows as they are, so they must be absolute and clean with backslashes. UNC paths
+// (\\server\share\...) use the \\?\UNC\ form.
+func longPath(p string) string {
+	if strings.HasPrefix(p, longPathPrefix) {
+		return p
+	}
+	abs, err := filepath.Abs(p)
+	if err != nil || len(abs) < longPathLimit {
+		return p
+	}
+	if strings.HasPrefix(abs, `\\`) {
+		return longPathPrefix + `UNC\` + abs[2:]
+	}
+	return longPathPrefix + abs
+}
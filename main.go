@@ -1,10 +1,9 @@
 package main
 
 import (
-	"bytes"
+	"errors"
 	"flag"
 	"fmt"
-	"io"
 	"io/ioutil"
 	"os"
 	"os/exec"
@@ -14,8 +13,7 @@ import (
 	"strings"
 	"time"
 
-	yaml "gopkg.in/yaml.v2"
-
+	"github.com/AstromechZA/spiro/engine"
 	"github.com/AstromechZA/spiro/templatefactory"
 )
 
@@ -28,15 +26,206 @@ The rule-set is probably a bit complex to display here, but the following links
 - https://golang.org/pkg/text/template
 - https://gohugo.io/templates/go-templates/
 
+A file or directory named like '{{foreach .services}}{{.name}}{{end}}' is rendered once per element of the list, with
+the element available as .item (and its keys directly when it is a map) and its position as .index.
+
 See the project homepage for more documentation: https://github.com/AstromechZA/spiro
 
+The input template can also be a git URL (eg: https://github.com/org/template.git or git@github.com:org/template.git),
+optionally followed by '#' and a branch, tag or commit. It is cloned into a temporary directory before rendering.
+Template bundles ending in .tar.gz, .tgz or .zip are extracted into a temporary directory in the same way.
+
+Use -offline (or SPIRO_OFFLINE=true) to forbid all network access, eg: in air-gapped environments. Remote templates,
+network template functions, -webhook and telemetry then fail or are skipped instead of going online.
+
 The spec file should be in JSON or YAML form and will be passed to each template invocation. The specfile can be "-" to
-indicate that YAML should be read from stdin.
+indicate that YAML should be read from stdin. Spec files ending in .toml, .json5 or .jsonc are read as TOML or JSON5,
+and .cue files are evaluated and checked against their constraints with 'cue export'. Use -spec-format to choose the
+format of other files or of stdin. The spec can also be a directory laid out like a
+mounted Kubernetes ConfigMap or Secret: each file becomes a key named after the file, with the file contents as its
+value.
+
+YAML anchors, aliases and '<<' merge keys in the spec are expanded, with keys written in a mapping winning over merged
+ones. Use -unique-keys to fail when a mapping sets the same key twice.
+
+Use -profile <name> to deep merge the spec's profiles.<name> map over the rest of the spec, so that one spec file can
+hold variants for several environments.
+
+Use -spec-path with a jq style path, eg: -spec-path '.services[0]', to render with only that part of the spec.
+
+Use -files-from with a file, or '-' for stdin, listing template files one per line to only render those files, eg:
+git diff --name-only | spiro -files-from - -force my-template spec.yaml output/
+
+Several spec files can be given as a comma separated list (eg: base.yaml,overrides.yaml) or with the repeatable -spec
+flag, in which case the spec file argument may be omitted. They are deep merged in order with later files winning:
+nested maps are merged key by key and any other value, including lists, replaces the earlier one.
 
 You can use the -edit flag to edit the spec file in your native $EDITOR before passing it to the templating system.
 This is useful to avoid the overhead of having to copy and modify an existing source of truth spec file.
 
-$ spiro [options] {input template} {spec file} {output directory}
+Use -left-delim and -right-delim (eg: -left-delim '[[' -right-delim ']]') to change the '{{' and '}}' characters
+that start and end template actions, templates can set them with 'delimiters' in their manifest too.
+
+Use -pipe to render a single template read from stdin with the spec files given as arguments and write the result to
+stdout, eg: spiro -pipe spec.yaml < nginx.conf.tmpl > nginx.conf
+
+Runs writing to the same output directory at the same time wait for each other, use -wait to give up after a while
+or -no-wait to fail right away.
+
+Use -also-output (repeatable) or 'destinations' in the template manifest to write the same render to more output
+directories, eg: a mounted deploy volume.
+
+When the output directory argument ends in .tar.gz, .tgz or .zip, the rendered tree is written into an archive of that
+format instead, use -force to replace an existing archive.
+
+Use -stdout-all to render in memory and print every generated file to stdout after a '--- filename ---' line instead
+of writing anything, eg: to pipe a bundle of generated config into another tool. The output directory is left out.
+
+When a run fails part way through, the files it wrote are removed and the files it changed are restored, use
+-no-rollback to leave them in place instead.
+
+You can use the -output-patch flag to leave the output directory untouched and instead write a single patch file
+describing the changes that rendering would make to it. The patch can be applied from within the output directory using
+'git apply'.
+
+You can use the -git-init flag to initialize a git repository in the generated output and commit everything in it. The
+commit message is given by -git-message and may itself contain templating.
+
+The -dry-run flag renders the template in memory and reports every directory and file that would be created, updated
+or left unchanged in the output directory, whether it is rendered or copied and which template item it came from,
+without writing anything. Add -exit-code to -dry-run, -diff or -output-patch to exit with status 2 when there are
+changes and 0 when the output is already up to date, which is useful for detecting drift in CI.
+
+The -diff flag renders the template in memory and prints a unified diff of the changes it would make to the files in
+the output directory instead of writing them. -preview shows it colored through $PAGER instead, -preview-file only
+shows the change to one file.
+
+Use -set dotted.key=value to set a string in the spec after it is loaded, and -set-json dotted.key=<json> for numbers,
+booleans, lists and maps. Both can be repeated and are applied in order, creating missing maps along the path.
+Use -env-prefix PREFIX to set a string for every environment variable starting with PREFIX (eg: PREFIX_db__port sets
+.db.port), before the -set flags; the spec file argument can then be left out.
+
+Renders using -prompt or -edit (or any render with -save-answers) write the spec they used, including the answers and
+defaults, to .spiro-answers.yaml in the output directory. -replay renders again from that file without a spec file
+argument and without asking anything that was already answered. Sensitive values are never saved.
+
+The files as rendered are saved next to it in .spiro-base.tar.gz. 'spiro update' renders again from the saved answers
+and merges the result into the output directory: template changes are applied, local edits to generated files are
+kept, and where both changed the same lines the file gets git style conflict markers and spiro exits with an error.
+
+The -enable-funcs and -disable-funcs flags (or the SPIRO_ENABLE_FUNCS and SPIRO_DISABLE_FUNCS environment variables)
+take comma separated lists of template function names to restrict what templates may use, eg: -disable-funcs now for
+reproducible output. Disabled functions cause an error when called.
+
+Existing output files whose content differs from the rendered template are conflicts, which fail the run unless -force
+(overwrite them), -skip-existing (keep them) or -prompt-on-conflict (ask for each file) is given. A summary of the
+overwritten and kept files is printed at the end. Existing files matching a -protect pattern (eg: -protect '**/*.env'
+-protect 'secrets/**', relative to the output directory) are never overwritten, whichever of those flags is given.
+
+Rendered paths that only differ by case (eg: README.md and Readme.md) or by Unicode normalization collide on macOS and
+Windows, spiro warns about them unless -case-collisions is set to error (fail the run) or ignore. Use -normalize-names
+nfc (or nfd) to write every rendered name in one Unicode normalization form, so that non-ASCII names from the spec
+give the same files whether the spec was written on macOS or Linux.
+
+Templates can ship a spec.schema.json JSON Schema (declared with 'spec_schema: true' in their manifest), the spec is
+validated against it before anything is rendered.
+
+Use -webhook to POST a JSON report of each successful generation (template, template revision, a hash of the spec and
+the generated files) to an inventory or audit system.
+
+Templates can declare the variables they need in their manifest. Missing variables use their declared default, use
+-prompt to be asked for them on the terminal instead.
+
+External template functions can be provided by plugins: -plugin name=command starts the command (with sh -c) and its
+functions are called as {{ name.function ... }}. Plugins speak a line based JSON protocol on stdin and stdout, see the
+project homepage for details.
+
+Spec files encrypted with SOPS or age are decrypted transparently using the 'sops' or 'age' command. SOPS finds its
+keys as usual (eg: $SOPS_AGE_KEY_FILE), age encrypted specs need an identity file given with -age-identity or
+$SPIRO_AGE_IDENTITY.
+
+Use -sensitive with a comma separated list of dotted spec keys (eg: -sensitive db.password,api.token) to redact their
+values from logs, reports and error messages, and to keep prompt answers containing them out of the generation
+manifest. Templates can also list these keys under 'sensitive' in their manifest.
+
+Values are inserted into rendered files as plain text. Use -html when generating HTML documents to escape them with
+the contextual escaping of Golang's html/template library instead.
+
+Referring to a spec key that does not exist is always an error. Null values (and missing values looked up with 'index')
+are rendered as '<no value>' though, use -strict to fail when one is inserted, in file names as well as file content.
+
+Use -watch while developing a template to render it again whenever the template or spec files change.
+
+The debugDump and typeOf template functions show the data a template receives, use -trace to write their output to
+stderr instead of the rendered files.
+
+The -tidy flag removes the blank lines and indentation left behind by lines holding only actions like {{ if }} or
+{{ end }}, trailing spaces and extra blank lines from rendered files, and ends them with a newline.
+
+The -header flag adds a 'Code generated by spiro from <template>@<version>. DO NOT EDIT.' comment to the top of every
+rendered file whose comment syntax is known from its extension. Templates can customize the header in their manifest.
+
+When running in a terminal a progress bar is shown instead of a line for every processed file, use -verbose (or -v) to
+log each file anyway along with how long it took. Use -quiet to only log errors, and -log-format json to log one JSON
+object per line for CI systems to parse. The log is written to stderr, stdout only carries output like -diff.
+
+You can use the -matrix-specs flag to render the template once per spec fragment (eg: -matrix-specs
+dev.yaml,staging.yaml,prod.yaml), deep merging each fragment over the spec file and writing each result into a
+subfolder of the output directory named after the fragment. Repeat the flag to render every combination of fragments
+across the lists, in which case the subfolder names are joined with '-'.
+
+Failing to copy file permissions (common on FAT, NTFS and FUSE mounts) fails the run by default. Use
+-perm-errors=warn or -perm-errors=ignore to treat these separately from errors writing the file content.
+
+When generating a tree that contains secrets, use -output-owner-only to make every generated file and directory
+accessible only by its owner (0600 for files, 0700 for executables and directories) regardless of the template
+permissions.
+
+You can use the -helm flag to expose the spec as .Values (along with Helm style .Release and .Chart objects) so that
+snippets copied from Helm charts work without modification.
+
+You can use the -k8s-schemas flag to validate every rendered YAML file that looks like a Kubernetes manifest against
+the JSON schemas (eg: from kubernetes-json-schema) and CustomResourceDefinitions found in the given directory.
+
+When regenerating into an existing git repository, -git-branch renders the changes onto a new branch (use -git-worktree
+to check that branch out into a separate worktree instead of switching the existing checkout) and -git-commit commits
+the result so that it is ready for review.
+
+Templates can keep reusable blocks in a snippets/ directory (declared with 'snippets: true' in their manifest), rendered
+with {{ snippet "name" context }} and validated against a name.schema.json next to them. Use -snippets (or
+$SPIRO_SNIPPETS) to add comma separated directories of snippets shared between templates.
+
+Templates can define tests for their expressions in their manifest, run them with 'spiro test'.
+
+'spiro bench' renders a template -bench-runs times in memory (or on disk with -bench-disk) and reports the mean and
+percentile durations and the allocations of each run and of each file, to track performance regressions.
+
+The first argument can be a command, its options can come before or after it:
+
+  render     render the template into the output directory (the default when no command is given)
+  diff       show what rendering would change in the output directory as a unified diff, like -diff
+  validate   check that the template parses and, given a spec, that the spec is valid and renders, writing nothing
+  check      report the problems in a single template file with their positions, as JSON for editors with -json
+  init       write a starter template into a new directory
+  funcs      list the template functions that templates can use
+  docs       write Markdown documentation of the template's inputs, hooks and outputs for its users
+  vars       list the spec keys the template reads with where they are read, failing on undeclared ones
+  test       run the template's expression tests
+  bench      benchmark rendering the template
+  update     render again with the saved answers and merge the result with local edits to the output directory
+
+$ spiro [options] [render|diff] {input template} {spec file} {output directory}
+$ spiro [options] [render|diff] -spec {spec file} [-spec ...] {input template} {output directory}
+$ spiro [options] [render|diff] -replay {input template} {output directory}
+$ spiro [options] validate {input template} [spec file]
+$ spiro [options] check [-json] {template file} [spec file]
+$ spiro [options] init {template directory}
+$ spiro [options] funcs
+$ spiro [options] docs {input template}
+$ spiro [options] vars {input template}
+$ spiro [options] test {input template} [spec file]
+$ spiro [options] bench {input template} [spec file]
+$ spiro [options] update {input template} {output directory}
 `
 
 const logoImage = `
@@ -51,134 +240,31 @@ const logoImage = `
 // Version is a combination of version information (tag/commit/date/etc)
 var Version = "<unofficial build>"
 
-func copyFileContents(src, dst string) error {
-	in, err := os.Open(src)
-	if err != nil {
-		return err
-	}
-	defer in.Close()
-	out, err := os.Create(dst)
-	if err != nil {
-		return err
-	}
-	defer func() {
-		cerr := out.Close()
-		if err == nil {
-			err = cerr
-		}
-	}()
-	if _, err = io.Copy(out, in); err != nil {
-		return err
-	}
-	return out.Sync()
-}
-
-func processDir(templateString string, spec *map[string]interface{}, outputDir string, tf *templatefactory.TemplateFactory) error {
-	fromBase := path.Base(templateString)
-	toBase := fromBase
-	if tf.StringContainsTemplating(fromBase) {
-		var err error
-		toBase, err = tf.Render(fromBase)
-		if err != nil {
-			return fmt.Errorf("Error while processing '%s': %s", templateString, err.Error())
-		}
-	}
-	toBase = strings.TrimSpace(toBase)
-	if len(toBase) == 0 {
-		fmt.Printf("Skipping '%s' since the name evaluated to ''\n", templateString)
-		return nil
-	}
-
-	newOutputDir := path.Join(outputDir, toBase)
-	fmt.Printf("Processing '%s/' -> '%s/'\n", templateString, newOutputDir)
-	if err := os.Mkdir(newOutputDir, 0755); err != nil && !os.IsExist(err) {
-		return fmt.Errorf("Error while processing '%s': %s", templateString, err.Error())
-	}
-
-	items, err := ioutil.ReadDir(templateString)
-	if err != nil {
-		return fmt.Errorf("Error while reading '%s': %s", templateString, err.Error())
-	}
-	for _, item := range items {
-		if err := process(path.Join(templateString, item.Name()), spec, newOutputDir, tf); err != nil {
-			return err
-		}
-	}
-	return nil
+// renderName evaluates any templating in the base name of the given template path. An empty result indicates that the
+// item should be skipped.
+func renderName(templateString string, tf *templatefactory.TemplateFactory) (string, error) {
+	return engine.RenderName(tf, templateString)
 }
 
-func processFile(templateString string, spec *map[string]interface{}, outputDir string, tf *templatefactory.TemplateFactory) error {
-	fromBase := path.Base(templateString)
-	toBase := fromBase
-	if tf.StringContainsTemplating(fromBase) {
-		var err error
-		toBase, err = tf.Render(fromBase)
-		if err != nil {
-			return fmt.Errorf("Error while processing '%s': %s", templateString, err.Error())
-		}
-	}
-	toBase = strings.TrimSpace(toBase)
-	if len(toBase) == 0 {
-		fmt.Printf("Skipping '%s' since the name evaluated to ''\n", templateString)
-		return nil
-	}
-
-	if strings.HasSuffix(toBase, ".templated") {
-		toBase = toBase[:len(toBase)-10]
-		if len(toBase) == 0 {
-			fmt.Printf("Skipping '%s' since the name evaluated to ''\n", templateString)
-			return nil
-		}
-		fmt.Printf("Processing '%s' -> '%s'\n", templateString, path.Join(outputDir, toBase))
-		inputBytes, err := ioutil.ReadFile(templateString)
-		if err != nil {
-			return fmt.Errorf("Error while reading '%s': %s", templateString, err.Error())
-		}
-		outputBytes, err := tf.Render(string(inputBytes))
-		if err != nil {
-			return fmt.Errorf("Error while rendering template for '%s': %s", templateString, err.Error())
-		}
-		if err := ioutil.WriteFile(path.Join(outputDir, toBase), []byte(outputBytes), 0644); err != nil {
-			return fmt.Errorf("Error while writing file bytes for '%s': %s", templateString, err.Error())
+func readSpecRaw(specFile string) ([]byte, error) {
+	var content []byte
+	var err error
+	if specFile == "-" {
+		if content, err = ioutil.ReadAll(os.Stdin); err != nil {
+			return nil, err
 		}
 	} else {
-		fmt.Printf("Processing '%s' -> '%s'\n", templateString, path.Join(outputDir, toBase))
-		if err := copyFileContents(templateString, path.Join(outputDir, toBase)); err != nil {
-			return fmt.Errorf("Error while copying file bytes for '%s': %s", templateString, err.Error())
+		if stat, err := os.Stat(specFile); err == nil && stat.IsDir() {
+			return readSpecDir(specFile)
+		}
+		if content, err = ioutil.ReadFile(specFile); err != nil {
+			return nil, fmt.Errorf("Could not read spec file: %s", err.Error())
 		}
 	}
-
-	info, err := os.Stat(templateString)
-	if err != nil {
-		return fmt.Errorf("Error while checking file permissions for '%s': %s", templateString, err.Error())
-	}
-	if err := os.Chmod(path.Join(outputDir, toBase), info.Mode()); err != nil {
-		return fmt.Errorf("Error while writing file permissions for '%s': %s", templateString, err.Error())
-	}
-
-	return nil
-}
-
-func process(templateString string, spec *map[string]interface{}, outputDir string, tf *templatefactory.TemplateFactory) error {
-	stat, err := os.Stat(templateString)
-	if err != nil {
-		return fmt.Errorf("Error processing template %s: %s", templateString, err.Error())
-	}
-	if stat.IsDir() {
-		return processDir(templateString, spec, outputDir, tf)
-	}
-	return processFile(templateString, spec, outputDir, tf)
-}
-
-func readSpecRaw(specFile string) ([]byte, error) {
-	if specFile == "-" {
-		return ioutil.ReadAll(os.Stdin)
-	}
-	content, err := ioutil.ReadFile(specFile)
-	if err != nil {
-		return nil, fmt.Errorf("Could not read spec file: %s", err.Error())
+	if content, err = decryptSpec(content); err != nil {
+		return nil, err
 	}
-	return content, nil
+	return convertSpec(content, specFile)
 }
 
 // Build an integer from a version string. The version string can contain 3 numbers and each number can be a maximum
@@ -229,11 +315,85 @@ func checkVersionIfNecessary(spec *map[string]interface{}) error {
 	return nil
 }
 
-func mainInner() error {
+func mainInner() (err error) {
 
 	// first set up config flag options
 	versionFlag := flag.Bool("version", false, "Print the version string")
 	editFlag := flag.Bool("edit", false, "Open the spec file in your $EDITOR before passing it on to the main routine")
+	gitInitFlag := flag.Bool("git-init", false, "Initialize a git repository in the generated output and commit it")
+	gitBranchFlag := flag.String("git-branch", "", "Render into a new branch of the git repository found at the generated output")
+	gitWorktreeFlag := flag.String("git-worktree", "", "With -git-branch: check the new branch out into a new worktree at this path and render there")
+	gitCommitFlag := flag.Bool("git-commit", false, "With -git-branch: commit the rendered changes to the new branch")
+	gitMessageFlag := flag.String("git-message", "", "The (templated) commit message used with -git-init or -git-commit")
+	k8sSchemasFlag := flag.String("k8s-schemas", "", "Validate rendered Kubernetes manifests against the JSON schemas and CRDs found in this directory")
+	helmFlag := flag.Bool("helm", false, "Expose the spec as .Values along with Helm style .Release and .Chart objects")
+	helmReleaseFlag := flag.String("helm-release", "", "The .Release.Name used with -helm (defaults to the template name)")
+	helmNamespaceFlag := flag.String("helm-namespace", "default", "The .Release.Namespace used with -helm")
+	allowNetworkFlag := flag.Bool("allow-network", false, "Allow template functions that need network access (eg: goLatestVersion)")
+	promptFlag := flag.Bool("prompt", false, "Ask for the template variables declared in its manifest that the spec does not set")
+	noInputFlag := flag.Bool("no-input", false, "Never prompt for input, template calls to 'ask' will fail instead")
+	filesFromFlag := flag.String("files-from", "", "Only render the template files listed one per line in this file, or on stdin with '-', eg: from 'git diff --name-only'")
+	normalizeNamesFlag := flag.String("normalize-names", nameFormNone, "Normalize the Unicode form of rendered file and directory names: nfc (composed, as Linux and Windows tools write them), nfd (decomposed) or none")
+	caseCollisionsFlag := flag.String("case-collisions", caseCollisionsWarn, "How to treat rendered paths that only differ by case, which collide on macOS and Windows: warn, error or ignore")
+	permErrorsFlag := flag.String("perm-errors", permErrorsFail, "How to treat failures to set file permissions: fail, warn or ignore")
+	flag.BoolVar(&offline, "offline", offline, "Forbid all network access: remote templates, network template functions, -webhook and telemetry, also enabled by $SPIRO_OFFLINE=true")
+	flag.BoolVar(&uniqueSpecKeys, "unique-keys", false, "Fail when a spec file sets the same key twice in a mapping instead of using the last value")
+	flag.StringVar(&sharedSnippetDirs, "snippets", sharedSnippetDirs, "Comma separated directories of snippets shared between templates, searched after the template's snippets directory, also read from $SPIRO_SNIPPETS")
+	flag.StringVar(&ageIdentityFile, "age-identity", ageIdentityFile, "The age identity file used to decrypt age encrypted spec files, also read from $SPIRO_AGE_IDENTITY")
+	sensitiveFlag := flag.String("sensitive", "", "Comma separated dotted spec keys whose values are redacted from logs, reports and saved answers")
+	ownerOnlyFlag := flag.Bool("output-owner-only", false, "Restrict generated files to 0600 (0700 if executable) and directories to 0700")
+	enableFuncsFlag := flag.String("enable-funcs", os.Getenv("SPIRO_ENABLE_FUNCS"), "Comma separated list of the only template functions that may be used, also read from $SPIRO_ENABLE_FUNCS")
+	disableFuncsFlag := flag.String("disable-funcs", os.Getenv("SPIRO_DISABLE_FUNCS"), "Comma separated list of template functions that may not be used, also read from $SPIRO_DISABLE_FUNCS")
+	traceFlag := flag.Bool("trace", false, "Write the output of the debugDump and typeOf template functions to stderr instead of the rendered files")
+	verboseFlag := flag.Bool("verbose", false, "Log every processed file and its timing instead of showing a progress bar")
+	flag.BoolVar(verboseFlag, "v", false, "Shorthand for -verbose")
+	quietFlag := flag.Bool("quiet", false, "Only log errors, without a progress bar, warnings or status lines")
+	logFormatFlag := flag.String("log-format", logFormatText, "The format of the log written to stderr: text or json (one object per line)")
+	var pluginDefinitions stringSliceFlag
+	flag.Var(&pluginDefinitions, "plugin", "Start an external function plugin given as name=command, its functions are called as name.function (repeatable)")
+	var matrixSpecs stringSliceFlag
+	var protectPatterns stringSliceFlag
+	var alsoOutputs stringSliceFlag
+	flag.Var(&alsoOutputs, "also-output", "Another output directory that the same render is written to, eg: a mounted deploy volume (repeatable)")
+	flag.Var(&protectPatterns, "protect", "A gitignore style pattern of existing output files that are never overwritten, eg: -protect '**/*.env' (repeatable)")
+	var extraSpecFiles stringSliceFlag
+	flag.Var(&extraSpecFiles, "spec", "A spec file deep merged over the spec file argument (which may then be omitted), later files win (repeatable)")
+	profileFlag := flag.String("profile", "", "Deep merge the spec's profiles.<name> map over the rest of the spec, eg: -profile prod")
+	specPathFlag := flag.String("spec-path", "", "Render with only the part of the spec at this jq style path, eg: -spec-path '.services[0]'")
+	var specOverrides []specOverride
+	flag.Var(specOverrideFlag{overrides: &specOverrides}, "set", "Set a string value in the spec as dotted.key=value, eg: -set project.name=foo (repeatable)")
+	flag.Var(specOverrideFlag{overrides: &specOverrides, json: true}, "set-json", "Set a JSON value in the spec as dotted.key=<json>, eg: -set-json ports=[80,443] (repeatable)")
+	flag.StringVar(&specFormat, "spec-format", "", "The format of the spec files: yaml, json, toml, json5, jsonc or cue (default: from the file extension, yaml otherwise)")
+	envPrefixFlag := flag.String("env-prefix", "", "Set a string value in the spec for every environment variable starting with this prefix, eg: -env-prefix SPIRO_VAR_")
+	flag.Var(&matrixSpecs, "matrix-specs", "Comma separated spec fragments to render the template once per fragment, repeat to render the cross-product")
+	strictFlag := flag.Bool("strict", false, "Fail when a null or missing value would be inserted into the output, in file names too")
+	htmlFlag := flag.Bool("html", false, "HTML escape values inserted by templates (html/template semantics) instead of inserting them as plain text")
+	tidyFlag := flag.Bool("tidy", false, "Tidy the whitespace of rendered files: drop lines holding only actions like {{ if }} or {{ end }}, trailing spaces and extra blank lines")
+	headerFlag := flag.Bool("header", false, "Add a 'Code generated by spiro ... DO NOT EDIT.' comment to the top of rendered files")
+	forceFlag := flag.Bool("force", false, "Overwrite existing output files whose content differs from the rendered template")
+	skipExistingFlag := flag.Bool("skip-existing", false, "Keep existing output files whose content differs from the rendered template")
+	promptOnConflictFlag := flag.Bool("prompt-on-conflict", false, "Ask whether to overwrite each existing output file whose content differs from the rendered template")
+	webhookFlag := flag.String("webhook", "", "POST a JSON report of the run (template, spec hash, generated files) to this URL after a successful generation")
+	stdoutAllFlag := flag.Bool("stdout-all", false, "Render every file in memory and print them all to stdout, each after a '--- filename ---' line, instead of writing an output directory")
+	saveAnswersFlag := flag.Bool("save-answers", false, "Write the spec used into "+answersFileName+" in the output directory (default: with -prompt, -edit or -replay)")
+	replayFlag := flag.Bool("replay", false, "Render again with the spec saved in the "+answersFileName+" of the output directory instead of a spec file")
+	generationManifestFlag := flag.Bool("generation-manifest", false, "Write "+generationManifestFileName+" recording the template and its git revision into the generated output")
+	watchFlag := flag.Bool("watch", false, "Render again whenever the template or spec files change, until interrupted (implies -force unless -skip-existing is given)")
+	waitFlag := flag.Duration("wait", 0, "How long to wait for another spiro run writing to the same output directory to finish, 0 waits as long as it takes")
+	noWaitFlag := flag.Bool("no-wait", false, "Fail right away when another spiro run is writing to the same output directory instead of waiting")
+	noRollbackFlag := flag.Bool("no-rollback", false, "Leave the files written so far in place when a run fails instead of restoring the output directory")
+	dryRunFlag := flag.Bool("dry-run", false, "List the files that would change in the output directory without writing anything")
+	exitCodeFlag := flag.Bool("exit-code", false, "With -dry-run or -output-patch: exit with status 2 if there are changes and 0 if the output is up to date")
+	checkJSONFlag := flag.Bool("json", false, "With check: write the diagnostics as an LSP style JSON object for editor plugins")
+	benchRunsFlag := flag.Int("bench-runs", 10, "With bench: how many times to render the template")
+	benchDiskFlag := flag.Bool("bench-disk", false, "With bench: write each run to a temporary directory instead of rendering in memory")
+	diffFlag := flag.Bool("diff", false, "Show a unified diff of the changes to the output directory instead of writing anything")
+	previewFlag := flag.Bool("preview", false, "Like -diff, but show the colored diff through $PAGER")
+	previewFileFlag := flag.String("preview-file", "", "Like -preview, but only show the change to this file, relative to the output directory")
+	outputPatchFlag := flag.String("output-patch", "", "Write the changes to the output directory as a patch file instead of applying them")
+	leftDelimFlag := flag.String("left-delim", "", "Start template actions with these characters instead of '{{', eg: for templates generating Helm charts (requires -right-delim)")
+	rightDelimFlag := flag.String("right-delim", "", "End template actions with these characters instead of '}}' (requires -left-delim)")
+	pipeFlag := flag.Bool("pipe", false, "Render a single template read from stdin with the spec files given as arguments and write the result to stdout")
 
 	// set a more verbose usage message.
 	flag.Usage = func() {
@@ -241,7 +401,30 @@ func mainInner() error {
 		flag.PrintDefaults()
 	}
 	// parse them
-	flag.Parse()
+	command, positional := splitSubcommand(os.Args[1:], func(args []string) []string {
+		flag.CommandLine.Parse(args)
+		return flag.Args()
+	})
+	if err := logs.configure(*quietFlag, *verboseFlag, *logFormatFlag); err != nil {
+		return err
+	}
+	if *envPrefixFlag != "" {
+		// values on the command line win over the environment
+		specOverrides = append(envSpecOverrides(*envPrefixFlag, os.Environ()), specOverrides...)
+	}
+	if (*leftDelimFlag == "") != (*rightDelimFlag == "") {
+		return fmt.Errorf("The -left-delim and -right-delim flags must be used together")
+	}
+	// delimiters given on the command line win over the ones set by the template manifest or the spec
+	setDelimiters := func(tf *templatefactory.TemplateFactory) error {
+		if *leftDelimFlag == "" {
+			return nil
+		}
+		return tf.SetDelimiters(*leftDelimFlag, *rightDelimFlag, true)
+	}
+	if offline && (*allowNetworkFlag || *webhookFlag != "") {
+		return fmt.Errorf("The -allow-network and -webhook flags need network access and cannot be used with -offline")
+	}
 
 	// do arg checking
 	if *versionFlag {
@@ -250,14 +433,317 @@ func mainInner() error {
 		fmt.Println("Project: github.com/AstromechZA/spiro")
 		return nil
 	}
-	if flag.NArg() != 3 {
+	if command == "init" {
+		if len(positional) != 1 {
+			flag.Usage()
+			os.Exit(1)
+		}
+		return initTemplate(positional[0])
+	}
+	if command == "funcs" {
+		if len(positional) != 0 {
+			flag.Usage()
+			os.Exit(1)
+		}
+		plugins, stopPlugins, err := startFunctionPlugins(pluginDefinitions)
+		if err != nil {
+			return err
+		}
+		defer stopPlugins()
+		tf := templatefactory.NewTemplateFactory()
+		err = registerTemplateFunctions(tf, templateFunctionContext{
+			revision: func() templateRevision { return templateRevision{} },
+			prompts:  newPrompter(false),
+		})
+		if err != nil {
+			return err
+		}
+		if err := registerFunctionPlugins(tf, plugins); err != nil {
+			return err
+		}
+		return printTemplateFunctions(os.Stdout, tf, *enableFuncsFlag, *disableFuncsFlag)
+	}
+	// without a spec, 'spiro validate' only checks that the template parses
+	lintOnly := command == "validate" && len(positional) == 1 && len(extraSpecFiles) == 0 && *envPrefixFlag == "" && !*replayFlag
+	if command == "test" || command == "bench" || command == "check" || command == "docs" || command == "vars" || lintOnly {
+		if len(positional) < 1 || len(positional) > 2 {
+			flag.Usage()
+			os.Exit(1)
+		}
+		inputTemplate, cleanup, err := resolveTemplate(positional[0])
+		if err != nil {
+			return err
+		}
+		defer cleanup()
+		var specFile string
+		if len(positional) == 2 {
+			specFile = positional[1]
+		}
+		plugins, stopPlugins, err := startFunctionPlugins(pluginDefinitions)
+		if err != nil {
+			return err
+		}
+		defer stopPlugins()
+		revision := lazyTemplateRevision(inputTemplate)
+		// only 'spiro bench' renders whole files, template tests have no other files to refer to
+		var outputs *renderedOutputs
+		if command == "bench" {
+			outputs = newRenderedOutputs()
+		}
+		setup := func(tf *templatefactory.TemplateFactory) error {
+			tf.SetHTMLEscaping(*htmlFlag)
+			tf.SetStrict(*strictFlag)
+			if err := setDelimiters(tf); err != nil {
+				return err
+			}
+			err := registerTemplateFunctions(tf, templateFunctionContext{
+				allowNetwork: *allowNetworkFlag,
+				specFile:     specFile,
+				revision:     revision,
+				prompts:      newPrompter(false),
+				outputs:      outputs,
+				snippets:     newSnippetLibrary(inputTemplate, tf),
+				trace:        *traceFlag,
+			})
+			if err != nil {
+				return err
+			}
+			if err := registerFunctionPlugins(tf, plugins); err != nil {
+				return err
+			}
+			return restrictTemplateFunctions(tf, *enableFuncsFlag, *disableFuncsFlag)
+		}
+		if lintOnly {
+			return runTemplateLint(inputTemplate, setup)
+		}
+		if command == "docs" || command == "vars" {
+			if specFile != "" {
+				flag.Usage()
+				os.Exit(1)
+			}
+			if command == "vars" {
+				return runTemplateVars(os.Stdout, inputTemplate, setup)
+			}
+			return runTemplateDocs(os.Stdout, positional[0], inputTemplate, setup)
+		}
+		if command == "check" {
+			return runTemplateCheck(os.Stdout, inputTemplate, specFile, *checkJSONFlag, setup)
+		}
+		if command == "bench" {
+			return runBenchmark(inputTemplate, specFile, *benchRunsFlag, *benchDiskFlag, outputs, setup)
+		}
+		return runTemplateTests(inputTemplate, specFile, setup)
+	}
+	if *pipeFlag {
+		if command != "" && command != "render" {
+			return fmt.Errorf("The -pipe flag cannot be used with 'spiro %s'", command)
+		}
+		if *replayFlag {
+			return fmt.Errorf("The -pipe flag cannot be used with -replay")
+		}
+		// every argument is a spec file, the template is read from stdin (so it has no revision and nothing can be
+		// asked for) and the result is written to stdout
+		var specFiles []string
+		for _, arg := range positional {
+			specFiles = append(specFiles, splitList(arg)...)
+		}
+		specFiles = append(specFiles, extraSpecFiles...)
+		for _, f := range specFiles {
+			if f == "-" {
+				return fmt.Errorf("The -pipe flag reads the template from stdin, so the spec cannot be read from stdin too")
+			}
+		}
+		specContents, err := readSpecFiles(specFiles)
+		if err != nil {
+			return err
+		}
+		spec, err := buildSpec(specContents, *profileFlag, *specPathFlag, specOverrides)
+		if err != nil {
+			return err
+		}
+		plugins, stopPlugins, err := startFunctionPlugins(pluginDefinitions)
+		if err != nil {
+			return err
+		}
+		defer stopPlugins()
+		return renderPipe(os.Stdin, os.Stdout, spec, func(tf *templatefactory.TemplateFactory) error {
+			tf.SetHTMLEscaping(*htmlFlag)
+			tf.SetStrict(*strictFlag)
+			if err := setDelimiters(tf); err != nil {
+				return err
+			}
+			err := registerTemplateFunctions(tf, templateFunctionContext{
+				allowNetwork: *allowNetworkFlag,
+				rawSpec:      string(specContents),
+				specFile:     strings.Join(specFiles, ","),
+				revision:     func() templateRevision { return templateRevision{} },
+				prompts:      newPrompter(false),
+				snippets:     newSnippetLibrary("", tf),
+				trace:        *traceFlag,
+			})
+			if err != nil {
+				return err
+			}
+			if err := registerFunctionPlugins(tf, plugins); err != nil {
+				return err
+			}
+			return restrictTemplateFunctions(tf, *enableFuncsFlag, *disableFuncsFlag)
+		})
+	}
+	validateOnly := command == "validate"
+	// -preview is a -diff with another way of showing it
+	preview := *previewFlag || *previewFileFlag != ""
+	if preview && *diffFlag {
+		return fmt.Errorf("The -preview and -diff flags cannot be used together")
+	}
+	if command == "diff" || preview {
+		*diffFlag = true
+	}
+	// 'spiro update' renders again with the saved answers and merges the result into the output directory
+	updating := command == "update"
+	if updating {
+		if len(positional) > 2 || len(extraSpecFiles) > 0 {
+			return fmt.Errorf("'spiro update' renders with the %s in the output directory, so no spec file can be given", answersFileName)
+		}
+		if *dryRunFlag || *diffFlag || *outputPatchFlag != "" || *gitInitFlag || *gitBranchFlag != "" || *watchFlag || len(alsoOutputs) > 0 || len(matrixSpecs) > 0 {
+			return fmt.Errorf("'spiro update' cannot be used with -dry-run, -diff, -output-patch, -git-init, -git-branch, -watch, -also-output or -matrix-specs")
+		}
+		*replayFlag = true
+	}
+	var outputDirectory string
+	if *stdoutAllFlag {
+		if command != "" && command != "render" {
+			return fmt.Errorf("The -stdout-all flag cannot be used with 'spiro %s'", command)
+		}
+		if *dryRunFlag || *diffFlag || *outputPatchFlag != "" || *gitInitFlag || *gitBranchFlag != "" || *watchFlag || *webhookFlag != "" || *replayFlag || len(alsoOutputs) > 0 {
+			return fmt.Errorf("The -stdout-all flag cannot be used with -dry-run, -diff, -output-patch, -git-init, -git-branch, -watch, -webhook, -replay or -also-output")
+		}
+		// nothing is written, the template is rendered in memory under stdoutRoot and printed
+		outputDirectory = stdoutRoot
+	} else if validateOnly {
+		// nothing is written, the template is rendered in memory under validateRoot
+		outputDirectory = validateRoot
+		if *dryRunFlag || *diffFlag || *outputPatchFlag != "" || *gitInitFlag || *gitBranchFlag != "" || *watchFlag || *webhookFlag != "" || len(alsoOutputs) > 0 {
+			return fmt.Errorf("'spiro validate' cannot be used with -dry-run, -diff, -output-patch, -git-init, -git-branch, -watch, -webhook or -also-output")
+		}
+	} else if len(positional) > 0 {
+		outputDirectory, positional = positional[len(positional)-1], positional[:len(positional)-1]
+	}
+	// the spec file argument can be left out when the spec comes from -spec flags, the environment or -replay
+	if len(positional) != 2 && (len(positional) != 1 || (len(extraSpecFiles) == 0 && *envPrefixFlag == "" && !*replayFlag)) {
 		flag.Usage()
 		os.Exit(1)
 	}
 
-	inputTemplate := flag.Arg(0)
-	specFile := flag.Arg(1)
-	outputDirectory := flag.Arg(2)
+	inputTemplate := positional[0]
+	var specFiles []string
+	if len(positional) == 2 {
+		specFiles = splitList(positional[1])
+	}
+	specFiles = append(specFiles, extraSpecFiles...)
+	if *replayFlag {
+		if len(specFiles) > 0 {
+			return fmt.Errorf("The -replay flag reads the spec from the %s in the output directory, so no spec file can be given", answersFileName)
+		}
+		if validateOnly || archiveFormat(outputDirectory) != "" || len(matrixSpecs) > 0 {
+			return fmt.Errorf("The -replay flag cannot be used with 'spiro validate', an output archive or -matrix-specs")
+		}
+		answersFile := path.Join(outputDirectory, answersFileName)
+		if _, err := os.Stat(answersFile); os.IsNotExist(err) {
+			return fmt.Errorf("There is no %s in '%s' to replay, it is written when rendering with -prompt, -edit or -save-answers", answersFileName, outputDirectory)
+		}
+		specFiles = []string{answersFile}
+	}
+	var base map[string][]byte
+	if updating {
+		if base, err = readBaseFile(outputDirectory); err != nil {
+			return err
+		}
+	}
+	// interactive runs save their answers unless asked not to
+	saveAnswers := *promptFlag || *editFlag || *replayFlag
+	flag.Visit(func(f *flag.Flag) {
+		if f.Name == "save-answers" {
+			saveAnswers = *saveAnswersFlag
+		}
+	})
+	specFile := strings.Join(specFiles, ",")
+	specFromStdin := false
+	for _, f := range specFiles {
+		if f == "-" && specFromStdin {
+			return fmt.Errorf("The spec can only be read from stdin once")
+		}
+		specFromStdin = specFromStdin || f == "-"
+	}
+
+	// an output path like out.tar.gz is written as an archive, the template is rendered in memory under archiveRoot
+	archive := archiveFormat(outputDirectory)
+	var archivePath string
+	if archive != "" {
+		if *dryRunFlag || *diffFlag || *outputPatchFlag != "" || *gitInitFlag || *gitBranchFlag != "" || *webhookFlag != "" {
+			return fmt.Errorf("An output archive cannot be used with -dry-run, -diff, -output-patch, -git-init, -git-branch or -webhook")
+		}
+		if err := checkArchiveOutput(outputDirectory, *forceFlag); err != nil {
+			return err
+		}
+		archivePath, outputDirectory = outputDirectory, archiveRoot
+	}
+
+	if (*gitInitFlag || *gitBranchFlag != "") && *outputPatchFlag != "" {
+		return fmt.Errorf("The -git-init and -git-branch flags cannot be used with -output-patch")
+	}
+	if (*gitInitFlag || *gitBranchFlag != "") && *dryRunFlag {
+		return fmt.Errorf("The -git-init and -git-branch flags cannot be used with -dry-run")
+	}
+	if (*gitInitFlag || *gitBranchFlag != "") && *diffFlag {
+		return fmt.Errorf("The -git-init and -git-branch flags cannot be used with -diff")
+	}
+	if *webhookFlag != "" && (*dryRunFlag || *diffFlag || *outputPatchFlag != "") {
+		return fmt.Errorf("The -webhook flag cannot be used with -dry-run, -diff or -output-patch")
+	}
+	if (*dryRunFlag && *outputPatchFlag != "") || (*diffFlag && (*dryRunFlag || *outputPatchFlag != "")) {
+		return fmt.Errorf("Only one of the -dry-run, -diff and -output-patch flags can be used")
+	}
+	if *exitCodeFlag && !*dryRunFlag && !*diffFlag && *outputPatchFlag == "" {
+		return fmt.Errorf("The -exit-code flag requires -dry-run, -diff or -output-patch")
+	}
+	if *gitInitFlag && *gitBranchFlag != "" {
+		return fmt.Errorf("The -git-init and -git-branch flags cannot be used together")
+	}
+	if len(matrixSpecs) > 0 && (*gitInitFlag || *gitBranchFlag != "") {
+		return fmt.Errorf("The -matrix-specs flag cannot be used with -git-init or -git-branch")
+	}
+	if *gitBranchFlag == "" && (*gitWorktreeFlag != "" || *gitCommitFlag) {
+		return fmt.Errorf("The -git-worktree and -git-commit flags require -git-branch")
+	}
+
+	if *filesFromFlag == "-" && (specFromStdin || *promptFlag || *promptOnConflictFlag || *watchFlag) {
+		return fmt.Errorf("The -files-from list cannot be read from stdin with -prompt, -prompt-on-conflict, -watch or a spec read from stdin")
+	}
+
+	if *watchFlag {
+		if *editFlag || specFromStdin || *promptFlag || *promptOnConflictFlag || *gitInitFlag || *gitBranchFlag != "" || *webhookFlag != "" {
+			return fmt.Errorf("The -watch flag cannot be used with -edit, -prompt, -prompt-on-conflict, -git-init, -git-branch, -webhook or a spec read from stdin")
+		}
+		if isRemoteTemplate(inputTemplate) {
+			return fmt.Errorf("The -watch flag requires a local template")
+		}
+		return watchAndRender(append([]string{inputTemplate}, specFiles...), outputDirectory, watchArgs(os.Args[1:], command, !*forceFlag && !*skipExistingFlag))
+	}
+
+	templateSource := inputTemplate
+	config, err := loadUserConfig()
+	if err != nil {
+		return err
+	}
+	defer func() {
+		sendTelemetry(config.Telemetry, templateSource, err == nil || err == errChangesPending)
+	}()
+	inputTemplate, cleanup, err := resolveTemplate(inputTemplate)
+	if err != nil {
+		return err
+	}
+	defer cleanup()
 
 	// ensure template files/dir exists
 	if _, err := os.Stat(inputTemplate); err != nil {
@@ -267,17 +753,29 @@ func mainInner() error {
 		return fmt.Errorf("Input template '%s' cannot be read! (%s)", inputTemplate, err.Error())
 	}
 
-	if specFile == "-" {
-		// DO NOTHING
-	} else if stat, err := os.Stat(specFile); err != nil {
-		if os.IsNotExist(err) {
-			return fmt.Errorf("Spec file '%s' does not exist!", specFile)
+	var only *fileSelection
+	if *filesFromFlag != "" {
+		if stat, err := os.Stat(inputTemplate); err == nil && !stat.IsDir() {
+			return fmt.Errorf("The -files-from flag requires a directory template")
+		}
+		if only, err = openFileSelection(*filesFromFlag, inputTemplate); err != nil {
+			return err
+		}
+	}
+
+	for _, specFile := range specFiles {
+		if specFile == "-" {
+			// DO NOTHING
+		} else if _, err := os.Stat(specFile); err != nil {
+			if os.IsNotExist(err) {
+				return fmt.Errorf("Spec file '%s' does not exist!", specFile)
+			}
+			return fmt.Errorf("Spec file '%s' cannot be read! (%s)", specFile, err.Error())
 		}
-		return fmt.Errorf("Spec file '%s' cannot be read! (%s)", specFile, err.Error())
-	} else if stat.IsDir() {
-		return fmt.Errorf("Spec file '%s' cannot be a directory!", specFile)
 	}
-	if stat, err := os.Stat(outputDirectory); err != nil {
+	if archive != "" || validateOnly || *stdoutAllFlag {
+		// DO NOTHING
+	} else if stat, err := os.Stat(outputDirectory); err != nil {
 		if os.IsNotExist(err) {
 			return fmt.Errorf("Output directory '%s' does not exist!", outputDirectory)
 		}
@@ -286,7 +784,7 @@ func mainInner() error {
 		return fmt.Errorf("Output directory '%s' cannot be a file!", specFile)
 	}
 
-	specContents, err := readSpecRaw(specFile)
+	specContents, err := readSpecFiles(specFiles)
 	if err != nil {
 		return err
 	}
@@ -338,39 +836,444 @@ func mainInner() error {
 			return fmt.Errorf("No save detected, you must save the file when using -edit")
 		}
 
-		specContents, err = readSpecRaw(tf.Name())
+		// the spec was already decrypted and converted before it was edited
+		specContents, err = ioutil.ReadFile(tf.Name())
 		if err != nil {
 			return err
 		}
 	}
 
-	var spec map[string]interface{}
-	dec := yaml.NewDecoder(bytes.NewReader(specContents))
-	err = dec.Decode(&spec)
+	spec, err := buildSpec(specContents, *profileFlag, *specPathFlag, specOverrides)
 	if err != nil {
-		return fmt.Errorf("Could not parse spec file: %s", err.Error())
+		return err
 	}
 
 	tf := templatefactory.NewTemplateFactory()
-	if err := tf.SetSpec(&spec); err != nil {
+	tf.SetHTMLEscaping(*htmlFlag)
+	tf.SetStrict(*strictFlag)
+	if err := setDelimiters(tf); err != nil {
+		return err
+	}
+	applySpec := func(spec map[string]interface{}) error {
+		if err := tf.SetSpec(&spec); err != nil {
+			return err
+		}
+		if *helmFlag {
+			// the delimiters have already been picked up from the real spec above
+			values := helmContext(spec, inputTemplate, *helmReleaseFlag, *helmNamespaceFlag)
+			return tf.SetSpec(&values)
+		}
+		return nil
+	}
+	if err := applySpec(spec); err != nil {
+		return err
+	}
+	revision := lazyTemplateRevision(inputTemplate)
+	// we can only prompt when stdin is a terminal that isn't already being used for the spec, unless -prompt asks us
+	// to read the answers from stdin anyway
+	prompts := newPrompter(!*noInputFlag && !validateOnly && !specFromStdin && *filesFromFlag != "-" && (stdinIsTerminal() || *promptFlag || *promptOnConflictFlag))
+	outputs := newRenderedOutputs()
+	err = registerTemplateFunctions(tf, templateFunctionContext{
+		allowNetwork: *allowNetworkFlag,
+		rawSpec:      string(specContents),
+		specFile:     specFile,
+		revision:     revision,
+		prompts:      prompts,
+		outputs:      outputs,
+		snippets:     newSnippetLibrary(inputTemplate, tf),
+		trace:        *traceFlag,
+	})
+	if err != nil {
+		return err
+	}
+	plugins, stopPlugins, err := startFunctionPlugins(pluginDefinitions)
+	if err != nil {
+		return err
+	}
+	defer stopPlugins()
+	if err := registerFunctionPlugins(tf, plugins); err != nil {
+		return err
+	}
+	if err := restrictTemplateFunctions(tf, *enableFuncsFlag, *disableFuncsFlag); err != nil {
+		return err
+	}
+
+	manifest, err := loadManifest(inputTemplate)
+	if err != nil {
+		return err
+	}
+	warnUndeclaredHooks(inputTemplate, manifest)
+	warnUndeclaredSpecSchema(inputTemplate, manifest)
+	if len(manifest.Delimiters) > 0 {
+		if err := manifest.withDelimiters(setDelimiters)(tf); err != nil {
+			return err
+		}
+		// the spec's _spiro_delimiters_ win over the manifest
+		if err := applySpec(spec); err != nil {
+			return err
+		}
+	}
+	if *promptFlag && specFromStdin {
+		return fmt.Errorf("The -prompt flag cannot be used when the spec is read from stdin")
+	}
+	var problems []string
+	if validateOnly {
+		if problems, err = lintTemplate(inputTemplate, tf, manifest); err != nil {
+			return err
+		} else if len(problems) > 0 {
+			return lintError(templateSource, problems)
+		}
+	}
+	if err := applyTemplateVariables(spec, manifest.Variables, prompts, *promptFlag); err != nil {
+		return err
+	}
+
+	var sink outputSink = diskSink{}
+	var patchSink, archiveSink, stdoutSink, updateSink *memorySink
+	var plan *actionPlan
+	if *outputPatchFlag != "" || *dryRunFlag || *diffFlag {
+		patchSink = newMemorySink()
+		sink = patchSink
+	} else if archive != "" {
+		archiveSink = newMemorySink()
+		sink = archiveSink
+	} else if *stdoutAllFlag {
+		stdoutSink = newMemorySink()
+		sink = stdoutSink
+	} else if updating {
+		// the render is merged into the output directory once it is complete
+		updateSink = newMemorySink()
+		sink = updateSink
+	} else if validateOnly {
+		sink = newMemorySink()
+	}
+	inMemory := patchSink != nil || archiveSink != nil || stdoutSink != nil || updateSink != nil || validateOnly
+	destinations, err := outputDestinations(alsoOutputs, manifest.Destinations)
+	if err != nil {
+		return err
+	}
+	if !inMemory || updating {
+		// concurrent runs writing to the same output directory would interleave their writes, the lock is released
+		// after a failed run has been rolled back
+		for _, dir := range append([]string{outputDirectory}, destinations...) {
+			unlock, err := lockOutput(dir, *waitFlag, *noWaitFlag)
+			if err != nil {
+				return err
+			}
+			defer unlock()
+		}
+	}
+	// tx records the changes of the run, it is nil when they are not rolled back
+	var tx *transactionSink
+	if !inMemory && !*noRollbackFlag {
+		// a failed run puts the output directory back the way it was
+		tx = newTransactionSink(sink)
+		sink = tx
+		defer func() {
+			if err != nil && err != errChangesPending {
+				rollbackOutput(tx)
+			}
+		}()
+	}
+	if *dryRunFlag || *webhookFlag != "" {
+		plan = &actionPlan{}
+	}
+	if sink, err = newPermPolicySink(sink, *permErrorsFlag); err != nil {
+		return err
+	}
+	collisions, err := newCaseCollisions(*caseCollisionsFlag)
+	if err != nil {
+		return err
+	}
+	names, err := newNameNormalizer(*normalizeNamesFlag)
+	if err != nil {
+		return err
+	}
+	overwrite, err := newOverwritePolicy(*forceFlag, *skipExistingFlag, *promptOnConflictFlag, prompts)
+	if err != nil {
+		return err
+	}
+	if inMemory || (*gitBranchFlag != "" && overwrite.mode == overwriteFail) {
+		// nothing is written with -dry-run or -output-patch, archives are always new, and -git-branch changes are
+		// reviewed on their own branch
+		overwrite = nil
+	}
+	if *ownerOnlyFlag {
+		sink = &ownerOnlySink{outputSink: sink}
+	}
+	protect, err := newIgnoreRules(protectPatterns)
+	if err != nil {
+		return err
+	}
+	var fanout *fanoutSink
+	if len(destinations) > 0 {
+		if inMemory || *gitInitFlag || *gitBranchFlag != "" {
+			return fmt.Errorf("Output destinations cannot be used with an output archive, -dry-run, -diff, -output-patch, -stdout-all, -git-init or -git-branch")
+		}
+		fanout = newFanoutSink(sink, outputDirectory, destinations, overwrite, protect)
+		sink = fanout
+	}
+	var manifests *captureSink
+	if *k8sSchemasFlag != "" {
+		manifests = newCaptureSink(sink, isYAMLFile)
+		sink = manifests
+	}
+	var rendered *captureSink
+	if saveAnswers && !validateOnly && stdoutSink == nil {
+		// the files as rendered are saved as the base that 'spiro update' merges the next render with
+		rendered = newCaptureSink(sink, isBaseFile)
+		sink = rendered
+	}
+
+	runs := []matrixRun{{Spec: spec}}
+	if len(matrixSpecs) > 0 {
+		// the fragments are merged into the spec file before the -profile, -spec-path and -set flags are applied
+		base, err := buildSpec(specContents, "", "", nil)
+		if err != nil {
+			return err
+		}
+		refine := func(spec map[string]interface{}) (map[string]interface{}, error) {
+			return refineSpec(spec, *profileFlag, *specPathFlag, specOverrides)
+		}
+		if runs, err = buildMatrix(base, matrixSpecs, refine); err != nil {
+			return err
+		}
+		if err := fillMatrixVariables(runs, spec, manifest.Variables); err != nil {
+			return err
+		}
+	}
+	sensitive := append(splitList(*sensitiveFlag), manifest.Sensitive...)
+	redact := newRedactor(sensitive, runs)
+	specSchema, err := loadSpecSchema(inputTemplate, manifest)
+	if err != nil {
 		return err
 	}
-	tf.RegisterTemplateFunction("title", strings.Title)
-	tf.RegisterTemplateFunction("lower", strings.ToLower)
-	tf.RegisterTemplateFunction("upper", strings.ToUpper)
-	tf.RegisterTemplateFunction("now", time.Now)
-	tf.RegisterTemplateFunction("json", Jsonify)
-	tf.RegisterTemplateFunction("jsonindent", JsonifyIndent)
-	tf.RegisterTemplateFunction("unescape", Unescape)
-	tf.RegisterTemplateFunction("stringreplace", StringReplace)
-	tf.RegisterTemplateFunction("regexreplace", RegexReplace)
-	tf.RegisterTemplateFunction("add", Add)
-	return process(inputTemplate, &spec, outputDirectory, tf)
+	if err := validateSpecs(specSchema, runs); err != nil {
+		return redact.Error(err)
+	}
+	for _, warning := range manifest.deprecationWarnings(runs) {
+		logs.Warnf("%s", warning)
+	}
+
+	var gitDir string
+	if *gitBranchFlag != "" {
+		if gitDir, err = gitPrepareBranch(inputTemplate, outputDirectory, *gitBranchFlag, *gitWorktreeFlag, tf); err != nil {
+			return err
+		}
+	}
+
+	if *tidyFlag && manifest.Whitespace == nil {
+		manifest.Whitespace = &whitespaceConfig{}
+	}
+	if *headerFlag && manifest.Header == nil {
+		manifest.Header = &headerConfig{}
+	}
+	var headerFiles *ignoreRules
+	if manifest.Header != nil && len(manifest.Header.Files) > 0 {
+		if headerFiles, err = newIgnoreRules(manifest.Header.Files); err != nil {
+			return err
+		}
+	}
+
+	// per-file logging would scroll past too quickly on a terminal, so show a progress bar there unless asked not to
+	// the -diff output is meant to be read or piped, so it is not mixed with the per-file log unless asked for, and
+	// 'spiro validate' writes no files to log
+	// a json log is meant for machines, which get a line per file rather than a progress bar
+	verbose := *verboseFlag || ((!stderrIsTerminal() || *logFormatFlag == logFormatJSON) && !*diffFlag && !validateOnly && stdoutSink == nil)
+	var progress *progressBar
+	if !verbose && !*quietFlag && stderrIsTerminal() {
+		progress = newProgressBar(os.Stderr, 0)
+		logs.progress = progress
+		defer progress.Stop()
+	}
+	renderStart := time.Now()
+	for _, run := range runs {
+		runSpec := run.Spec
+		if err := applySpec(runSpec); err != nil {
+			return err
+		}
+		ignore, err := manifest.ignoreRules(tf)
+		if err != nil {
+			return err
+		}
+		p := &processor{
+			root: inputTemplate, tf: tf, metadata: manifest.metadata(), out: sink, ignore: ignore, verbose: verbose, progress: progress,
+			rewrites: manifest.Rewrite, postprocess: manifest.Postprocess, headerFiles: headerFiles, redact: redact,
+			plan: plan, overwrite: overwrite, outputs: outputs, foreach: manifest.Foreach, whitespace: manifest.Whitespace,
+			protect: protect, formatters: manifest.formatters, caseCollisions: collisions, names: names, only: only,
+		}
+		if validateOnly {
+			p.problems = &problems
+		}
+		if manifest.Header != nil {
+			version := manifest.Version
+			if version == "" {
+				version = revision().Describe
+			}
+			if p.header, err = manifest.Header.render(tf, inputTemplate, version); err != nil {
+				return err
+			}
+		}
+		progress.AddTotal(p.countFiles())
+		target := outputDirectory
+		if run.Name != "" {
+			target = path.Join(outputDirectory, run.Name)
+			p.logf("Rendering matrix entry '%s' into '%s/'", run.Name, target)
+			plan.add(plannedAction{Output: target, Dir: true})
+			if err := sink.MakeDir(target); err != nil {
+				return fmt.Errorf("Error while creating '%s': %s", target, err.Error())
+			}
+		}
+		root := gitDir
+		if *gitWorktreeFlag == "" {
+			if root, err = generatedRoot(inputTemplate, target, tf); err != nil {
+				return err
+			}
+		}
+		p.outRoot = root
+		if fanout != nil {
+			fanout.rel = p.outputRel
+		}
+		outputs.reset(root, target)
+		var migrations []templateMigration
+		if root != "" {
+			// regenerating a project reuses the answers it was generated with
+			previous, err := readGenerationManifest(root)
+			if err != nil {
+				return err
+			} else if previous != nil {
+				prompts.Recall(previous.Answers)
+				if migrations, err = migrateOutput(root, manifest, previous, tx, patchSink != nil); err != nil {
+					return err
+				}
+			}
+		}
+
+		hookDir := target
+		if *gitWorktreeFlag != "" {
+			hookDir = gitDir
+		}
+		if inMemory {
+			pre, _ := templateHookCommands(inputTemplate, manifest, "pre_gen")
+			post, _ := templateHookCommands(inputTemplate, manifest, "post_gen")
+			if len(pre)+len(post) > 0 && !validateOnly {
+				logs.Warnf("not running the template hooks when rendering to memory")
+			}
+		} else if err := runTemplateHooks(inputTemplate, manifest, "pre_gen", hookDir, runSpec, sensitive); err != nil {
+			return redact.Error(err)
+		}
+
+		if *gitWorktreeFlag != "" {
+			err = p.processInto(gitDir)
+		} else {
+			err = p.process(target)
+		}
+		if err == nil {
+			err = p.processDeferred()
+		}
+		if err != nil {
+			return redact.Error(err)
+		}
+		if err := runMigrationCommands(root, migrations); err != nil {
+			return err
+		}
+
+		if *generationManifestFlag && root != "" {
+			m := newGenerationManifest(templateSource, manifest.Version, revision(), redact.Answers(prompts.Answers()))
+			if err := writeGenerationManifest(sink, root, m); err != nil {
+				return err
+			}
+		}
+		if saveAnswers && !validateOnly && stdoutSink == nil {
+			if err := writeAnswersFile(sink, target, runSpec, sensitive); err != nil {
+				return err
+			}
+			if err := writeBaseFile(sink, target, rendered.Files); err != nil {
+				return err
+			}
+		}
+		if root != "" {
+			hookDir = root
+		}
+		if !inMemory {
+			if err := runTemplateHooks(inputTemplate, manifest, "post_gen", hookDir, runSpec, sensitive); err != nil {
+				return redact.Error(err)
+			}
+		}
+	}
+	progress.Finish()
+	logs.Debugf("Rendered the template in %s", time.Since(renderStart))
+	if len(problems) > 0 {
+		return redact.Error(lintError(templateSource, problems))
+	}
+	overwrite.printSummary(redact)
+
+	if manifests != nil {
+		if err := validateK8sManifests(*k8sSchemasFlag, manifests); err != nil {
+			return redact.Error(err)
+		}
+	}
+
+	switch {
+	case patchSink != nil:
+		changes, err := pendingChanges(outputDirectory, patchSink)
+		if err != nil {
+			return err
+		}
+		if *dryRunFlag {
+			reportPlan(plan, outputDirectory, changes, redact)
+		} else if preview {
+			if err := previewChanges(changes, *previewFileFlag); err != nil {
+				return err
+			}
+		} else if *diffFlag {
+			fmt.Print(buildPatch(changes))
+		} else if err := writePatch(changes, *outputPatchFlag); err != nil {
+			return err
+		}
+		if *exitCodeFlag && len(changes) > 0 {
+			return errChangesPending
+		}
+	case archiveSink != nil:
+		if err := writeArchive(archivePath, archive, outputDirectory, archiveSink); err != nil {
+			return err
+		}
+	case stdoutSink != nil:
+		if err := writeStdoutAll(os.Stdout, outputDirectory, stdoutSink); err != nil {
+			return err
+		}
+	case updateSink != nil:
+		if err := updateOutput(outputDirectory, updateSink, base, redact); err != nil {
+			return err
+		}
+	case validateOnly:
+		logs.Infof("The spec is valid for '%s'", templateSource)
+	case *gitCommitFlag:
+		if err := gitCommitBranch(gitDir, *gitBranchFlag, *gitMessageFlag, tf); err != nil {
+			return err
+		}
+	case *gitInitFlag:
+		if err := gitInitOutput(inputTemplate, outputDirectory, *gitMessageFlag, tf); err != nil {
+			return err
+		}
+	}
+
+	if *webhookFlag != "" {
+		report := newRunReport(templateSource, revision(), specContents, outputDirectory, plan, redact)
+		return postRunReport(*webhookFlag, report)
+	}
+	return nil
 }
 
+// errChangesPending is returned with -exit-code when the output directory is not up to date.
+var errChangesPending = errors.New("The output directory is not up to date with the template")
+
 func main() {
 	if err := mainInner(); err != nil {
-		os.Stderr.WriteString(err.Error() + "\n")
+		logs.Errorf("%s", err.Error())
+		if err == errChangesPending {
+			os.Exit(2)
+		}
 		os.Exit(1)
 	}
 }
@@ -0,0 +1,263 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/AstromechZA/spiro/engine"
+
+	yaml "gopkg.in/yaml.v2"
+
+	"github.com/AstromechZA/spiro/templatefactory"
+)
+
+// manifestFileName is the name of the optional manifest at the root of a directory template. The manifest configures
+// how the template is processed and is never copied to the output.
+const manifestFileName = "spiro.yaml"
+
+// templateManifest is the content of a template's spiro.yaml.
+type templateManifest struct {
+	// Version of the template, recorded in generation manifests and used to pick which migrations to run.
+	Version string `yaml:"version"`
+	// Deprecated marks the template as deprecated, a warning is shown whenever it is rendered.
+	Deprecated *templateDeprecation `yaml:"deprecated"`
+	// DeprecatedVariables maps dotted spec paths to a message shown when a spec sets them.
+	DeprecatedVariables map[string]string `yaml:"deprecated_variables"`
+	// Rewrite relocates rendered files by applying regular expression replacements to their output paths.
+	Rewrite []pathRewrite `yaml:"rewrite"`
+	// Postprocess lists template pipelines that the content of every rendered file is passed through.
+	Postprocess []postProcessStep `yaml:"postprocess"`
+	// Whitespace tidies the whitespace of rendered files.
+	Whitespace *whitespaceConfig `yaml:"whitespace"`
+	// Format maps gitignore style patterns to the built-in formatter or external command that rendered files matching
+	// them are formatted with, eg: '*.go': gofmt.
+	Format     map[string]string `yaml:"format"`
+	formatters []*fileFormatter
+	// Header adds a "generated file" comment to the top of rendered files.
+	Header *headerConfig `yaml:"header"`
+	// Tests are assertions on template expressions run by 'spiro test'.
+	Tests []templateTest `yaml:"tests"`
+	// Migrations upgrade output generated from older versions of the template.
+	Migrations []templateMigration `yaml:"migrations"`
+	// Ignore lists gitignore style patterns for template paths that should never be copied to the output.
+	Ignore []string `yaml:"ignore"`
+	// Include lists paths that are only rendered when a condition on the spec holds.
+	Include []conditionalInclude `yaml:"include"`
+	// When maps paths to the condition under which they are rendered, a more readable form of Include.
+	When map[string]string `yaml:"when"`
+	// Variables declares the spec values the template needs, with defaults and what to ask for with -prompt.
+	Variables []templateVariable `yaml:"variables"`
+	// Sensitive lists dotted spec paths whose values must never be shown in logs, reports or saved answers.
+	Sensitive []string `yaml:"sensitive"`
+	// Foreach maps template paths to a pipeline producing a list, the path is rendered once per element of the list.
+	Foreach map[string]string `yaml:"foreach"`
+	// Hooks are commands run before and after rendering, in addition to the scripts in the hooks directory. The hooks
+	// directory is only part of the template, rather than of its output, when the manifest has a hooks section.
+	Hooks *templateHooks `yaml:"hooks"`
+	// Snippets declares that the snippets directory holds the template's snippets, rather than being part of the
+	// output.
+	Snippets bool `yaml:"snippets"`
+	// SpecSchema declares that the spec schema file is the JSON Schema specs are validated against, rather than being
+	// part of the output.
+	SpecSchema bool `yaml:"spec_schema"`
+	// Delimiters replaces '{{' and '}}' as the characters that start and end template actions, eg: ['<%', '%>'] for a
+	// template generating Helm charts. The spec's _spiro_delimiters_ and the -left-delim and -right-delim flags win.
+	Delimiters []string `yaml:"delimiters"`
+	// Destinations maps names to more output directories that the same render is written to, like -also-output.
+	Destinations map[string]string `yaml:"destinations"`
+}
+
+// metadata returns the entries at the root of the template that belong to the template rather than to its output: the
+// manifest, ignore file and git repository, and the hooks and snippets directories when the manifest declares them.
+func (m *templateManifest) metadata() []string {
+	names := append([]string{}, engine.DefaultMetadata...)
+	if m.Hooks != nil {
+		names = append(names, hooksDirName)
+	}
+	if m.Snippets {
+		names = append(names, snippetsDirName)
+	}
+	if m.SpecSchema {
+		names = append(names, specSchemaFileName)
+	}
+	return names
+}
+
+// isMetadata reports whether an entry at the root of the template belongs to the template rather than to its output.
+func (m *templateManifest) isMetadata(name string) bool {
+	for _, metadata := range m.metadata() {
+		if name == metadata {
+			return true
+		}
+	}
+	return false
+}
+
+// pathRewrite replaces matches of the regular expression From in a rendered path (relative to the root of the generated
+// output) with To, which may refer to submatches as $1 or ${name}.
+type pathRewrite struct {
+	From    string `yaml:"from"`
+	To      string `yaml:"to"`
+	pattern *regexp.Regexp
+}
+
+// conditionalInclude includes the template paths matching Path (a gitignore style pattern) only when the template
+// pipeline When, such as '.use_docker' or 'eq .database "postgres"', is true for the spec. It can be written either as
+// a map with 'path' and 'when' keys or in the short form 'docker/ when .use_docker'.
+type conditionalInclude struct {
+	Path string `yaml:"path"`
+	When string `yaml:"when"`
+}
+
+func (c *conditionalInclude) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	var short string
+	if err := unmarshal(&short); err == nil {
+		parts := strings.SplitN(short, " when ", 2)
+		if len(parts) != 2 {
+			return fmt.Errorf("include rule '%s' should look like '<path> when <condition>'", short)
+		}
+		c.Path, c.When = strings.TrimSpace(parts[0]), strings.TrimSpace(parts[1])
+	} else {
+		type plain conditionalInclude
+		if err := unmarshal((*plain)(c)); err != nil {
+			return err
+		}
+	}
+	if c.Path == "" || c.When == "" {
+		return fmt.Errorf("include rules require both a path and a condition")
+	}
+	return nil
+}
+
+// ignoreRules builds the ignore rules for the current spec: the ignore patterns followed by the path of every include
+// rule whose condition does not hold.
+func (m *templateManifest) ignoreRules(tf *templatefactory.TemplateFactory) (*ignoreRules, error) {
+	patterns := append([]string{}, m.Ignore...)
+	for _, include := range m.Include {
+		ok, err := tf.Evaluate(include.When)
+		if err != nil {
+			return nil, fmt.Errorf("Error while evaluating the include condition for '%s': %s", include.Path, err.Error())
+		}
+		if !ok {
+			patterns = append(patterns, include.Path)
+		}
+	}
+	return newIgnoreRules(patterns)
+}
+
+// withDelimiters wraps a template factory setup function so that it also switches to the manifest delimiters, if any.
+// The setup function runs afterwards so that locked delimiters from the -left-delim and -right-delim flags win.
+func (m *templateManifest) withDelimiters(setup func(tf *templatefactory.TemplateFactory) error) func(tf *templatefactory.TemplateFactory) error {
+	if len(m.Delimiters) == 0 {
+		return setup
+	}
+	return func(tf *templatefactory.TemplateFactory) error {
+		if err := tf.SetDelimiters(m.Delimiters[0], m.Delimiters[1], false); err != nil {
+			return err
+		}
+		return setup(tf)
+	}
+}
+
+// loadManifest reads the manifest of a directory template. Templates without a manifest (and single file templates)
+// get an empty one. The patterns in the template's .spiroignore file come before the manifest ignore patterns.
+func loadManifest(inputTemplate string) (*templateManifest, error) {
+	manifest, err := readManifest(inputTemplate)
+	if err != nil {
+		return nil, err
+	}
+	if stat, err := os.Stat(inputTemplate); err == nil && stat.IsDir() {
+		patterns, err := readIgnoreFile(filepath.Join(inputTemplate, ignoreFileName))
+		if err != nil {
+			return nil, err
+		}
+		manifest.Ignore = append(patterns, manifest.Ignore...)
+	}
+	return manifest, nil
+}
+
+func readManifest(inputTemplate string) (*templateManifest, error) {
+	manifest := &templateManifest{}
+	if stat, err := os.Stat(inputTemplate); err != nil || !stat.IsDir() {
+		return manifest, nil
+	}
+	manifestPath := filepath.Join(inputTemplate, manifestFileName)
+	content, err := ioutil.ReadFile(manifestPath)
+	if os.IsNotExist(err) {
+		return manifest, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("Could not read template manifest '%s': %s", manifestPath, err.Error())
+	}
+	dec := yaml.NewDecoder(bytes.NewReader(content))
+	dec.SetStrict(true)
+	if err := dec.Decode(manifest); err != nil && err != io.EOF {
+		return nil, fmt.Errorf("Could not parse template manifest '%s': %s", manifestPath, err.Error())
+	}
+	if manifest.Version != "" {
+		if _, err := buildVersionInt(manifest.Version); err != nil {
+			return nil, fmt.Errorf("Invalid template manifest '%s': %s", manifestPath, err.Error())
+		}
+	}
+	for _, migration := range manifest.Migrations {
+		if _, err := buildVersionInt(migration.Version); err != nil || migration.Version == "" {
+			return nil, fmt.Errorf("Invalid template manifest '%s': migrations require a valid version", manifestPath)
+		}
+	}
+	for i := range manifest.Rewrite {
+		rewrite := &manifest.Rewrite[i]
+		if rewrite.pattern, err = regexp.Compile(rewrite.From); err != nil || rewrite.From == "" {
+			return nil, fmt.Errorf("Invalid template manifest '%s': rewrite rules require a valid 'from' regular expression", manifestPath)
+		}
+	}
+	if manifest.Delimiters != nil && (len(manifest.Delimiters) != 2 || manifest.Delimiters[0] == "" || manifest.Delimiters[1] == "") {
+		return nil, fmt.Errorf("Invalid template manifest '%s': delimiters requires a list of two non-empty strings", manifestPath)
+	}
+	for i := range manifest.Variables {
+		if err := manifest.Variables[i].validate(); err != nil {
+			return nil, fmt.Errorf("Invalid template manifest '%s': %s", manifestPath, err.Error())
+		}
+	}
+	paths := make([]string, 0, len(manifest.When))
+	for path := range manifest.When {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+	for _, path := range paths {
+		if path == "" || strings.TrimSpace(manifest.When[path]) == "" {
+			return nil, fmt.Errorf("Invalid template manifest '%s': 'when' rules require both a path and a condition", manifestPath)
+		}
+		manifest.Include = append(manifest.Include, conditionalInclude{Path: path, When: manifest.When[path]})
+	}
+	if manifest.Whitespace != nil && len(manifest.Whitespace.Files) > 0 {
+		if manifest.Whitespace.files, err = newIgnoreRules(manifest.Whitespace.Files); err != nil {
+			return nil, fmt.Errorf("Invalid template manifest '%s': %s", manifestPath, err.Error())
+		}
+	}
+	if manifest.formatters, err = newFileFormatters(manifest.Format); err != nil {
+		return nil, fmt.Errorf("Invalid template manifest '%s': %s", manifestPath, err.Error())
+	}
+	for path, pipeline := range manifest.Foreach {
+		if path == "" || strings.TrimSpace(pipeline) == "" {
+			return nil, fmt.Errorf("Invalid template manifest '%s': 'foreach' rules require both a path and a list", manifestPath)
+		}
+		if _, err := os.Stat(filepath.Join(inputTemplate, filepath.FromSlash(path))); err != nil {
+			return nil, fmt.Errorf("Invalid template manifest '%s': the foreach path '%s' does not exist in the template", manifestPath, path)
+		}
+	}
+	// check the patterns up front so that mistakes are reported before anything is written
+	patterns := append([]string{}, manifest.Ignore...)
+	for _, include := range manifest.Include {
+		patterns = append(patterns, include.Path)
+	}
+	if _, err := newIgnoreRules(patterns); err != nil {
+		return nil, fmt.Errorf("Invalid template manifest '%s': %s", manifestPath, err.Error())
+	}
+	return manifest, nil
+}
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+)
+
+// matrixRun is a single render of a matrix: the merged spec and the subfolder of the output directory it is written
+// to.
+type matrixRun struct {
+	Name string
+	Spec map[string]interface{}
+}
+
+// buildMatrix expands the -matrix-specs axes into the runs to render. Each axis is a comma separated list of spec
+// fragments and every combination of one fragment per axis produces a run whose spec is the fragments deep merged, in
+// axis order, over the base spec. Runs are named by joining the fragment file names (without extensions) with '-',
+// eg: '-matrix-specs dev.yaml,prod.yaml -matrix-specs eu.yaml,us.yaml' renders dev-eu, dev-us, prod-eu and prod-us.
+// The base is the spec as decoded, refine then applies the -profile, -spec-path and -set flags to each merged spec so
+// that they win over the fragments like they win over the spec file.
+func buildMatrix(base map[string]interface{}, axes []string, refine func(map[string]interface{}) (map[string]interface{}, error)) ([]matrixRun, error) {
+	runs := []matrixRun{{Spec: base}}
+	// sources holds the fragment files each run was merged from, to report runs that would share a subfolder
+	sources := []string{""}
+	loaded := make(map[string]map[string]interface{})
+	for _, axis := range axes {
+		var names, paths []string
+		var fragments []map[string]interface{}
+		for _, fragment := range strings.Split(axis, ",") {
+			fragment = strings.TrimSpace(fragment)
+			if fragment == "" {
+				continue
+			}
+			fragmentSpec, ok := loaded[fragment]
+			if !ok {
+				var err error
+				if fragmentSpec, err = loadSpecFile(fragment); err != nil {
+					return nil, err
+				}
+				loaded[fragment] = fragmentSpec
+			}
+			names = append(names, strings.TrimSuffix(filepath.Base(fragment), filepath.Ext(fragment)))
+			paths = append(paths, fragment)
+			fragments = append(fragments, fragmentSpec)
+		}
+
+		var next []matrixRun
+		var nextSources []string
+		for r, run := range runs {
+			for i, fragmentSpec := range fragments {
+				merged := matrixRun{Name: names[i], Spec: mergeSpecs(run.Spec, fragmentSpec)}
+				source := paths[i]
+				if run.Name != "" {
+					merged.Name = run.Name + "-" + names[i]
+					source = sources[r] + ", " + paths[i]
+				}
+				next = append(next, merged)
+				nextSources = append(nextSources, source)
+			}
+		}
+		runs, sources = next, nextSources
+	}
+	named := make(map[string]int, len(runs))
+	for i, run := range runs {
+		if j, ok := named[run.Name]; ok {
+			return nil, fmt.Errorf("The -matrix-specs runs for '%s' and '%s' would both render into the subfolder '%s', give the fragment files different names", sources[j], sources[i], run.Name)
+		}
+		named[run.Name] = i
+	}
+	for i := range runs {
+		// the merged specs share the maps that no fragment changed, refine gets a copy of its own to set values in
+		spec, err := refine(normalizeSpecValue(runs[i].Spec).(map[string]interface{}))
+		if err != nil {
+			return nil, err
+		}
+		runs[i].Spec = spec
+	}
+	return runs, nil
+}
+
+// fillMatrixVariables gives the declared variables that a run's spec doesn't set the value they got in the base spec,
+// from its default or by prompting, so that the user is asked once rather than once per run.
+func fillMatrixVariables(runs []matrixRun, base map[string]interface{}, variables []templateVariable) error {
+	for _, run := range runs {
+		for _, v := range variables {
+			if _, ok := lookupSpecPath(run.Spec, v.Name); ok {
+				continue
+			}
+			if value, ok := lookupSpecPath(base, v.Name); ok {
+				if err := setSpecPath(run.Spec, v.Name, value); err != nil {
+					return fmt.Errorf("Error while setting template variable '%s' for '%s': %s", v.Name, run.Name, err.Error())
+				}
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,148 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// templateMigration upgrades previously generated output to a newer template version. Files are renamed, then deleted,
+// before the template is rendered. The commands run with the output root as working directory once it has been
+// rendered.
+type templateMigration struct {
+	// Version is the template version the migration upgrades to.
+	Version string            `yaml:"version"`
+	Rename  map[string]string `yaml:"rename"`
+	Delete  []string          `yaml:"delete"`
+	Run     []string          `yaml:"run"`
+}
+
+// pendingMigrations returns the migrations needed to upgrade output generated from template version 'from' to the
+// current template version, in version order.
+func (m *templateManifest) pendingMigrations(from string) ([]templateMigration, error) {
+	fromValue, err := buildVersionInt(from)
+	if err != nil {
+		return nil, err
+	}
+	toValue, err := buildVersionInt(m.Version)
+	if err != nil {
+		return nil, err
+	}
+	var out []templateMigration
+	for _, migration := range m.Migrations {
+		v, err := buildVersionInt(migration.Version)
+		if err != nil {
+			return nil, err
+		}
+		if v > fromValue && v <= toValue {
+			out = append(out, migration)
+		}
+	}
+	sort.SliceStable(out, func(i, j int) bool {
+		a, _ := buildVersionInt(out[i].Version)
+		b, _ := buildVersionInt(out[j].Version)
+		return a < b
+	})
+	return out, nil
+}
+
+// migrationPath returns the path of a file named by a migration, which must stay inside the generated output at root.
+func migrationPath(root string, migration templateMigration, name string) (string, error) {
+	clean := filepath.Clean(filepath.FromSlash(name))
+	if filepath.IsAbs(clean) || filepath.VolumeName(clean) != "" || clean == "." || clean == ".." || strings.HasPrefix(clean, ".."+string(filepath.Separator)) {
+		return "", fmt.Errorf("Error while migrating to %s: '%s' is not a path inside the generated output", migration.Version, name)
+	}
+	return filepath.Join(root, clean), nil
+}
+
+// runMigration renames and deletes the files of a single migration in the generated output at root. The changes are
+// recorded by tx so that they are rolled back with the render if it fails.
+func runMigration(root string, migration templateMigration, tx *transactionSink) error {
+	logs.Infof("Migrating '%s' to template version %s", root, migration.Version)
+	froms := make([]string, 0, len(migration.Rename))
+	for from := range migration.Rename {
+		froms = append(froms, from)
+	}
+	sort.Strings(froms)
+	renames := make([][2]string, 0, len(froms))
+	for _, from := range froms {
+		src, err := migrationPath(root, migration, from)
+		if err != nil {
+			return err
+		}
+		dst, err := migrationPath(root, migration, migration.Rename[from])
+		if err != nil {
+			return err
+		}
+		renames = append(renames, [2]string{src, dst})
+	}
+	deletes := make([]string, 0, len(migration.Delete))
+	for _, item := range migration.Delete {
+		file, err := migrationPath(root, migration, item)
+		if err != nil {
+			return err
+		}
+		deletes = append(deletes, file)
+	}
+
+	for _, rename := range renames {
+		if _, err := os.Lstat(longPath(rename[0])); os.IsNotExist(err) {
+			continue
+		}
+		if err := tx.rename(rename[0], rename[1]); err != nil {
+			return fmt.Errorf("Error while migrating to %s: %s", migration.Version, err.Error())
+		}
+	}
+	for _, file := range deletes {
+		if err := tx.removeAll(file); err != nil {
+			return fmt.Errorf("Error while migrating to %s: %s", migration.Version, err.Error())
+		}
+	}
+	return nil
+}
+
+// runMigrationCommands runs the commands of the migrations with the output root as working directory.
+func runMigrationCommands(root string, migrations []templateMigration) error {
+	for _, migration := range migrations {
+		for _, command := range migration.Run {
+			cmd := exec.Command("sh", "-c", command)
+			cmd.Dir = root
+			cmd.Stdout = os.Stderr
+			cmd.Stderr = os.Stderr
+			if err := cmd.Run(); err != nil {
+				return fmt.Errorf("Error while migrating to %s: command '%s' failed: %s", migration.Version, command, err.Error())
+			}
+		}
+	}
+	return nil
+}
+
+// migrateOutput runs the migrations needed to bring output generated from an older template version up to date. Output
+// without a recorded template version is left alone. Files are renamed and deleted before rendering, through tx so that
+// a failed render rolls them back too. Commands cannot be rolled back, so the migrations are returned for
+// runMigrationCommands to run once the render has succeeded. Migrations change the output directory directly, so they
+// are only listed when rendering to memory (-dry-run and -output-patch).
+func migrateOutput(root string, manifest *templateManifest, previous *generationManifest, tx *transactionSink, inMemory bool) ([]templateMigration, error) {
+	if manifest.Version == "" || previous.TemplateVersion == "" {
+		return nil, nil
+	}
+	migrations, err := manifest.pendingMigrations(previous.TemplateVersion)
+	if err != nil {
+		return nil, err
+	}
+	if inMemory {
+		for _, migration := range migrations {
+			logs.Warnf("not running the migration to template version %s when rendering to memory", migration.Version)
+		}
+		return nil, nil
+	}
+	for _, migration := range migrations {
+		if err := runMigration(root, migration, tx); err != nil {
+			return nil, err
+		}
+	}
+	return migrations, nil
+}
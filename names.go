@@ -0,0 +1,52 @@
+package main
+
+import (
+	"fmt"
+	"unicode/utf8"
+
+	"golang.org/x/text/unicode/norm"
+)
+
+const (
+	nameFormNone = "none"
+	nameFormNFC  = "nfc"
+	nameFormNFD  = "nfd"
+)
+
+// nameNormalizer brings rendered file and directory names into one Unicode normalization form. Non-ASCII values from
+// the spec can be composed ('é' as a single code point, NFC, which Linux and Windows tools usually produce) or
+// decomposed ('e' followed by a combining accent, NFD, as older macOS filesystems store names), and the same visible
+// name in two forms is two different files on Linux. A nil normalizer leaves names alone.
+type nameNormalizer struct {
+	form norm.Form
+	// warned records the names that are not valid UTF-8, they are only reported once
+	warned map[string]bool
+}
+
+func newNameNormalizer(form string) (*nameNormalizer, error) {
+	switch form {
+	case nameFormNone:
+		return nil, nil
+	case nameFormNFC:
+		return &nameNormalizer{form: norm.NFC, warned: make(map[string]bool)}, nil
+	case nameFormNFD:
+		return &nameNormalizer{form: norm.NFD, warned: make(map[string]bool)}, nil
+	}
+	return nil, fmt.Errorf("Invalid -normalize-names value '%s', expected one of none, nfc, nfd", form)
+}
+
+// normalize returns the name in the normalization form. Names that are not valid UTF-8, eg: rendered from Latin-1
+// spec values, can't be normalized and are returned unchanged with a warning.
+func (n *nameNormalizer) normalize(name string, redact *redactor) string {
+	if n == nil {
+		return name
+	}
+	if !utf8.ValidString(name) {
+		if !n.warned[name] {
+			n.warned[name] = true
+			logs.Warnf("the rendered name '%s' is not valid UTF-8 and was not normalized", redact.Redact(fmt.Sprintf("%q", name)))
+		}
+		return name
+	}
+	return n.form.String(name)
+}
@@ -0,0 +1,115 @@
+package main
+
+import (
+	"fmt"
+	"math/big"
+	"net"
+)
+
+// ipToInt converts an IP address to an integer, along with its length in bits (32 for IPv4, 128 for IPv6).
+func ipToInt(ip net.IP) (*big.Int, int) {
+	if v4 := ip.To4(); v4 != nil {
+		return new(big.Int).SetBytes(v4), 32
+	}
+	return new(big.Int).SetBytes(ip.To16()), 128
+}
+
+// intToIP converts an integer back into an IP address of the given length in bits, failing when it does not fit.
+func intToIP(n *big.Int, bits int) (net.IP, error) {
+	if n.Sign() < 0 || n.BitLen() > bits {
+		if bits == 32 {
+			return nil, fmt.Errorf("address is outside of the IPv4 address space")
+		}
+		return nil, fmt.Errorf("address is outside of the IPv6 address space")
+	}
+	buf := n.Bytes()
+	ip := make(net.IP, bits/8)
+	copy(ip[len(ip)-len(buf):], buf)
+	return ip, nil
+}
+
+// parseCIDR parses a prefix such as "10.0.0.0/16", returning its network address as an integer along with the prefix
+// length and the address length in bits.
+func parseCIDR(prefix string) (*big.Int, int, int, error) {
+	_, network, err := net.ParseCIDR(prefix)
+	if err != nil {
+		return nil, 0, 0, fmt.Errorf("invalid CIDR prefix '%s'", prefix)
+	}
+	ones, _ := network.Mask.Size()
+	base, bits := ipToInt(network.IP)
+	return base, ones, bits, nil
+}
+
+// CidrHost returns the address of the given host number within a CIDR prefix, like Terraform's cidrhost. Negative
+// host numbers count back from the end of the range, eg: cidrhost "10.0.0.0/24" -1 -> "10.0.0.255".
+func CidrHost(prefix string, hostnum interface{}) (string, error) {
+	host, err := toInt64(hostnum)
+	if err != nil {
+		return "", err
+	}
+	base, ones, bits, err := parseCIDR(prefix)
+	if err != nil {
+		return "", err
+	}
+	size := new(big.Int).Lsh(big.NewInt(1), uint(bits-ones))
+	offset := big.NewInt(host)
+	if host < 0 {
+		offset.Add(offset, size)
+	}
+	if offset.Sign() < 0 || offset.Cmp(size) >= 0 {
+		return "", fmt.Errorf("prefix '%s' has no host number %d", prefix, host)
+	}
+	ip, err := intToIP(base.Add(base, offset), bits)
+	if err != nil {
+		return "", err
+	}
+	return ip.String(), nil
+}
+
+// CidrSubnet extends a CIDR prefix by newbits and returns the netnum'th subnet, like Terraform's cidrsubnet, eg:
+// cidrsubnet "10.0.0.0/16" 8 2 -> "10.0.2.0/24".
+func CidrSubnet(prefix string, newbits interface{}, netnum interface{}) (string, error) {
+	extra, err := toInt64(newbits)
+	if err != nil {
+		return "", err
+	}
+	num, err := toInt64(netnum)
+	if err != nil {
+		return "", err
+	}
+	base, ones, bits, err := parseCIDR(prefix)
+	if err != nil {
+		return "", err
+	}
+	newOnes := ones + int(extra)
+	if extra < 0 || newOnes > bits {
+		return "", fmt.Errorf("cannot extend prefix '%s' by %d bits", prefix, extra)
+	}
+	if num < 0 || big.NewInt(num).BitLen() > int(extra) {
+		return "", fmt.Errorf("prefix '%s' extended by %d bits has no network number %d", prefix, extra, num)
+	}
+	offset := new(big.Int).Lsh(big.NewInt(num), uint(bits-newOnes))
+	ip, err := intToIP(base.Add(base, offset), bits)
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%s/%d", ip.String(), newOnes), nil
+}
+
+// IPAdd adds a (possibly negative) number to an IP address, eg: ipAdd "10.0.0.255" 1 -> "10.0.1.0".
+func IPAdd(address string, n interface{}) (string, error) {
+	delta, err := toInt64(n)
+	if err != nil {
+		return "", err
+	}
+	ip := net.ParseIP(address)
+	if ip == nil {
+		return "", fmt.Errorf("invalid IP address '%s'", address)
+	}
+	value, bits := ipToInt(ip)
+	result, err := intToIP(value.Add(value, big.NewInt(delta)), bits)
+	if err != nil {
+		return "", err
+	}
+	return result.String(), nil
+}
@@ -0,0 +1,127 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// toFloat64 converts any number into a float64.
+func toFloat64(in interface{}) (float64, error) {
+	i, f, isFloat, err := toNumber(in)
+	if err != nil {
+		return 0, err
+	}
+	if !isFloat {
+		f = float64(i)
+	}
+	return f, nil
+}
+
+// FormatNumber formats a number with a printf style format, converting it to suit the verb so that integer verbs
+// (%d, %x, %o, %b) work with whole floats and float verbs (%f, %e, %g) work with integers, eg: formatNumber "%.2f" 3 ->
+// "3.00".
+func FormatNumber(format string, in interface{}) (string, error) {
+	verb := ' '
+	if start := strings.LastIndex(format, "%"); start >= 0 {
+		if end := strings.IndexFunc(format[start+1:], unicode.IsLetter); end >= 0 {
+			verb = rune(format[start+1+end])
+		}
+	}
+	if !strings.ContainsRune("dxXobfFeEgG", verb) {
+		return "", fmt.Errorf("format '%s' has no numeric verb", format)
+	}
+	if strings.ContainsRune("dxXob", verb) {
+		i, err := toInt64(in)
+		if err != nil {
+			return "", err
+		}
+		return fmt.Sprintf(format, i), nil
+	}
+	f, err := toFloat64(in)
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf(format, f), nil
+}
+
+// HumanBytes formats a number of bytes with binary units and one decimal place, eg: 1536 -> "1.5 KiB".
+func HumanBytes(in interface{}) (string, error) {
+	f, err := toFloat64(in)
+	if err != nil {
+		return "", err
+	}
+	if math.Abs(f) < 1024 {
+		return fmt.Sprintf("%d B", int64(f)), nil
+	}
+	units := []string{"KiB", "MiB", "GiB", "TiB", "PiB", "EiB"}
+	unit := -1
+	// compare the value as it will be printed, 1048575 bytes is 1023.999 KiB but shown as 1 MiB rather than 1024 KiB
+	for math.Abs(math.Round(f*10)/10) >= 1024 && unit < len(units)-1 {
+		f /= 1024
+		unit++
+	}
+	return strings.Replace(fmt.Sprintf("%.1f %s", f, units[unit]), ".0 ", " ", 1), nil
+}
+
+// Thousands adds a separator (default ",") between every group of three digits in the whole part of a number, eg:
+// 1234567.5 -> "1,234,567.5".
+func Thousands(in interface{}, separator ...string) (string, error) {
+	sep := ","
+	if len(separator) > 0 {
+		sep = separator[0]
+	}
+	i, f, isFloat, err := toNumber(in)
+	if err != nil {
+		return "", err
+	}
+	s := strconv.FormatInt(i, 10)
+	if isFloat {
+		s = strconv.FormatFloat(f, 'f', -1, 64)
+	}
+	sign := ""
+	if strings.HasPrefix(s, "-") {
+		sign, s = "-", s[1:]
+	}
+	whole, fraction := s, ""
+	if dot := strings.Index(s, "."); dot >= 0 {
+		whole, fraction = s[:dot], s[dot:]
+	}
+	var groups []string
+	for len(whole) > 3 {
+		groups = append([]string{whole[len(whole)-3:]}, groups...)
+		whole = whole[:len(whole)-3]
+	}
+	groups = append([]string{whole}, groups...)
+	return sign + strings.Join(groups, sep) + fraction, nil
+}
+
+// Ordinal adds the English ordinal suffix to an integer, eg: 1 -> "1st", 12 -> "12th", 23 -> "23rd".
+func Ordinal(in interface{}) (string, error) {
+	n, err := toInt64(in)
+	if err != nil {
+		return "", err
+	}
+	lastTwo := n % 100
+	if lastTwo < 0 {
+		lastTwo = -lastTwo
+	}
+	return fmt.Sprintf("%d%s", n, ordinalSuffix(lastTwo)), nil
+}
+
+func ordinalSuffix(lastTwo int64) string {
+	if lastTwo >= 11 && lastTwo <= 13 {
+		return "th"
+	}
+	switch lastTwo % 10 {
+	case 1:
+		return "st"
+	case 2:
+		return "nd"
+	case 3:
+		return "rd"
+	}
+	return "th"
+}
@@ -0,0 +1,181 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"sort"
+)
+
+// outputSink receives the directories and files produced while processing a template. All paths given to a sink are
+// full output paths (ie: already joined with the output directory).
+type outputSink interface {
+	MakeDir(dir string) error
+	WriteFile(file string, content []byte) error
+	Chmod(file string, mode os.FileMode) error
+}
+
+// diskSink writes everything straight into the filesystem.
+type diskSink struct{}
+
+func (diskSink) MakeDir(dir string) error {
+	if err := os.Mkdir(longPath(dir), 0755); err != nil && !os.IsExist(err) {
+		return err
+	}
+	return nil
+}
+
+func (diskSink) WriteFile(file string, content []byte) error {
+	return ioutil.WriteFile(longPath(file), content, 0644)
+}
+
+func (diskSink) Chmod(file string, mode os.FileMode) error {
+	return os.Chmod(longPath(file), mode)
+}
+
+// memoryFile is a single rendered file held by a memorySink.
+type memoryFile struct {
+	Content []byte
+	Mode    os.FileMode
+}
+
+// memorySink collects the rendered tree in memory so that it can be inspected or compared before anything touches
+// the output directory.
+type memorySink struct {
+	Dirs  map[string]bool
+	Files map[string]*memoryFile
+}
+
+func newMemorySink() *memorySink {
+	return &memorySink{
+		Dirs:  make(map[string]bool),
+		Files: make(map[string]*memoryFile),
+	}
+}
+
+func (s *memorySink) MakeDir(dir string) error {
+	s.Dirs[dir] = true
+	return nil
+}
+
+func (s *memorySink) WriteFile(file string, content []byte) error {
+	s.Files[file] = &memoryFile{Content: content, Mode: 0644}
+	return nil
+}
+
+func (s *memorySink) Chmod(file string, mode os.FileMode) error {
+	if f, ok := s.Files[file]; ok {
+		f.Mode = mode
+	}
+	return nil
+}
+
+// SortedFiles returns the paths of all collected files in lexical order.
+func (s *memorySink) SortedFiles() []string {
+	out := make([]string, 0, len(s.Files))
+	for k := range s.Files {
+		out = append(out, k)
+	}
+	sort.Strings(out)
+	return out
+}
+
+// captureSink passes everything through to another sink while keeping a copy of the content of every file accepted
+// by the filter, so that it can be inspected once processing has finished.
+type captureSink struct {
+	outputSink
+	filter func(file string) bool
+	Files  map[string][]byte
+}
+
+func newCaptureSink(inner outputSink, filter func(file string) bool) *captureSink {
+	return &captureSink{outputSink: inner, filter: filter, Files: make(map[string][]byte)}
+}
+
+func (s *captureSink) WriteFile(file string, content []byte) error {
+	if s.filter(file) {
+		s.Files[file] = content
+	}
+	return s.outputSink.WriteFile(file, content)
+}
+
+// SortedFiles returns the paths of all captured files in lexical order.
+func (s *captureSink) SortedFiles() []string {
+	out := make([]string, 0, len(s.Files))
+	for k := range s.Files {
+		out = append(out, k)
+	}
+	sort.Strings(out)
+	return out
+}
+
+const (
+	permErrorsFail   = "fail"
+	permErrorsWarn   = "warn"
+	permErrorsIgnore = "ignore"
+)
+
+// permPolicySink applies the -perm-errors policy to permission changes. Filesystems such as FAT, NTFS or many FUSE
+// mounts don't support unix permissions, and failing to copy them shouldn't necessarily fail the whole run when the
+// content itself was written successfully.
+type permPolicySink struct {
+	outputSink
+	policy string
+}
+
+func newPermPolicySink(inner outputSink, policy string) (outputSink, error) {
+	switch policy {
+	case permErrorsFail:
+		return inner, nil
+	case permErrorsWarn, permErrorsIgnore:
+		return &permPolicySink{outputSink: inner, policy: policy}, nil
+	}
+	return nil, fmt.Errorf("Invalid -perm-errors value '%s', expected one of fail, warn, ignore", policy)
+}
+
+func (s *permPolicySink) Chmod(file string, mode os.FileMode) error {
+	err := s.outputSink.Chmod(file, mode)
+	if err != nil && s.policy == permErrorsWarn {
+		logs.Warnf("could not set permissions %s on '%s': %s", mode, file, err.Error())
+	}
+	return nil
+}
+
+// ownerOnlySink restricts every directory to 0700 and every file to 0600 (or 0700 when executable) regardless of the
+// template's permissions, for generating trees that contain secrets. Files are created empty and restricted before
+// their content is written so that the content is never readable by other users, even briefly.
+type ownerOnlySink struct {
+	outputSink
+}
+
+func ownerOnlyMode(mode os.FileMode) os.FileMode {
+	if mode.IsDir() || mode&0100 != 0 {
+		return 0700
+	}
+	return 0600
+}
+
+func (s *ownerOnlySink) MakeDir(dir string) error {
+	if err := s.outputSink.MakeDir(dir); err != nil {
+		return err
+	}
+	return s.outputSink.Chmod(dir, 0700)
+}
+
+func (s *ownerOnlySink) restrict(file string) error {
+	if err := s.outputSink.WriteFile(file, nil); err != nil {
+		return err
+	}
+	return s.outputSink.Chmod(file, 0600)
+}
+
+func (s *ownerOnlySink) WriteFile(file string, content []byte) error {
+	if err := s.restrict(file); err != nil {
+		return err
+	}
+	return s.outputSink.WriteFile(file, content)
+}
+
+func (s *ownerOnlySink) Chmod(file string, mode os.FileMode) error {
+	return s.outputSink.Chmod(file, ownerOnlyMode(mode))
+}
@@ -0,0 +1,114 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+)
+
+const (
+	overwriteFail   = "fail"
+	overwriteForce  = "force"
+	overwriteSkip   = "skip"
+	overwritePrompt = "prompt"
+)
+
+// overwritePolicy decides what happens when a rendered file would replace an existing output file with different
+// content: fail the run (the default), overwrite it (-force), keep the existing file (-skip-existing) or ask
+// (-prompt-on-conflict). Existing files with identical content are not conflicts. A nil policy overwrites silently,
+// which is what the in memory -dry-run and -output-patch modes need.
+type overwritePolicy struct {
+	mode    string
+	prompts *prompter
+	// overwritten and skipped record the conflicts for the summary
+	overwritten []string
+	skipped     []string
+}
+
+func newOverwritePolicy(force bool, skipExisting bool, prompt bool, prompts *prompter) (*overwritePolicy, error) {
+	o := &overwritePolicy{mode: overwriteFail, prompts: prompts}
+	count := 0
+	for mode, enabled := range map[string]bool{overwriteForce: force, overwriteSkip: skipExisting, overwritePrompt: prompt} {
+		if enabled {
+			o.mode = mode
+			count++
+		}
+	}
+	if count > 1 {
+		return nil, fmt.Errorf("Only one of the -force, -skip-existing and -prompt-on-conflict flags can be used")
+	}
+	return o, nil
+}
+
+// allowWrite reports whether the rendered content may be written to the output file.
+func (o *overwritePolicy) allowWrite(file string, content []byte) (bool, error) {
+	if o == nil {
+		return true, nil
+	}
+	existing, err := ioutil.ReadFile(longPath(file))
+	if os.IsNotExist(err) {
+		return true, nil
+	} else if err != nil {
+		return false, err
+	}
+	if bytes.Equal(existing, content) {
+		return true, nil
+	}
+	return o.resolve(file)
+}
+
+// resolve applies the policy to a conflicting file.
+func (o *overwritePolicy) resolve(file string) (bool, error) {
+	mode := o.mode
+	if mode == overwritePrompt {
+		for mode == overwritePrompt {
+			answer, err := o.prompts.read(fmt.Sprintf("'%s' already exists with different content, overwrite it? (yes, no, all, none)", file), "no")
+			if err != nil {
+				return false, err
+			}
+			switch strings.ToLower(answer) {
+			case "y", "yes":
+				mode = overwriteForce
+			case "n", "no":
+				mode = overwriteSkip
+			case "a", "all":
+				mode, o.mode = overwriteForce, overwriteForce
+			case "none":
+				mode, o.mode = overwriteSkip, overwriteSkip
+			}
+		}
+	}
+	switch mode {
+	case overwriteForce:
+		o.overwritten = append(o.overwritten, file)
+		return true, nil
+	case overwriteSkip:
+		o.skipped = append(o.skipped, file)
+		return false, nil
+	}
+	return false, fmt.Errorf("'%s' already exists with different content, use -force to overwrite it, -skip-existing to keep it or -prompt-on-conflict to decide for each file", file)
+}
+
+// printSummary lists the existing files that were overwritten or kept.
+func (o *overwritePolicy) printSummary(redact *redactor) {
+	if o == nil {
+		return
+	}
+	if len(o.overwritten) > 0 {
+		logs.Infof("Overwrote %d existing file(s) with different content:%s", len(o.overwritten), fileList(o.overwritten, redact))
+	}
+	if len(o.skipped) > 0 {
+		logs.Infof("Skipped %d existing file(s) with different content:%s", len(o.skipped), fileList(o.skipped, redact))
+	}
+}
+
+// fileList formats files as indented lines following a log message.
+func fileList(files []string, redact *redactor) string {
+	var b strings.Builder
+	for _, file := range files {
+		b.WriteString("\n  " + redact.Redact(file))
+	}
+	return b.String()
+}
@@ -0,0 +1,185 @@
+package main
+
+import (
+	"bytes"
+	"compress/zlib"
+	"crypto/sha1"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+)
+
+const base85Alphabet = "0123456789ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz!#$%&()*+-;<=>?@^_`{|}~"
+
+// gitMode converts a file mode into the octal mode string git uses in diff headers.
+func gitMode(mode os.FileMode) string {
+	if mode&0111 != 0 {
+		return "100755"
+	}
+	return "100644"
+}
+
+// gitBlobHash returns the hex sha1 that git would assign to a blob with the given content.
+func gitBlobHash(content []byte) string {
+	h := sha1.New()
+	fmt.Fprintf(h, "blob %d\x00", len(content))
+	h.Write(content)
+	return fmt.Sprintf("%x", h.Sum(nil))
+}
+
+// gitBinaryLiteral encodes content as a "literal" git binary patch hunk: zlib compressed, base85 encoded, 52 bytes
+// per line with a leading length character.
+func gitBinaryLiteral(content []byte) string {
+	var compressed bytes.Buffer
+	zw := zlib.NewWriter(&compressed)
+	zw.Write(content)
+	zw.Close()
+	data := compressed.Bytes()
+
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "literal %d\n", len(content))
+	for len(data) > 0 {
+		n := len(data)
+		if n > 52 {
+			n = 52
+		}
+		if n <= 26 {
+			buf.WriteByte(byte('A' + n - 1))
+		} else {
+			buf.WriteByte(byte('a' + n - 27))
+		}
+		line := data[:n]
+		for len(line) > 0 {
+			var acc uint32
+			for shift := 24; shift >= 0; shift -= 8 {
+				if len(line) > 0 {
+					acc |= uint32(line[0]) << uint(shift)
+					line = line[1:]
+				}
+			}
+			var group [5]byte
+			for i := 4; i >= 0; i-- {
+				group[i] = base85Alphabet[acc%85]
+				acc /= 85
+			}
+			buf.Write(group[:])
+		}
+		buf.WriteByte('\n')
+		data = data[n:]
+	}
+	buf.WriteByte('\n')
+	return buf.String()
+}
+
+// filePatch builds the git-style diff for a single file. A nil oldContent indicates that the file does not exist yet.
+// An empty string is returned when there is no difference.
+func filePatch(name string, oldContent []byte, oldMode os.FileMode, newContent []byte, newMode os.FileMode) (string, error) {
+	isNew := oldContent == nil
+	modeChanged := !isNew && gitMode(oldMode) != gitMode(newMode)
+	contentChanged := isNew || !bytes.Equal(oldContent, newContent)
+	if !contentChanged && !modeChanged {
+		return "", nil
+	}
+
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "diff --git a/%s b/%s\n", name, name)
+	if isNew {
+		fmt.Fprintf(&buf, "new file mode %s\n", gitMode(newMode))
+	} else if modeChanged {
+		fmt.Fprintf(&buf, "old mode %s\nnew mode %s\n", gitMode(oldMode), gitMode(newMode))
+	}
+	if !contentChanged {
+		return buf.String(), nil
+	}
+
+	fromName := "a/" + name
+	if isNew {
+		fromName = "/dev/null"
+	}
+	if isBinary(oldContent) || isBinary(newContent) {
+		oldHash := "0000000000000000000000000000000000000000"
+		if !isNew {
+			oldHash = gitBlobHash(oldContent)
+		}
+		fmt.Fprintf(&buf, "index %s..%s\n", oldHash, gitBlobHash(newContent))
+		buf.WriteString("GIT binary patch\n")
+		buf.WriteString(gitBinaryLiteral(newContent))
+		return buf.String(), nil
+	}
+	hunks, err := unifiedHunks(string(oldContent), string(newContent))
+	if err != nil {
+		return "", err
+	}
+	if hunks != "" {
+		fmt.Fprintf(&buf, "--- %s\n+++ b/%s\n", fromName, name)
+		buf.WriteString(hunks)
+	}
+	return buf.String(), nil
+}
+
+// pendingChange is a rendered file that differs from what is currently in the output directory.
+type pendingChange struct {
+	// Path is relative to the output directory and uses forward slashes.
+	Path  string
+	IsNew bool
+	Patch string
+}
+
+// pendingChanges compares the files collected by the sink against the existing contents of the output directory.
+// Files that exist in the output directory but not in the rendered tree are left alone.
+func pendingChanges(outputDir string, sink *memorySink) ([]pendingChange, error) {
+	var changes []pendingChange
+	for _, file := range sink.SortedFiles() {
+		rendered := sink.Files[file]
+		rel, err := filepath.Rel(outputDir, file)
+		if err != nil {
+			return nil, fmt.Errorf("Error while comparing '%s': %s", file, err.Error())
+		}
+		rel = filepath.ToSlash(rel)
+
+		var oldContent []byte
+		var oldMode os.FileMode
+		if info, err := os.Stat(longPath(file)); err == nil {
+			if info.IsDir() {
+				return nil, fmt.Errorf("Error while comparing '%s': existing output is a directory", file)
+			}
+			if oldContent, err = ioutil.ReadFile(longPath(file)); err != nil {
+				return nil, fmt.Errorf("Error while reading existing output '%s': %s", file, err.Error())
+			} else if oldContent == nil {
+				oldContent = []byte{}
+			}
+			oldMode = info.Mode()
+		} else if !os.IsNotExist(err) {
+			return nil, fmt.Errorf("Error while reading existing output '%s': %s", file, err.Error())
+		}
+
+		patch, err := filePatch(rel, oldContent, oldMode, rendered.Content, rendered.Mode)
+		if err != nil {
+			return nil, fmt.Errorf("Error while comparing '%s': %s", file, err.Error())
+		}
+		if patch != "" {
+			changes = append(changes, pendingChange{Path: rel, IsNew: oldContent == nil, Patch: patch})
+		}
+	}
+	return changes, nil
+}
+
+// buildPatch returns a single patch containing the pending changes that can be applied from within the output
+// directory using `git apply`.
+func buildPatch(changes []pendingChange) string {
+	var buf bytes.Buffer
+	for _, change := range changes {
+		buf.WriteString(change.Patch)
+	}
+	return buf.String()
+}
+
+// writePatch writes the patch for the pending changes to patchFile.
+func writePatch(changes []pendingChange, patchFile string) error {
+	if err := ioutil.WriteFile(patchFile, []byte(buildPatch(changes)), 0644); err != nil {
+		return fmt.Errorf("Error while writing patch file '%s': %s", patchFile, err.Error())
+	}
+	logs.Infof("Wrote patch to '%s'", patchFile)
+	return nil
+}
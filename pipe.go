@@ -0,0 +1,34 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+
+	"github.com/AstromechZA/spiro/templatefactory"
+)
+
+// pipeTemplateName is the name that errors in a template read from stdin refer to.
+const pipeTemplateName = "stdin"
+
+// renderPipe renders the single template read from in with the spec and writes the result to out, so that spiro can
+// be used in shell pipelines like envsubst. setup registers the template functions on the template factory.
+func renderPipe(in io.Reader, out io.Writer, spec map[string]interface{}, setup func(tf *templatefactory.TemplateFactory) error) error {
+	templateBytes, err := ioutil.ReadAll(in)
+	if err != nil {
+		return fmt.Errorf("Error while reading the template from stdin: %s", err.Error())
+	}
+	tf := templatefactory.NewTemplateFactory()
+	if err := tf.SetSpec(&spec); err != nil {
+		return err
+	}
+	if err := setup(tf); err != nil {
+		return err
+	}
+	output, err := tf.RenderNamed(pipeTemplateName, string(templateBytes))
+	if err != nil {
+		return fmt.Errorf("Error while rendering template for '%s': %s", pipeTemplateName, err.Error())
+	}
+	_, err = io.WriteString(out, output)
+	return err
+}
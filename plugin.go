@@ -0,0 +1,167 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"regexp"
+	"strings"
+
+	"github.com/AstromechZA/spiro/templatefactory"
+)
+
+var pluginNameRegex = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// functionPlugin is an external process that provides template functions over a line based JSON protocol on its
+// stdin and stdout. On startup the plugin writes the functions it provides:
+//
+//	{"functions": ["slug", "checksum"]}
+//
+// after which spiro writes one request per line and the plugin answers each with exactly one line:
+//
+//	{"id": 1, "function": "slug", "args": ["Hello World"]}
+//	{"id": 1, "result": "hello-world"}
+//	{"id": 2, "error": "checksum needs a file name"}
+//
+// The functions are called from templates through a namespace named after the plugin, eg: {{ myplugin.slug .name }}.
+type functionPlugin struct {
+	name      string
+	cmd       *exec.Cmd
+	stdin     io.WriteCloser
+	stdout    *bufio.Reader
+	functions []string
+	nextID    int
+}
+
+type pluginHello struct {
+	Functions []string `json:"functions"`
+}
+
+type pluginRequest struct {
+	ID       int           `json:"id"`
+	Function string        `json:"function"`
+	Args     []interface{} `json:"args"`
+}
+
+type pluginResponse struct {
+	ID     int         `json:"id"`
+	Result interface{} `json:"result"`
+	Error  string      `json:"error"`
+}
+
+// startFunctionPlugin starts the plugin given as 'name=command', the command is run with 'sh -c'.
+func startFunctionPlugin(definition string) (*functionPlugin, error) {
+	parts := strings.SplitN(definition, "=", 2)
+	if len(parts) != 2 || strings.TrimSpace(parts[1]) == "" || !pluginNameRegex.MatchString(parts[0]) {
+		return nil, fmt.Errorf("Invalid -plugin '%s', expected name=command where the name is a valid identifier", definition)
+	}
+	p := &functionPlugin{name: parts[0], cmd: exec.Command("sh", "-c", parts[1])}
+	p.cmd.Stderr = os.Stderr
+	var err error
+	if p.stdin, err = p.cmd.StdinPipe(); err != nil {
+		return nil, fmt.Errorf("Error while starting plugin '%s': %s", p.name, err.Error())
+	}
+	stdout, err := p.cmd.StdoutPipe()
+	if err != nil {
+		return nil, fmt.Errorf("Error while starting plugin '%s': %s", p.name, err.Error())
+	}
+	p.stdout = bufio.NewReader(stdout)
+	if err := p.cmd.Start(); err != nil {
+		return nil, fmt.Errorf("Error while starting plugin '%s': %s", p.name, err.Error())
+	}
+
+	var hello pluginHello
+	if err := p.receive(&hello); err != nil {
+		p.Close()
+		return nil, fmt.Errorf("Error while starting plugin '%s': %s", p.name, err.Error())
+	}
+	p.functions = hello.Functions
+	return p, nil
+}
+
+func (p *functionPlugin) receive(v interface{}) error {
+	line, err := p.stdout.ReadBytes('\n')
+	if err != nil && (err != io.EOF || len(line) == 0) {
+		if err == io.EOF {
+			return fmt.Errorf("the plugin exited unexpectedly")
+		}
+		return err
+	}
+	if err := json.Unmarshal(line, v); err != nil {
+		return fmt.Errorf("could not parse plugin output %q: %s", strings.TrimSpace(string(line)), err.Error())
+	}
+	return nil
+}
+
+// call runs a function in the plugin process and waits for its result.
+func (p *functionPlugin) call(function string, args []interface{}) (interface{}, error) {
+	p.nextID++
+	request, err := json.Marshal(pluginRequest{ID: p.nextID, Function: function, Args: args})
+	if err != nil {
+		return nil, fmt.Errorf("arguments cannot be sent to the plugin: %s", err.Error())
+	}
+	if _, err := p.stdin.Write(append(request, '\n')); err != nil {
+		return nil, fmt.Errorf("could not send request to plugin '%s': %s", p.name, err.Error())
+	}
+	var response pluginResponse
+	if err := p.receive(&response); err != nil {
+		return nil, fmt.Errorf("plugin '%s': %s", p.name, err.Error())
+	}
+	if response.ID != p.nextID {
+		return nil, fmt.Errorf("plugin '%s' answered request %d while %d was expected", p.name, response.ID, p.nextID)
+	}
+	if response.Error != "" {
+		return nil, fmt.Errorf("%s", response.Error)
+	}
+	return response.Result, nil
+}
+
+// Register adds the plugin's functions to the template factory under the plugin's namespace.
+func (p *functionPlugin) Register(tf *templatefactory.TemplateFactory) error {
+	functions := make(map[string]interface{}, len(p.functions))
+	for _, name := range p.functions {
+		name := name
+		functions[name] = func(args ...interface{}) (interface{}, error) {
+			return p.call(name, args)
+		}
+	}
+	return tf.RegisterNamespace(p.name, functions)
+}
+
+// Close ends the plugin by closing its stdin and waits for it to exit.
+func (p *functionPlugin) Close() error {
+	p.stdin.Close()
+	return p.cmd.Wait()
+}
+
+// registerFunctionPlugins registers the functions of every plugin on the template factory.
+func registerFunctionPlugins(tf *templatefactory.TemplateFactory, plugins []*functionPlugin) error {
+	for _, p := range plugins {
+		if err := p.Register(tf); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// startFunctionPlugins starts every plugin given with -plugin. The returned function stops them again.
+func startFunctionPlugins(definitions []string) ([]*functionPlugin, func(), error) {
+	var plugins []*functionPlugin
+	stop := func() {
+		for _, p := range plugins {
+			p.Close()
+		}
+	}
+	for _, definition := range definitions {
+		p, err := startFunctionPlugin(definition)
+		if err != nil {
+			stop()
+			return nil, nil, err
+		}
+		plugins = append(plugins, p)
+	}
+	return plugins, stop, nil
+}
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// postProcessStep is a template pipeline that every rendered file is passed through, eg: 'collapseBlankLines 1'
+// receives the file content as its last argument. Files limits the step to paths matching the gitignore style
+// patterns, relative to the root of the generated output. It can be written either as a map with 'run' and 'files'
+// keys or as just the pipeline.
+type postProcessStep struct {
+	Run   string   `yaml:"run"`
+	Files []string `yaml:"files"`
+	files *ignoreRules
+}
+
+func (s *postProcessStep) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	if err := unmarshal(&s.Run); err != nil {
+		type plain postProcessStep
+		if err := unmarshal((*plain)(s)); err != nil {
+			return err
+		}
+	}
+	if strings.TrimSpace(s.Run) == "" {
+		return fmt.Errorf("postprocess steps require a template pipeline to run")
+	}
+	if len(s.Files) > 0 {
+		files, err := newIgnoreRules(s.Files)
+		if err != nil {
+			return err
+		}
+		s.files = files
+	}
+	return nil
+}
+
+// appliesTo reports whether the step should run for the rendered file at rel.
+func (s *postProcessStep) appliesTo(rel string) bool {
+	return s.files == nil || s.files.Ignored(rel, false)
+}
+
+var trailingSpacePattern = regexp.MustCompile(`[ \t]+(\r?\n|$)`)
+
+// TrimTrailingSpace removes spaces and tabs from the end of every line.
+func TrimTrailingSpace(in string) string {
+	return trailingSpacePattern.ReplaceAllString(in, "$1")
+}
+
+// CollapseBlankLines reduces every run of more than max blank lines to max blank lines.
+func CollapseBlankLines(max int, in string) string {
+	if max < 0 {
+		max = 0
+	}
+	lines := strings.Split(in, "\n")
+	out := make([]string, 0, len(lines))
+	blank := 0
+	for i, line := range lines {
+		if strings.TrimSpace(line) == "" && i < len(lines)-1 {
+			blank++
+			if blank > max {
+				continue
+			}
+		} else {
+			blank = 0
+		}
+		out = append(out, line)
+	}
+	return strings.Join(out, "\n")
+}
+
+// EnsureTrailingNewline adds a final newline to non-empty content that doesn't end with one.
+func EnsureTrailingNewline(in string) string {
+	if in == "" || strings.HasSuffix(in, "\n") {
+		return in
+	}
+	return in + "\n"
+}
@@ -0,0 +1,104 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// ANSI colors for the -preview diff, like git's defaults.
+const (
+	colorBold  = "\x1b[1m"
+	colorRed   = "\x1b[31m"
+	colorGreen = "\x1b[32m"
+	colorCyan  = "\x1b[36m"
+	colorReset = "\x1b[0m"
+)
+
+func stdoutIsTerminal() bool {
+	stat, err := os.Stdout.Stat()
+	return err == nil && stat.Mode()&os.ModeCharDevice != 0
+}
+
+// colorizePatch colors the lines of a unified diff: file headers in bold, hunk headers in cyan, removed lines in red
+// and added lines in green.
+func colorizePatch(patch string) string {
+	lines := strings.SplitAfter(patch, "\n")
+	inHeader := false
+	for i, line := range lines {
+		content := strings.TrimSuffix(line, "\n")
+		if content == "" {
+			continue
+		}
+		color := ""
+		switch {
+		case strings.HasPrefix(content, "diff --git "):
+			inHeader, color = true, colorBold
+		case strings.HasPrefix(content, "@@"):
+			inHeader, color = false, colorCyan
+		case inHeader:
+			color = colorBold
+		case strings.HasPrefix(content, "+"):
+			color = colorGreen
+		case strings.HasPrefix(content, "-"):
+			color = colorRed
+		}
+		if color != "" {
+			lines[i] = color + content + colorReset + line[len(content):]
+		}
+	}
+	return strings.Join(lines, "")
+}
+
+// previewChanges shows the pending changes, or only the change to file (relative to the output directory), through
+// $PAGER (less by default) with colored diff lines. When stdout is not a terminal the plain diff is written instead,
+// like -diff.
+func previewChanges(changes []pendingChange, file string) error {
+	if file != "" {
+		file = path.Clean(filepath.ToSlash(file))
+		var selected []pendingChange
+		for _, change := range changes {
+			if change.Path == file {
+				selected = append(selected, change)
+			}
+		}
+		if len(selected) == 0 {
+			logs.Infof("Rendering the template does not change '%s'", file)
+			return nil
+		}
+		changes = selected
+	} else if len(changes) == 0 {
+		logs.Infof("Rendering the template does not change the output directory")
+		return nil
+	}
+	patch := buildPatch(changes)
+	if !stdoutIsTerminal() {
+		fmt.Print(patch)
+		return nil
+	}
+
+	pager := os.Getenv("PAGER")
+	if pager == "" {
+		pager = "less"
+	}
+	cmd := exec.Command("sh", "-c", pager)
+	cmd.Stdin = strings.NewReader(colorizePatch(patch))
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	cmd.Env = os.Environ()
+	if os.Getenv("LESS") == "" {
+		// like git: show colors, quit when the diff fits on one screen and leave it on the screen afterwards
+		cmd.Env = append(cmd.Env, "LESS=FRX")
+	}
+	if err := cmd.Run(); err != nil {
+		if _, ok := err.(*exec.ExitError); ok {
+			return fmt.Errorf("The pager '%s' failed: %s", pager, err.Error())
+		}
+		// without a usable pager the diff is still worth showing
+		fmt.Print(colorizePatch(patch))
+	}
+	return nil
+}
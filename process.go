@@ -0,0 +1,281 @@
+package main
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/AstromechZA/spiro/engine"
+	"github.com/AstromechZA/spiro/templatefactory"
+)
+
+// processor holds the features of the spiro command that are plugged into the engine, which walks the template tree
+// and writes the rendered result to an output sink.
+type processor struct {
+	root   string
+	tf     *templatefactory.TemplateFactory
+	out    outputSink
+	ignore *ignoreRules
+	// metadata lists the entries at the root of the template that belong to the template rather than to its output
+	metadata []string
+	// rewrites relocate rendered files, their paths are relative to outRoot (the root of the generated output)
+	rewrites []pathRewrite
+	outRoot  string
+	// postprocess is applied in order to the content of every rendered file
+	postprocess []postProcessStep
+	// whitespace tidies rendered files, before the postprocess steps
+	whitespace *whitespaceConfig
+	// header is added to the top of rendered files matching headerFiles (or all of them when it is nil)
+	header      string
+	headerFiles *ignoreRules
+	// verbose logs every processed item, otherwise only the progress bar (if any) is updated
+	verbose  bool
+	progress *progressBar
+	// redact hides sensitive spec values (eg: used in file names) from the log
+	redact *redactor
+	// plan records every processed item for the -dry-run report and the -webhook run report
+	plan *actionPlan
+	// overwrite decides whether existing output files with different content are replaced
+	overwrite *overwritePolicy
+	// stats collects the duration and allocations of each file for 'spiro bench'
+	stats *benchStats
+	// outputs records rendered files for the 'output' template function, files that use it before the file they refer
+	// to has been rendered are deferred
+	outputs *renderedOutputs
+	// foreach maps template paths (relative to the template root) to the pipeline producing the list they are rendered
+	// once per element of, in addition to items whose name contains a foreach action
+	foreach map[string]string
+	// caseCollisions detects rendered paths that only differ by case
+	caseCollisions *caseCollisions
+	// names normalizes the Unicode form of rendered names
+	names *nameNormalizer
+	// formatters format rendered files after the postprocess steps
+	formatters []*fileFormatter
+	// protect matches existing output files, relative to outRoot, that are never overwritten whatever the overwrite
+	// policy is
+	protect *ignoreRules
+	// only limits rendering to the template files listed with -files-from, everything is rendered when it is nil
+	only *fileSelection
+	// problems collects the errors of items that failed to render and carries on with the rest, for 'spiro validate',
+	// otherwise processing stops at the first error
+	problems *[]string
+
+	engine *engine.Renderer
+}
+
+func (p *processor) logf(format string, args ...interface{}) {
+	if p.verbose {
+		logs.Infof("%s", p.redact.Redact(fmt.Sprintf(format, args...)))
+	}
+}
+
+func (p *processor) debugf(format string, args ...interface{}) {
+	logs.Debugf("%s", p.redact.Redact(fmt.Sprintf(format, args...)))
+}
+
+// templateFS reads a template from the directory it is in. Unlike os.DirFS it handles the long paths of deep template
+// trees on Windows.
+type templateFS string
+
+func (dir templateFS) Open(name string) (fs.File, error) {
+	if !fs.ValidPath(name) {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrInvalid}
+	}
+	return os.Open(longPath(filepath.Join(string(dir), filepath.FromSlash(name))))
+}
+
+// input returns the filesystem holding the template and the path of the template in it.
+func (p *processor) input() (fs.FS, string) {
+	root := filepath.Clean(p.root)
+	return templateFS(filepath.Dir(root)), filepath.Base(root)
+}
+
+// renderer returns the engine renderer with the features of the spiro command plugged in. The same renderer is used
+// for the whole run so that deferred files are rendered by processDeferred.
+func (p *processor) renderer() *engine.Renderer {
+	if p.engine != nil {
+		return p.engine
+	}
+	p.engine = &engine.Renderer{
+		Factory:    p.tf,
+		Source:     filepath.ToSlash(filepath.Dir(filepath.Clean(p.root))),
+		Metadata:   p.metadata,
+		Ignore:     p.ignore.Ignored,
+		Only:       p.only.includes,
+		Foreach:    p.foreach,
+		Name:       func(name string) string { return p.names.normalize(name, p.redact) },
+		Check:      func(output string) error { return p.caseCollisions.check(output, p.redact) },
+		Rewrite:    p.outputFile,
+		Prepare:    p.prepare,
+		Transform:  p.transform,
+		AllowWrite: p.allowWrite,
+		Planned:    func(action engine.Action) { p.plan.add(plannedAction(action)) },
+		Measure:    p.stats.measure,
+		Logf:       p.logf,
+		Debugf:     p.debugf,
+		Problems:   p.problems,
+	}
+	if p.outputs != nil {
+		p.engine.Outputs = p.outputs
+	}
+	if p.progress != nil {
+		p.engine.Progress = p.progress
+	}
+	return p.engine
+}
+
+// countFiles returns the number of files that processing the template will visit, for progress reporting.
+func (p *processor) countFiles() int {
+	input, root := p.input()
+	return p.renderer().CountFiles(input, root)
+}
+
+// process renders the template into outputDir, a directory template becomes a new directory of it.
+func (p *processor) process(outputDir string) error {
+	input, root := p.input()
+	return p.renderer().Process(input, root, outputDir, p.out)
+}
+
+// processInto renders the template so that the content of a directory template lands directly inside targetDir rather
+// than in a newly created subdirectory of it.
+func (p *processor) processInto(targetDir string) error {
+	input, root := p.input()
+	return p.renderer().ProcessInto(input, root, targetDir, p.out)
+}
+
+// processDeferred renders the files that were deferred because they used 'output' before the file they refer to had
+// been rendered.
+func (p *processor) processDeferred() error {
+	return p.renderer().ProcessDeferred()
+}
+
+// prepare tidies the whitespace around the actions of a template file before it is rendered.
+func (p *processor) prepare(outputFile string, text string) string {
+	if !p.whitespace.appliesTo(p.outputRel(outputFile)) || isBinary([]byte(text)) {
+		return text
+	}
+	startDelim, endDelim := p.tf.Delimiters()
+	return p.whitespace.trimBlocks(text, startDelim, endDelim)
+}
+
+// transform post-processes rendered content and keeps the protected regions of the existing output file.
+func (p *processor) transform(outputFile string, content string) (string, error) {
+	content, err := p.postProcess(outputFile, content)
+	if err != nil {
+		return "", err
+	}
+	if content, err = keepRegions(outputFile, content); err != nil {
+		return "", fmt.Errorf("could not preserve the protected regions of '%s': %s", outputFile, err.Error())
+	}
+	return content, nil
+}
+
+// allowWrite reports whether a file is written, protected files and existing files kept by the overwrite policy are
+// not.
+func (p *processor) allowWrite(outputFile string, content []byte) (bool, error) {
+	if p.protected(outputFile) {
+		return false, nil
+	}
+	write, err := p.overwrite.allowWrite(outputFile, content)
+	if err == nil && !write {
+		p.logf("Keeping existing '%s'", outputFile)
+	}
+	return write, err
+}
+
+// outputFile returns where a rendered file should be written. The manifest rewrite rules are applied to its path
+// relative to the root of the generated output, creating any new parent directories that a rewrite needs.
+func (p *processor) outputFile(file string) (string, error) {
+	if len(p.rewrites) == 0 || p.outRoot == "" || !strings.HasPrefix(file, p.outRoot+"/") {
+		return file, nil
+	}
+	rel := strings.TrimPrefix(file, p.outRoot+"/")
+	rewritten := rel
+	for _, rewrite := range p.rewrites {
+		rewritten = rewrite.pattern.ReplaceAllString(rewritten, rewrite.To)
+	}
+	if rewritten == rel {
+		return file, nil
+	}
+	rewritten = path.Clean(rewritten)
+	if rewritten == "." || rewritten == ".." || strings.HasPrefix(rewritten, "../") || path.IsAbs(rewritten) {
+		return "", fmt.Errorf("'%s' was rewritten to '%s' which is outside of the generated output", rel, rewritten)
+	}
+	dir := p.outRoot
+	for _, part := range strings.Split(path.Dir(rewritten), "/") {
+		if part == "." {
+			continue
+		}
+		dir = path.Join(dir, part)
+		if err := p.out.MakeDir(dir); err != nil {
+			return "", err
+		}
+	}
+	return path.Join(p.outRoot, rewritten), nil
+}
+
+// outputRel returns the path of an output file relative to the root of the generated output, or just its name when it
+// is outside of it.
+func (p *processor) outputRel(outputFile string) string {
+	if p.outRoot != "" && strings.HasPrefix(outputFile, p.outRoot+"/") {
+		return strings.TrimPrefix(outputFile, p.outRoot+"/")
+	}
+	return path.Base(outputFile)
+}
+
+// protected reports whether the output file already exists and matches one of the -protect patterns, in which case it
+// is kept as it is.
+func (p *processor) protected(outputFile string) bool {
+	if !isProtected(p.protect, p.outputRel(outputFile), outputFile) {
+		return false
+	}
+	logs.Infof("Keeping protected file '%s'", p.redact.Redact(outputFile))
+	return true
+}
+
+// isProtected reports whether the file exists and its path rel, relative to the root of the generated output, matches
+// one of the -protect patterns.
+func isProtected(protect *ignoreRules, rel string, file string) bool {
+	if protect == nil || !protect.Ignored(rel, false) {
+		return false
+	}
+	_, err := os.Lstat(longPath(file))
+	return err == nil
+}
+
+// postProcess tidies the whitespace of rendered content, passes it through the manifest postprocess steps and
+// formatters that apply to the output file and then adds the generated file header.
+func (p *processor) postProcess(outputFile string, content string) (string, error) {
+	if (len(p.postprocess) == 0 && len(p.formatters) == 0 && p.header == "" && p.whitespace == nil) || isBinary([]byte(content)) {
+		return content, nil
+	}
+	rel := p.outputRel(outputFile)
+	if p.whitespace.appliesTo(rel) {
+		content = p.whitespace.tidy(content)
+	}
+	for _, step := range p.postprocess {
+		if !step.appliesTo(rel) {
+			continue
+		}
+		var err error
+		if content, err = p.tf.Pipe(step.Run, content); err != nil {
+			return "", err
+		}
+	}
+	for _, formatter := range p.formatters {
+		if !formatter.files.Ignored(rel, false) {
+			continue
+		}
+		var err error
+		if content, err = formatter.format(rel, content); err != nil {
+			return "", err
+		}
+	}
+	if p.header != "" && (p.headerFiles == nil || p.headerFiles.Ignored(rel, false)) {
+		content = addHeader(outputFile, content, p.header)
+	}
+	return content, nil
+}
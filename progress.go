@@ -0,0 +1,93 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+)
+
+const progressBarWidth = 30
+
+// progressBar draws a single self-updating line showing how many template files have been processed so far. It is
+// only used when writing to a terminal, otherwise every file is logged on its own line instead.
+type progressBar struct {
+	out   io.Writer
+	total int
+	done  int
+	start time.Time
+	drawn time.Time
+}
+
+func stderrIsTerminal() bool {
+	stat, err := os.Stderr.Stat()
+	return err == nil && stat.Mode()&os.ModeCharDevice != 0
+}
+
+func newProgressBar(out io.Writer, total int) *progressBar {
+	return &progressBar{out: out, total: total, start: time.Now()}
+}
+
+// AddTotal increases the number of files expected. It is safe to call on a nil bar.
+func (b *progressBar) AddTotal(n int) {
+	if b == nil {
+		return
+	}
+	b.total += n
+}
+
+// Add records n more processed files, redrawing at most ten times a second. It is safe to call on a nil bar.
+func (b *progressBar) Add(n int) {
+	if b == nil {
+		return
+	}
+	b.done += n
+	if time.Since(b.drawn) >= 100*time.Millisecond {
+		b.draw()
+	}
+}
+
+// Finish draws the completed bar and moves to the next line. It is safe to call on a nil bar.
+func (b *progressBar) Finish() {
+	if b == nil {
+		return
+	}
+	// files whose names evaluate to '' are never processed so the count may fall short of the total
+	b.done = b.total
+	b.draw()
+	b.Stop()
+}
+
+// Stop leaves the bar as it is and moves to the next line so that following output isn't appended to it. It is safe
+// to call on a nil bar.
+func (b *progressBar) Stop() {
+	if b == nil || b.drawn.IsZero() {
+		return
+	}
+	fmt.Fprintln(b.out)
+	b.drawn = time.Time{}
+}
+
+func (b *progressBar) draw() {
+	b.drawn = time.Now()
+	fraction := 1.0
+	if b.total > 0 {
+		fraction = float64(b.done) / float64(b.total)
+	}
+	if fraction > 1 {
+		fraction = 1
+	}
+	filled := int(fraction * progressBarWidth)
+	bar := strings.Repeat("=", filled) + strings.Repeat(" ", progressBarWidth-filled)
+
+	eta := "--"
+	if b.done > 0 && b.done < b.total {
+		elapsed := time.Since(b.start)
+		remaining := time.Duration(float64(elapsed) * float64(b.total-b.done) / float64(b.done))
+		eta = remaining.Round(time.Second).String()
+	} else if b.done >= b.total {
+		eta = "0s"
+	}
+	fmt.Fprintf(b.out, "\r[%s] %d/%d files (%3.0f%%) ETA %s   ", bar, b.done, b.total, fraction*100, eta)
+}
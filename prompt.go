@@ -0,0 +1,123 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+// prompter asks the user questions on the terminal. Answers are cached by question so that a template which is
+// rendered more than once (or asks the same question in several files) only prompts once. Answers recorded by an
+// earlier generation of the output are reused so that only new questions are asked.
+type prompter struct {
+	in          *bufio.Reader
+	out         io.Writer
+	interactive bool
+	answers     map[string]string
+	recorded    map[string]string
+}
+
+// stdinIsTerminal reports whether stdin looks like an interactive terminal rather than a pipe or file.
+func stdinIsTerminal() bool {
+	stat, err := os.Stdin.Stat()
+	return err == nil && stat.Mode()&os.ModeCharDevice != 0
+}
+
+func newPrompter(interactive bool) *prompter {
+	return &prompter{
+		in:          bufio.NewReader(os.Stdin),
+		out:         os.Stderr,
+		interactive: interactive,
+		answers:     make(map[string]string),
+		recorded:    make(map[string]string),
+	}
+}
+
+// Recall adds previously recorded answers, earlier recordings take precedence over later ones.
+func (p *prompter) Recall(answers map[string]string) {
+	for question, answer := range answers {
+		if _, ok := p.recorded[question]; !ok {
+			p.recorded[question] = answer
+		}
+	}
+}
+
+// Answers returns the answers to every question asked so far.
+func (p *prompter) Answers() map[string]string {
+	out := make(map[string]string, len(p.answers))
+	for question, answer := range p.answers {
+		out[question] = answer
+	}
+	return out
+}
+
+// Ask is the 'ask' template function: {{ ask "Database name?" "mydb" }} prompts for a value, offering an optional
+// default which is used when the answer is left empty. When running non-interactively it fails rather than silently
+// guessing an answer.
+func (p *prompter) Ask(question string, defaults ...string) (string, error) {
+	if len(defaults) > 1 {
+		return "", fmt.Errorf("ask accepts a question and at most one default")
+	}
+	if answer, ok := p.answers[question]; ok {
+		return answer, nil
+	}
+	if answer, ok := p.recorded[question]; ok {
+		p.answers[question] = answer
+		return answer, nil
+	}
+	def := ""
+	if len(defaults) == 1 {
+		def = defaults[0]
+	}
+	answer, err := p.read(question, def)
+	if err != nil {
+		return "", err
+	}
+	p.answers[question] = answer
+	return answer, nil
+}
+
+// AskValid asks a question like Ask but passes the answer through parse, asking again until the answer is valid.
+func (p *prompter) AskValid(question string, def string, parse func(answer string) (interface{}, error)) (interface{}, error) {
+	if answer, ok := p.recorded[question]; ok {
+		if value, err := parse(answer); err == nil {
+			p.answers[question] = answer
+			return value, nil
+		}
+	}
+	for {
+		answer, err := p.read(question, def)
+		if err != nil {
+			return nil, err
+		}
+		value, err := parse(answer)
+		if err == nil {
+			p.answers[question] = answer
+			return value, nil
+		}
+		fmt.Fprintf(p.out, "Invalid answer: %s\n", err.Error())
+	}
+}
+
+// read prompts for a single answer, an empty answer selects the default (if not empty).
+func (p *prompter) read(question string, def string) (string, error) {
+	if !p.interactive {
+		return "", fmt.Errorf("cannot prompt for %q since spiro is not running interactively", question)
+	}
+	if def != "" {
+		fmt.Fprintf(p.out, "%s [%s]: ", question, def)
+	} else {
+		fmt.Fprintf(p.out, "%s: ", question)
+	}
+	line, err := p.in.ReadString('\n')
+	if err != nil && (err != io.EOF || line == "") {
+		return "", fmt.Errorf("failed to read answer for %q: %s", question, err.Error())
+	}
+	answer := strings.TrimSpace(line)
+	if answer == "" {
+		answer = def
+	}
+	return answer, nil
+}
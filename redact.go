@@ -0,0 +1,96 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+const redactedValue = "[REDACTED]"
+
+// redactor hides the values of sensitive spec keys (listed under 'sensitive' in the template manifest or given with
+// -sensitive) from everything spiro prints or records about a run. The rendered output itself is left untouched. A nil
+// redactor redacts nothing.
+type redactor struct {
+	values []string
+}
+
+// newRedactor collects the values of the sensitive keys from each of the specs being rendered. A key that refers to a
+// map or list marks every value inside it as sensitive.
+func newRedactor(keys []string, runs []matrixRun) *redactor {
+	seen := make(map[string]bool)
+	r := &redactor{}
+	for _, run := range runs {
+		for _, key := range keys {
+			if value, ok := lookupSpecPath(run.Spec, key); ok {
+				r.collect(value, seen)
+			}
+		}
+	}
+	if len(r.values) == 0 {
+		return nil
+	}
+	// replace longer values first so that a value containing another is not left partially visible
+	sort.SliceStable(r.values, func(i, j int) bool {
+		return len(r.values[i]) > len(r.values[j])
+	})
+	return r
+}
+
+func (r *redactor) collect(value interface{}, seen map[string]bool) {
+	switch v := value.(type) {
+	case nil:
+	case map[string]interface{}:
+		for _, item := range v {
+			r.collect(item, seen)
+		}
+	case []interface{}:
+		for _, item := range v {
+			r.collect(item, seen)
+		}
+	default:
+		s := fmt.Sprint(v)
+		if s != "" && !seen[s] {
+			seen[s] = true
+			r.values = append(r.values, s)
+		}
+	}
+}
+
+// Redact replaces every occurrence of a sensitive value in s.
+func (r *redactor) Redact(s string) string {
+	if r == nil {
+		return s
+	}
+	for _, value := range r.values {
+		s = strings.Replace(s, value, redactedValue, -1)
+	}
+	return s
+}
+
+// Error redacts the message of an error.
+func (r *redactor) Error(err error) error {
+	if r == nil || err == nil {
+		return err
+	}
+	if msg := r.Redact(err.Error()); msg != err.Error() {
+		return errors.New(msg)
+	}
+	return err
+}
+
+// Answers returns the prompt answers that may be saved, answers containing a sensitive value are left out so that they
+// are asked for again rather than being written to disk.
+func (r *redactor) Answers(answers map[string]string) map[string]string {
+	if r == nil {
+		return answers
+	}
+	out := make(map[string]string, len(answers))
+	for question, answer := range answers {
+		if r.Redact(answer) == answer {
+			out[question] = answer
+		}
+	}
+	return out
+}
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// scpLikeGitURL matches the 'user@host:path' form of ssh git URLs, eg: git@github.com:org/template.git.
+var scpLikeGitURL = regexp.MustCompile(`^[\w.-]+@[\w.-]+:`)
+
+// offline forbids everything that needs network access: cloning remote templates, network template functions, webhooks
+// and telemetry. Set by the -offline flag or $SPIRO_OFFLINE.
+var offline, _ = strconv.ParseBool(os.Getenv("SPIRO_OFFLINE"))
+
+// isRemoteTemplate reports whether the template argument is a git URL rather than a local path. Local paths always
+// win so that an existing directory with an unlucky name is never cloned.
+func isRemoteTemplate(arg string) bool {
+	if _, err := os.Stat(arg); err == nil {
+		return false
+	}
+	for _, prefix := range []string{"https://", "http://", "ssh://", "git://", "file://"} {
+		if strings.HasPrefix(arg, prefix) {
+			return true
+		}
+	}
+	return scpLikeGitURL.MatchString(arg)
+}
+
+// resolveTemplate returns the local path of the template given on the command line. Git URLs are cloned, and template
+// archives extracted, into a temporary directory first, the returned function removes it again and must be called once
+// the template is no longer needed.
+func resolveTemplate(arg string) (string, func(), error) {
+	if isTemplateArchive(arg) {
+		return extractTemplateArchive(arg)
+	}
+	if !isRemoteTemplate(arg) {
+		return arg, func() {}, nil
+	}
+	if offline && !strings.HasPrefix(arg, "file://") {
+		return "", nil, fmt.Errorf("Cannot clone the remote template '%s' with -offline, use a local copy of it instead", arg)
+	}
+	return cloneRemoteTemplate(arg)
+}
+
+// cloneRemoteTemplate clones a git URL, optionally at the branch, tag or commit given after a '#' (eg:
+// https://github.com/org/template.git#v1.2.0), into a new temporary directory. The clone is named after the
+// repository so that the rendered output is too.
+func cloneRemoteTemplate(source string) (string, func(), error) {
+	url, ref := source, ""
+	if i := strings.LastIndex(source, "#"); i >= 0 {
+		url, ref = source[:i], source[i+1:]
+	}
+	name := strings.TrimSuffix(strings.TrimSuffix(strings.TrimRight(url, "/"), "/.git"), ".git")
+	if i := strings.LastIndexAny(name, "/:"); i >= 0 {
+		name = name[i+1:]
+	}
+	if name == "" {
+		return "", nil, fmt.Errorf("Could not determine the template name from '%s'", source)
+	}
+
+	tmp, err := ioutil.TempDir(os.TempDir(), "spiro-template")
+	if err != nil {
+		return "", nil, fmt.Errorf("Unable to setup temporary directory for cloning '%s': %s", source, err.Error())
+	}
+	cleanup := func() { os.RemoveAll(tmp) }
+	dir := filepath.Join(tmp, name)
+
+	logs.Infof("Cloning template '%s'", source)
+	if ref == "" {
+		_, err = runGit(tmp, "clone", "-q", "--depth", "1", url, dir)
+	} else if _, err = runGit(tmp, "clone", "-q", "--depth", "1", "--branch", ref, url, dir); err != nil {
+		// --branch only understands branches and tags, commits need a full clone
+		os.RemoveAll(dir)
+		if _, err = runGit(tmp, "clone", "-q", url, dir); err == nil {
+			_, err = runGit(dir, "checkout", "-q", ref)
+		}
+	}
+	if err != nil {
+		cleanup()
+		return "", nil, fmt.Errorf("Could not clone template '%s': %s", source, err.Error())
+	}
+	return dir, cleanup, nil
+}
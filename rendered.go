@@ -0,0 +1,68 @@
+package main
+
+import (
+	"fmt"
+	"path"
+)
+
+// renderedOutputs records the files produced by the current run so that the 'output' template function can return the
+// content of another generated file. A nil renderedOutputs (eg: in 'spiro test') has no files.
+type renderedOutputs struct {
+	// roots are the directories that relative paths given to 'output' are resolved against, in order
+	roots []string
+	// files maps output files to their rendered or copied content
+	files map[string]string
+	// missing is the path most recently asked for that has not been rendered yet
+	missing string
+}
+
+func newRenderedOutputs() *renderedOutputs {
+	return &renderedOutputs{}
+}
+
+// reset forgets the files of the previous run and resolves relative paths against the given roots from now on.
+func (o *renderedOutputs) reset(roots ...string) {
+	if o == nil {
+		return
+	}
+	o.roots = nil
+	for _, root := range roots {
+		if root != "" {
+			o.roots = append(o.roots, root)
+		}
+	}
+	o.files = make(map[string]string)
+	o.missing = ""
+}
+
+func (o *renderedOutputs) Record(file string, content string) {
+	if o != nil {
+		o.files[file] = content
+	}
+}
+
+// TakeMissing returns and clears the path that the last render asked for before it was rendered.
+func (o *renderedOutputs) TakeMissing() string {
+	if o == nil {
+		return ""
+	}
+	missing := o.missing
+	o.missing = ""
+	return missing
+}
+
+// Output returns the content of a file generated in the same run, given relative to the root of the generated project
+// or to the output directory.
+func (o *renderedOutputs) Output(rel string) (string, error) {
+	if o == nil {
+		return "", fmt.Errorf("rendered files are only available while generating a project")
+	}
+	for _, root := range o.roots {
+		file := path.Join(root, rel)
+		if content, ok := o.files[file]; ok {
+			return content, nil
+		}
+	}
+	o.missing = rel
+	return "", fmt.Errorf("'%s' has not been rendered", rel)
+}
@@ -0,0 +1,487 @@
+// Package schema implements the commonly used subset of JSON Schema needed to validate specs and rendered documents
+// (including the OpenAPI flavoured schemas published for Kubernetes resources and CRDs).
+package schema
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"math"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// ValidationError describes a single place where a value does not match its schema.
+type ValidationError struct {
+	Path    string
+	Message string
+}
+
+func (e ValidationError) Error() string {
+	if e.Path == "" {
+		return e.Message
+	}
+	return fmt.Sprintf("%s: %s", e.Path, e.Message)
+}
+
+// Schema is a loaded schema document along with the location used to resolve relative references.
+type Schema struct {
+	root    interface{}
+	baseDir string
+	docs    map[string]interface{}
+}
+
+// Load reads a JSON schema document from disk. References to other files are resolved relative to its directory.
+func Load(path string) (*Schema, error) {
+	doc, err := readDocument(path)
+	if err != nil {
+		return nil, err
+	}
+	return &Schema{root: doc, baseDir: filepath.Dir(path), docs: map[string]interface{}{}}, nil
+}
+
+// New wraps an already decoded schema document. The document may use either string or interface keyed maps (as
+// produced by the json and yaml decoders respectively).
+func New(doc interface{}) *Schema {
+	return &Schema{root: Normalize(doc), docs: map[string]interface{}{}}
+}
+
+func readDocument(path string) (interface{}, error) {
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var doc interface{}
+	if err := json.Unmarshal(content, &doc); err != nil {
+		return nil, fmt.Errorf("Could not parse schema '%s': %s", path, err.Error())
+	}
+	return doc, nil
+}
+
+// Normalize converts a decoded value into plain JSON types: string keyed maps, slices, float64 numbers, strings,
+// bools and nil.
+func Normalize(in interface{}) interface{} {
+	switch v := in.(type) {
+	case map[string]interface{}:
+		out := make(map[string]interface{}, len(v))
+		for k, item := range v {
+			out[k] = Normalize(item)
+		}
+		return out
+	case map[interface{}]interface{}:
+		out := make(map[string]interface{}, len(v))
+		for k, item := range v {
+			out[fmt.Sprint(k)] = Normalize(item)
+		}
+		return out
+	case []interface{}:
+		out := make([]interface{}, len(v))
+		for i, item := range v {
+			out[i] = Normalize(item)
+		}
+		return out
+	case nil, string, bool, float64:
+		return v
+	}
+	rv := reflect.ValueOf(in)
+	switch rv.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return float64(rv.Int())
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return float64(rv.Uint())
+	case reflect.Float32:
+		return rv.Float()
+	}
+	return fmt.Sprint(in)
+}
+
+// Validate checks the value against the schema and returns every violation found, sorted by path.
+func (s *Schema) Validate(value interface{}) []ValidationError {
+	v := &validator{schema: s}
+	v.validate(s.root, s.root, Normalize(value), "")
+	sort.SliceStable(v.errors, func(i, j int) bool {
+		return v.errors[i].Path < v.errors[j].Path
+	})
+	return v.errors
+}
+
+// Declares reports whether the schema describes the value found by following the keys from the root object, through
+// 'properties', 'patternProperties' or 'additionalProperties', including in 'allOf', 'anyOf' and 'oneOf' branches.
+// Values inside an object schema that lists none of them, such as a free-form map, count as described.
+func (s *Schema) Declares(keys []string) bool {
+	v := &validator{schema: s}
+	return v.declares(s.root, s.root, keys, 0)
+}
+
+// maxReferenceDepth stops Declares from following references that only lead back to themselves.
+const maxReferenceDepth = 32
+
+func (v *validator) declares(doc interface{}, node interface{}, keys []string, depth int) bool {
+	if len(keys) == 0 {
+		return true
+	}
+	if depth > maxReferenceDepth {
+		return false
+	}
+	s, ok := node.(map[string]interface{})
+	if !ok {
+		allowed, _ := node.(bool)
+		return allowed
+	}
+	if ref, ok := s["$ref"].(string); ok {
+		refDoc, target, err := v.resolve(doc, ref)
+		return err == nil && v.declares(refDoc, target, keys, depth+1)
+	}
+	hasBranches := false
+	for _, combinator := range []string{"allOf", "anyOf", "oneOf"} {
+		branches, _ := s[combinator].([]interface{})
+		hasBranches = hasBranches || len(branches) > 0
+		for _, branch := range branches {
+			if v.declares(doc, branch, keys, depth+1) {
+				return true
+			}
+		}
+	}
+	properties, hasProperties := s["properties"].(map[string]interface{})
+	patterns, hasPatterns := s["patternProperties"].(map[string]interface{})
+	additional, hasAdditional := s["additionalProperties"]
+	if sub, ok := properties[keys[0]]; ok && v.declares(doc, sub, keys[1:], depth) {
+		return true
+	}
+	for pattern, sub := range patterns {
+		if re, err := regexp.Compile(pattern); err == nil && re.MatchString(keys[0]) && v.declares(doc, sub, keys[1:], depth) {
+			return true
+		}
+	}
+	if hasAdditional {
+		return v.declares(doc, additional, keys[1:], depth)
+	}
+	return !hasProperties && !hasPatterns && !hasBranches
+}
+
+type validator struct {
+	schema *Schema
+	errors []ValidationError
+}
+
+func (v *validator) fail(path string, format string, args ...interface{}) {
+	v.errors = append(v.errors, ValidationError{Path: path, Message: fmt.Sprintf(format, args...)})
+}
+
+// resolve follows a $ref. References are either local json pointers ('#/definitions/x') or a relative file followed by
+// an optional pointer ('_definitions.json#/definitions/x').
+func (v *validator) resolve(doc interface{}, ref string) (interface{}, interface{}, error) {
+	parts := strings.SplitN(ref, "#", 2)
+	if parts[0] != "" {
+		if v.schema.baseDir == "" {
+			return nil, nil, fmt.Errorf("cannot resolve external reference '%s'", ref)
+		}
+		target := filepath.Join(v.schema.baseDir, filepath.FromSlash(parts[0]))
+		loaded, ok := v.schema.docs[target]
+		if !ok {
+			var err error
+			if loaded, err = readDocument(target); err != nil {
+				return nil, nil, err
+			}
+			v.schema.docs[target] = loaded
+		}
+		doc = loaded
+	}
+	node := doc
+	if len(parts) == 2 && parts[1] != "" {
+		for _, token := range strings.Split(strings.TrimPrefix(parts[1], "/"), "/") {
+			token = strings.Replace(strings.Replace(token, "~1", "/", -1), "~0", "~", -1)
+			switch n := node.(type) {
+			case map[string]interface{}:
+				var ok bool
+				if node, ok = n[token]; !ok {
+					return nil, nil, fmt.Errorf("cannot resolve reference '%s'", ref)
+				}
+			case []interface{}:
+				i, err := strconv.Atoi(token)
+				if err != nil || i < 0 || i >= len(n) {
+					return nil, nil, fmt.Errorf("cannot resolve reference '%s'", ref)
+				}
+				node = n[i]
+			default:
+				return nil, nil, fmt.Errorf("cannot resolve reference '%s'", ref)
+			}
+		}
+	}
+	return doc, node, nil
+}
+
+func typeOf(value interface{}) string {
+	switch v := value.(type) {
+	case nil:
+		return "null"
+	case bool:
+		return "boolean"
+	case string:
+		return "string"
+	case float64:
+		if v == math.Trunc(v) {
+			return "integer"
+		}
+		return "number"
+	case []interface{}:
+		return "array"
+	case map[string]interface{}:
+		return "object"
+	}
+	return "unknown"
+}
+
+func typeMatches(want string, value interface{}) bool {
+	got := typeOf(value)
+	return want == got || (want == "number" && got == "integer")
+}
+
+func childPath(path string, key string) string {
+	if path == "" {
+		return key
+	}
+	return path + "." + key
+}
+
+func number(v interface{}) (float64, bool) {
+	f, ok := v.(float64)
+	return f, ok
+}
+
+func (v *validator) validate(doc interface{}, node interface{}, value interface{}, path string) {
+	switch s := node.(type) {
+	case bool:
+		if !s {
+			v.fail(path, "no value is allowed here")
+		}
+		return
+	case map[string]interface{}:
+		v.validateObject(doc, s, value, path)
+	}
+}
+
+func (v *validator) validateObject(doc interface{}, s map[string]interface{}, value interface{}, path string) {
+	if ref, ok := s["$ref"].(string); ok {
+		refDoc, target, err := v.resolve(doc, ref)
+		if err != nil {
+			v.fail(path, "%s", err.Error())
+			return
+		}
+		v.validate(refDoc, target, value, path)
+		return
+	}
+
+	if value == nil {
+		if nullable, _ := s["nullable"].(bool); nullable {
+			return
+		}
+	}
+
+	if intOrString, _ := s["x-kubernetes-int-or-string"].(bool); intOrString {
+		if t := typeOf(value); t != "integer" && t != "string" {
+			v.fail(path, "expected integer or string but got %s", t)
+		}
+		return
+	}
+
+	switch t := s["type"].(type) {
+	case string:
+		if !typeMatches(t, value) {
+			v.fail(path, "expected %s but got %s", t, typeOf(value))
+			return
+		}
+	case []interface{}:
+		matched := false
+		var names []string
+		for _, item := range t {
+			name, _ := item.(string)
+			names = append(names, name)
+			matched = matched || typeMatches(name, value)
+		}
+		if !matched {
+			v.fail(path, "expected one of [%s] but got %s", strings.Join(names, ", "), typeOf(value))
+			return
+		}
+	}
+
+	if enum, ok := s["enum"].([]interface{}); ok {
+		found := false
+		for _, item := range enum {
+			if reflect.DeepEqual(item, value) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			v.fail(path, "value %s is not one of the allowed values %s", describe(value), describe(enum))
+		}
+	}
+	if c, ok := s["const"]; ok && !reflect.DeepEqual(c, value) {
+		v.fail(path, "value %s must be %s", describe(value), describe(c))
+	}
+
+	switch val := value.(type) {
+	case string:
+		v.validateString(s, val, path)
+	case float64:
+		v.validateNumber(s, val, path)
+	case []interface{}:
+		v.validateArray(doc, s, val, path)
+	case map[string]interface{}:
+		v.validateProperties(doc, s, val, path)
+	}
+
+	if all, ok := s["allOf"].([]interface{}); ok {
+		for _, sub := range all {
+			v.validate(doc, sub, value, path)
+		}
+	}
+	if anyOf, ok := s["anyOf"].([]interface{}); ok {
+		if v.countMatches(doc, anyOf, value, path) == 0 {
+			v.fail(path, "value does not match any of the allowed schemas")
+		}
+	}
+	if oneOf, ok := s["oneOf"].([]interface{}); ok {
+		if n := v.countMatches(doc, oneOf, value, path); n != 1 {
+			v.fail(path, "value must match exactly one of the allowed schemas but matched %d", n)
+		}
+	}
+	if not, ok := s["not"]; ok {
+		if v.countMatches(doc, []interface{}{not}, value, path) == 1 {
+			v.fail(path, "value must not match the disallowed schema")
+		}
+	}
+}
+
+// countMatches returns how many of the given schemas the value satisfies without recording any errors.
+func (v *validator) countMatches(doc interface{}, schemas []interface{}, value interface{}, path string) int {
+	count := 0
+	for _, sub := range schemas {
+		trial := &validator{schema: v.schema}
+		trial.validate(doc, sub, value, path)
+		if len(trial.errors) == 0 {
+			count++
+		}
+	}
+	return count
+}
+
+func (v *validator) validateString(s map[string]interface{}, val string, path string) {
+	length := float64(len([]rune(val)))
+	if min, ok := number(s["minLength"]); ok && length < min {
+		v.fail(path, "string must be at least %v characters long", min)
+	}
+	if max, ok := number(s["maxLength"]); ok && length > max {
+		v.fail(path, "string must be at most %v characters long", max)
+	}
+	if pattern, ok := s["pattern"].(string); ok {
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			v.fail(path, "schema has an invalid pattern '%s'", pattern)
+		} else if !re.MatchString(val) {
+			v.fail(path, "string %q does not match pattern '%s'", val, pattern)
+		}
+	}
+}
+
+func (v *validator) validateNumber(s map[string]interface{}, val float64, path string) {
+	if min, ok := number(s["minimum"]); ok {
+		if exclusive, _ := s["exclusiveMinimum"].(bool); exclusive && val <= min {
+			v.fail(path, "value must be greater than %v", min)
+		} else if val < min {
+			v.fail(path, "value must be at least %v", min)
+		}
+	}
+	if max, ok := number(s["maximum"]); ok {
+		if exclusive, _ := s["exclusiveMaximum"].(bool); exclusive && val >= max {
+			v.fail(path, "value must be less than %v", max)
+		} else if val > max {
+			v.fail(path, "value must be at most %v", max)
+		}
+	}
+	if min, ok := number(s["exclusiveMinimum"]); ok && val <= min {
+		v.fail(path, "value must be greater than %v", min)
+	}
+	if max, ok := number(s["exclusiveMaximum"]); ok && val >= max {
+		v.fail(path, "value must be less than %v", max)
+	}
+}
+
+func (v *validator) validateArray(doc interface{}, s map[string]interface{}, val []interface{}, path string) {
+	if min, ok := number(s["minItems"]); ok && float64(len(val)) < min {
+		v.fail(path, "array must have at least %v items", min)
+	}
+	if max, ok := number(s["maxItems"]); ok && float64(len(val)) > max {
+		v.fail(path, "array must have at most %v items", max)
+	}
+	switch items := s["items"].(type) {
+	case map[string]interface{}, bool:
+		for i, item := range val {
+			v.validate(doc, items, item, fmt.Sprintf("%s[%d]", path, i))
+		}
+	case []interface{}:
+		for i, item := range val {
+			if i < len(items) {
+				v.validate(doc, items[i], item, fmt.Sprintf("%s[%d]", path, i))
+			}
+		}
+	}
+}
+
+func (v *validator) validateProperties(doc interface{}, s map[string]interface{}, val map[string]interface{}, path string) {
+	if required, ok := s["required"].([]interface{}); ok {
+		for _, r := range required {
+			name, _ := r.(string)
+			if _, ok := val[name]; !ok {
+				v.fail(childPath(path, name), "required property is missing")
+			}
+		}
+	}
+
+	properties, _ := s["properties"].(map[string]interface{})
+	patterns, _ := s["patternProperties"].(map[string]interface{})
+	additional, hasAdditional := s["additionalProperties"]
+	if preserve, _ := s["x-kubernetes-preserve-unknown-fields"].(bool); preserve && !hasAdditional {
+		additional, hasAdditional = true, true
+	}
+
+	keys := make([]string, 0, len(val))
+	for k := range val {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		item := val[k]
+		matched := false
+		if sub, ok := properties[k]; ok {
+			v.validate(doc, sub, item, childPath(path, k))
+			matched = true
+		}
+		for pattern, sub := range patterns {
+			if re, err := regexp.Compile(pattern); err == nil && re.MatchString(k) {
+				v.validate(doc, sub, item, childPath(path, k))
+				matched = true
+			}
+		}
+		if !matched && hasAdditional {
+			if allowed, ok := additional.(bool); ok && !allowed {
+				v.fail(childPath(path, k), "property is not allowed")
+			} else if !ok {
+				v.validate(doc, additional, item, childPath(path, k))
+			}
+		}
+	}
+}
+
+func describe(v interface{}) string {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Sprint(v)
+	}
+	return string(b)
+}
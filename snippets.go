@@ -0,0 +1,153 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/AstromechZA/spiro/engine"
+	"github.com/AstromechZA/spiro/schema"
+	"github.com/AstromechZA/spiro/templatefactory"
+)
+
+// snippetsDirName is the directory at the root of a directory template holding its snippets: named blocks of template
+// text that files render with the 'snippet' function. When the manifest declares snippets it is never copied to the
+// output, like the manifest.
+const snippetsDirName = engine.SnippetsDirName
+
+// snippetSchemaSuffix names the JSON Schema that the context of a snippet is validated against, eg:
+// snippets/ci-step.schema.json for snippets/ci-step.yaml.
+const snippetSchemaSuffix = ".schema.json"
+
+// maxSnippetDepth stops snippets that render themselves, directly or through other snippets.
+const maxSnippetDepth = 16
+
+// sharedSnippetDirs are the snippet directories shared between templates, set by the -snippets flag or
+// $SPIRO_SNIPPETS. They are searched after the template's own snippets directory.
+var sharedSnippetDirs = os.Getenv("SPIRO_SNIPPETS")
+
+// snippetLibrary finds and renders the snippets of a run with its template factory, so that snippets can use every
+// template function, including 'snippet' itself.
+type snippetLibrary struct {
+	dirs    []string
+	tf      *templatefactory.TemplateFactory
+	schemas map[string]*schema.Schema
+	depth   int
+	// undeclared is the snippets directory of a template whose manifest doesn't declare snippets, which isn't searched
+	undeclared string
+}
+
+// newSnippetLibrary returns the snippets of a template, when its manifest declares them, followed by the shared ones.
+// inputTemplate can be empty when there is no template directory, eg: with -pipe. A manifest that cannot be read has no
+// snippets here, its errors are reported when it is loaded for rendering.
+func newSnippetLibrary(inputTemplate string, tf *templatefactory.TemplateFactory) *snippetLibrary {
+	l := &snippetLibrary{tf: tf, schemas: make(map[string]*schema.Schema)}
+	if inputTemplate != "" {
+		dir := filepath.Join(inputTemplate, snippetsDirName)
+		if manifest, err := readManifest(inputTemplate); err == nil && manifest.Snippets {
+			l.dirs = append(l.dirs, dir)
+		} else if stat, err := os.Stat(dir); err == nil && stat.IsDir() {
+			l.undeclared = dir
+		}
+	}
+	l.dirs = append(l.dirs, splitList(sharedSnippetDirs)...)
+	return l
+}
+
+// isSnippetFile reports whether a file in a snippets directory is a snippet rather than a parameter schema or a
+// hidden file.
+func isSnippetFile(name string) bool {
+	return !strings.HasSuffix(name, snippetSchemaSuffix) && !strings.HasPrefix(name, ".")
+}
+
+// find returns the file of the named snippet, which is its path below a snippets directory with or without its
+// extension (eg: 'ci/go-test' for snippets/ci/go-test.yaml), and the parameter schema next to it if there is one.
+func (l *snippetLibrary) find(name string) (string, string, error) {
+	clean := path.Clean(name)
+	if name == "" || clean != name || path.IsAbs(name) || strings.HasPrefix(name, "../") {
+		return "", "", fmt.Errorf("invalid snippet name '%s'", name)
+	}
+	for _, dir := range l.dirs {
+		base := filepath.Join(dir, filepath.FromSlash(name))
+		items, err := ioutil.ReadDir(filepath.Dir(base))
+		if err != nil {
+			continue
+		}
+		for _, item := range items {
+			itemName := item.Name()
+			if item.IsDir() || !isSnippetFile(itemName) {
+				continue
+			}
+			if itemName != filepath.Base(base) && strings.TrimSuffix(itemName, filepath.Ext(itemName)) != filepath.Base(base) {
+				continue
+			}
+			file := filepath.Join(filepath.Dir(base), itemName)
+			schemaFile := strings.TrimSuffix(file, filepath.Ext(itemName)) + snippetSchemaSuffix
+			if _, err := os.Stat(schemaFile); err != nil {
+				schemaFile = ""
+			}
+			return file, schemaFile, nil
+		}
+	}
+	var hint string
+	if l.undeclared != "" {
+		hint = fmt.Sprintf(" ('%s' is only searched when %s sets 'snippets: true')", l.undeclared, manifestFileName)
+	}
+	if len(l.dirs) == 0 {
+		return "", "", fmt.Errorf("unknown snippet '%s', there are no snippet directories%s", name, hint)
+	}
+	return "", "", fmt.Errorf("unknown snippet '%s', looked in %s%s", name, strings.Join(l.dirs, ", "), hint)
+}
+
+// Snippet renders the named snippet with ctx as its dot, or with the spec when no context is given. The context is
+// first validated against the snippet's parameter schema, if it has one.
+func (l *snippetLibrary) Snippet(name string, ctx ...interface{}) (string, error) {
+	if l == nil {
+		return "", fmt.Errorf("snippets are only available while rendering a template")
+	}
+	if len(ctx) > 1 {
+		return "", fmt.Errorf("snippet takes a name and at most one context, got %d arguments", len(ctx)+1)
+	}
+	var data interface{}
+	if len(ctx) == 1 {
+		data = ctx[0]
+	} else if spec := l.tf.Spec(); spec != nil {
+		data = *spec
+	}
+	file, schemaFile, err := l.find(name)
+	if err != nil {
+		return "", err
+	}
+	if schemaFile != "" {
+		s, ok := l.schemas[schemaFile]
+		if !ok {
+			if s, err = schema.Load(schemaFile); err != nil {
+				return "", fmt.Errorf("could not load the parameter schema '%s': %s", schemaFile, err.Error())
+			}
+			l.schemas[schemaFile] = s
+		}
+		if errs := s.Validate(data); len(errs) > 0 {
+			problems := make([]string, len(errs))
+			for i, verr := range errs {
+				problems[i] = verr.Error()
+				if verr.Path == "" {
+					problems[i] = "(root): " + verr.Message
+				}
+			}
+			return "", fmt.Errorf("the context of snippet '%s' does not match '%s': %s", name, schemaFile, strings.Join(problems, "; "))
+		}
+	}
+	if l.depth >= maxSnippetDepth {
+		return "", fmt.Errorf("snippet '%s' is nested more than %d deep, does it render itself?", name, maxSnippetDepth)
+	}
+	content, err := ioutil.ReadFile(longPath(file))
+	if err != nil {
+		return "", err
+	}
+	l.depth++
+	defer func() { l.depth-- }()
+	return l.tf.RenderData(filepath.ToSlash(file), string(content), data)
+}
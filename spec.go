@@ -0,0 +1,363 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	yaml "gopkg.in/yaml.v2"
+
+	"github.com/AstromechZA/spiro/engine"
+	"github.com/AstromechZA/spiro/specformat"
+	"github.com/AstromechZA/spiro/templatefactory"
+)
+
+// specFormat is the format of every spec file when it is set by the -spec-format flag. Otherwise TOML, JSON5 and CUE
+// spec files are recognized by their extension and everything else is read as YAML, which includes JSON.
+var specFormat string
+
+const (
+	specFormatTOML  = "toml"
+	specFormatJSON5 = "json5"
+	specFormatCUE   = "cue"
+)
+
+// specFileFormat returns the format that a spec file is decoded from, an empty string for YAML.
+func specFileFormat(specFile string) (string, error) {
+	switch strings.ToLower(specFormat) {
+	case "":
+	case "yaml", "yml", "json":
+		return "", nil
+	case "toml":
+		return specFormatTOML, nil
+	case "json5", "jsonc":
+		return specFormatJSON5, nil
+	case "cue":
+		return specFormatCUE, nil
+	default:
+		return "", fmt.Errorf("Unknown -spec-format '%s', use yaml, json, toml, json5, jsonc or cue", specFormat)
+	}
+	// encrypted spec files are named after the format of their content, eg: secrets.toml.age
+	switch filepath.Ext(strings.TrimSuffix(strings.ToLower(specFile), ".age")) {
+	case ".toml":
+		return specFormatTOML, nil
+	case ".json5", ".jsonc":
+		return specFormatJSON5, nil
+	case ".cue":
+		return specFormatCUE, nil
+	}
+	return "", nil
+}
+
+// convertSpec decodes the content of a TOML or JSON5 spec file, or evaluates a CUE one, and returns it as YAML so that
+// it can be handled like any other spec file. YAML and JSON content is returned unchanged.
+func convertSpec(content []byte, specFile string) ([]byte, error) {
+	format, err := specFileFormat(specFile)
+	if err != nil {
+		return nil, err
+	}
+	var spec map[string]interface{}
+	switch format {
+	case specFormatTOML:
+		spec, err = specformat.DecodeTOML(content)
+	case specFormatJSON5:
+		spec, err = specformat.DecodeJSON5(content)
+	case specFormatCUE:
+		return exportCUE(content, specFile)
+	default:
+		return content, nil
+	}
+	if err != nil {
+		return nil, &templatefactory.SpecParseError{Err: fmt.Errorf("'%s' is not valid %s: %s", specFile, strings.ToUpper(format), err.Error())}
+	}
+	return yaml.Marshal(spec)
+}
+
+// readSpecDir builds a spec from a directory in the same layout as a mounted Kubernetes ConfigMap or Secret: each
+// file becomes a key named after the file with the file contents as a string value. Hidden entries (which includes
+// the '..data' style links that Kubernetes uses to swap mounted content atomically) and subdirectories are ignored.
+// The result is returned as YAML so that it can be handled like any other spec file.
+func readSpecDir(specDir string) ([]byte, error) {
+	items, err := ioutil.ReadDir(specDir)
+	if err != nil {
+		return nil, fmt.Errorf("Could not read spec directory: %s", err.Error())
+	}
+	spec := make(map[string]interface{})
+	for _, item := range items {
+		if strings.HasPrefix(item.Name(), ".") {
+			continue
+		}
+		itemPath := filepath.Join(specDir, item.Name())
+		// mounted keys are usually symlinks so we need to follow them to find out what they are
+		stat, err := os.Stat(itemPath)
+		if err != nil {
+			return nil, fmt.Errorf("Could not read spec directory entry '%s': %s", itemPath, err.Error())
+		}
+		if stat.IsDir() {
+			continue
+		}
+		content, err := ioutil.ReadFile(itemPath)
+		if err != nil {
+			return nil, fmt.Errorf("Could not read spec directory entry '%s': %s", itemPath, err.Error())
+		}
+		spec[item.Name()] = string(content)
+	}
+	return yaml.Marshal(spec)
+}
+
+// applySpecOverrides sets the values of the -set and -set-json flags in the spec, creating any missing maps along their
+// dotted paths.
+func applySpecOverrides(spec map[string]interface{}, overrides []specOverride) error {
+	for _, o := range overrides {
+		var value interface{} = o.value
+		if o.json {
+			if err := json.Unmarshal([]byte(o.value), &value); err != nil {
+				return fmt.Errorf("Could not parse the -set-json value for '%s': %s", o.path, err.Error())
+			}
+			// decode again as YAML so that numbers are typed the same way as in spec files
+			if err := yaml.Unmarshal([]byte(o.value), &value); err != nil {
+				return fmt.Errorf("Could not parse the -set-json value for '%s': %s", o.path, err.Error())
+			}
+			value = normalizeSpecValue(value)
+		}
+		if err := setSpecPath(spec, o.path, value); err != nil {
+			return fmt.Errorf("Could not set '%s' in the spec: %s", o.path, err.Error())
+		}
+	}
+	return nil
+}
+
+// envSpecOverrides turns the environment variables starting with prefix into -set style overrides, in name order.
+// The rest of the variable name is the spec key, with '__' separating nested keys, eg: with the prefix SPIRO_VAR_,
+// SPIRO_VAR_db__port=5432 sets .db.port to the string "5432".
+func envSpecOverrides(prefix string, environ []string) []specOverride {
+	var overrides []specOverride
+	for _, entry := range environ {
+		parts := strings.SplitN(entry, "=", 2)
+		if len(parts) != 2 || !strings.HasPrefix(parts[0], prefix) {
+			continue
+		}
+		key := strings.Trim(strings.Replace(strings.TrimPrefix(parts[0], prefix), "__", ".", -1), ".")
+		if key == "" {
+			continue
+		}
+		overrides = append(overrides, specOverride{path: key, value: parts[1]})
+	}
+	sort.Slice(overrides, func(i, j int) bool { return overrides[i].path < overrides[j].path })
+	return overrides
+}
+
+// uniqueSpecKeys makes decoding a spec fail when a mapping sets the same key twice, instead of the last value silently
+// winning. Keys brought in by '<<' merge keys can still be overridden. Set by the -unique-keys flag.
+var uniqueSpecKeys bool
+
+// decodeSpec parses the content of a JSON or YAML spec file. Aliases and '<<' merge keys are expanded, and the result
+// is normalized so that every nested map has string keys.
+func decodeSpec(content []byte) (map[string]interface{}, error) {
+	var spec map[string]interface{}
+	dec := yaml.NewDecoder(bytes.NewReader(content))
+	if err := dec.Decode(&spec); err != nil {
+		return nil, &templatefactory.SpecParseError{Err: err}
+	}
+	// the decoder lets merged values override the keys written before a '<<' merge key, so the keys written in each
+	// mapping are decoded on their own (ordered mappings leave out merged values) and put back on top
+	var explicit yaml.MapSlice
+	if err := yaml.NewDecoder(bytes.NewReader(content)).Decode(&explicit); err == nil {
+		if uniqueSpecKeys {
+			if err := checkUniqueKeys(explicit, ""); err != nil {
+				return nil, &templatefactory.SpecParseError{Err: err}
+			}
+		}
+		for _, item := range explicit {
+			if k := fmt.Sprint(item.Key); spec[k] != nil {
+				spec[k] = applyExplicitKeys(spec[k], item.Value)
+			}
+		}
+	}
+	for k, v := range spec {
+		spec[k] = normalizeSpecValue(v)
+	}
+	return spec, nil
+}
+
+// applyExplicitKeys puts the values written in the spec back on top of the decoded value, where a '<<' merge key that
+// came after them replaced them.
+func applyExplicitKeys(decoded interface{}, explicit interface{}) interface{} {
+	switch e := explicit.(type) {
+	case yaml.MapSlice:
+		m, ok := decoded.(map[interface{}]interface{})
+		if !ok {
+			return decoded
+		}
+		for _, item := range e {
+			if v, ok := m[item.Key]; ok {
+				m[item.Key] = applyExplicitKeys(v, item.Value)
+			}
+		}
+		return m
+	case []interface{}:
+		l, ok := decoded.([]interface{})
+		if !ok || len(l) != len(e) {
+			return decoded
+		}
+		for i := range l {
+			l[i] = applyExplicitKeys(l[i], e[i])
+		}
+		return l
+	}
+	return explicit
+}
+
+// checkUniqueKeys returns an error naming the first mapping that sets the same key twice.
+func checkUniqueKeys(value interface{}, at string) error {
+	switch v := value.(type) {
+	case yaml.MapSlice:
+		seen := make(map[string]bool, len(v))
+		for _, item := range v {
+			key := fmt.Sprint(item.Key)
+			if seen[key] {
+				if at == "" {
+					return fmt.Errorf("the key '%s' is set more than once", key)
+				}
+				return fmt.Errorf("the key '%s' is set more than once in '%s'", key, at)
+			}
+			seen[key] = true
+			path := key
+			if at != "" {
+				path = at + "." + key
+			}
+			if err := checkUniqueKeys(item.Value, path); err != nil {
+				return err
+			}
+		}
+	case []interface{}:
+		for i, item := range v {
+			if err := checkUniqueKeys(item, fmt.Sprintf("%s[%d]", at, i)); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// normalizeSpecValue converts the map[interface{}]interface{} values produced by the YAML decoder into
+// map[string]interface{}, which is what JSON encoding and most template functions expect.
+func normalizeSpecValue(in interface{}) interface{} {
+	return engine.NormalizeValue(in)
+}
+
+// loadSpecFile reads and parses a spec file or directory.
+func loadSpecFile(specFile string) (map[string]interface{}, error) {
+	content, err := readSpecRaw(specFile)
+	if err != nil {
+		return nil, err
+	}
+	spec, err := decodeSpec(content)
+	if err != nil {
+		return nil, fmt.Errorf("%s (%s)", err.Error(), specFile)
+	}
+	return spec, nil
+}
+
+// readSpecFiles reads the spec files and deep merges them in order, later files winning. A single spec file is returned
+// as it is, the merge of several is returned as YAML.
+func readSpecFiles(specFiles []string) ([]byte, error) {
+	if len(specFiles) == 1 {
+		return readSpecRaw(specFiles[0])
+	}
+	merged := make(map[string]interface{})
+	for _, specFile := range specFiles {
+		spec, err := loadSpecFile(specFile)
+		if err != nil {
+			return nil, err
+		}
+		merged = mergeSpecs(merged, spec)
+	}
+	return yaml.Marshal(merged)
+}
+
+// buildSpec decodes the spec and applies the -profile, -spec-path and -set flags to it, in that order.
+func buildSpec(specContents []byte, profile string, specPath string, overrides []specOverride) (map[string]interface{}, error) {
+	spec, err := decodeSpec(specContents)
+	if err != nil {
+		return nil, err
+	}
+	if spec == nil {
+		spec = make(map[string]interface{})
+	}
+	return refineSpec(spec, profile, specPath, overrides)
+}
+
+// refineSpec applies the -profile, -spec-path and -set flags to a decoded spec, in that order.
+func refineSpec(spec map[string]interface{}, profile string, specPath string, overrides []specOverride) (map[string]interface{}, error) {
+	var err error
+	if profile != "" {
+		if spec, err = selectSpecProfile(spec, profile); err != nil {
+			return nil, err
+		}
+	}
+	if specPath != "" {
+		if spec, err = selectSpecQuery(spec, specPath); err != nil {
+			return nil, err
+		}
+	}
+	if err := applySpecOverrides(spec, overrides); err != nil {
+		return nil, err
+	}
+	return spec, nil
+}
+
+// specProfilesKey is the spec key holding the named variants of the spec that -profile selects from.
+const specProfilesKey = "profiles"
+
+// selectSpecProfile deep merges the named profile from the spec's profiles map over the spec root.
+func selectSpecProfile(spec map[string]interface{}, name string) (map[string]interface{}, error) {
+	profiles, ok := spec[specProfilesKey].(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("Could not select profile '%s': the spec has no '%s' map", name, specProfilesKey)
+	}
+	profile, ok := profiles[name].(map[string]interface{})
+	if !ok {
+		names := make([]string, 0, len(profiles))
+		for k := range profiles {
+			names = append(names, k)
+		}
+		sort.Strings(names)
+		if value, exists := profiles[name]; exists && value == nil {
+			// an empty profile leaves the spec as it is
+			return spec, nil
+		} else if exists {
+			return nil, fmt.Errorf("Could not select profile '%s': it is not a map", name)
+		}
+		return nil, fmt.Errorf("Could not select profile '%s': the spec only has the profiles %s", name, strings.Join(names, ", "))
+	}
+	return mergeSpecs(spec, profile), nil
+}
+
+// mergeSpecs deep merges overlay on top of base and returns the result without modifying either input. Nested maps
+// are merged key by key, anything else in the overlay (including lists) replaces the value in base.
+func mergeSpecs(base, overlay map[string]interface{}) map[string]interface{} {
+	out := make(map[string]interface{}, len(base)+len(overlay))
+	for k, v := range base {
+		out[k] = v
+	}
+	for k, v := range overlay {
+		out[k] = mergeValue(out[k], v)
+	}
+	return out
+}
+
+func mergeValue(base, overlay interface{}) interface{} {
+	switch b := base.(type) {
+	case map[string]interface{}:
+		if o, ok := overlay.(map[string]interface{}); ok {
+			return mergeSpecs(b, o)
+		}
+	}
+	return overlay
+}
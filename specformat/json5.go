@@ -0,0 +1,352 @@
+package specformat
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf16"
+	"unicode/utf8"
+)
+
+// DecodeJSON5 decodes a JSON5 document, which covers JSONC too: JSON with comments, trailing commas, unquoted keys,
+// single quoted strings, hexadecimal numbers, Infinity and NaN. The document must be an object.
+func DecodeJSON5(content []byte) (map[string]interface{}, error) {
+	p := &json5Parser{src: strings.TrimPrefix(string(content), "\ufeff")}
+	value, err := p.value()
+	if err == nil {
+		if err = p.skipBlank(); err == nil && !p.eof() {
+			err = fmt.Errorf("unexpected '%c' after the document", p.peekRune())
+		}
+	}
+	if err != nil {
+		return nil, fmt.Errorf("line %d: %s", 1+strings.Count(p.src[:p.pos], "\n"), err.Error())
+	}
+	switch v := value.(type) {
+	case map[string]interface{}:
+		return v, nil
+	case nil:
+		return nil, nil
+	}
+	return nil, fmt.Errorf("the document must be an object")
+}
+
+type json5Parser struct {
+	src string
+	pos int
+}
+
+func (p *json5Parser) eof() bool {
+	return p.pos >= len(p.src)
+}
+
+func (p *json5Parser) peekRune() rune {
+	r, _ := utf8.DecodeRuneInString(p.src[p.pos:])
+	return r
+}
+
+// skipBlank skips whitespace and comments.
+func (p *json5Parser) skipBlank() error {
+	for !p.eof() {
+		rest := p.src[p.pos:]
+		r, size := utf8.DecodeRuneInString(rest)
+		switch {
+		case unicode.IsSpace(r) || r == '\ufeff':
+			p.pos += size
+		case strings.HasPrefix(rest, "//"):
+			end := strings.IndexAny(rest, "\n\r\u2028\u2029")
+			if end < 0 {
+				end = len(rest)
+			}
+			p.pos += end
+		case strings.HasPrefix(rest, "/*"):
+			end := strings.Index(rest[2:], "*/")
+			if end < 0 {
+				return fmt.Errorf("unterminated comment")
+			}
+			p.pos += end + 4
+		default:
+			return nil
+		}
+	}
+	return nil
+}
+
+func (p *json5Parser) value() (interface{}, error) {
+	if err := p.skipBlank(); err != nil {
+		return nil, err
+	}
+	if p.eof() {
+		return nil, fmt.Errorf("expected a value")
+	}
+	switch c := p.src[p.pos]; {
+	case c == '{':
+		p.pos++
+		return p.object()
+	case c == '[':
+		p.pos++
+		return p.array()
+	case c == '"' || c == '\'':
+		p.pos++
+		return p.str(c)
+	case c == '-' || c == '+' || c == '.' || c >= '0' && c <= '9' || c == 'I' || c == 'N':
+		return p.number()
+	}
+	switch word := p.identifier(); word {
+	case "true":
+		return true, nil
+	case "false":
+		return false, nil
+	case "null":
+		return nil, nil
+	case "":
+		return nil, fmt.Errorf("unexpected '%c', expected a value", p.peekRune())
+	default:
+		return nil, fmt.Errorf("unexpected '%s', expected a value", word)
+	}
+}
+
+func (p *json5Parser) object() (interface{}, error) {
+	out := make(map[string]interface{})
+	for {
+		if err := p.skipBlank(); err != nil {
+			return nil, err
+		}
+		if !p.eof() && p.src[p.pos] == '}' {
+			p.pos++
+			return out, nil
+		}
+		var key string
+		var err error
+		if !p.eof() && (p.src[p.pos] == '"' || p.src[p.pos] == '\'') {
+			p.pos++
+			key, err = p.str(p.src[p.pos-1])
+			if err != nil {
+				return nil, err
+			}
+		} else if key = p.identifier(); key == "" {
+			if p.eof() {
+				return nil, fmt.Errorf("unterminated object")
+			}
+			return nil, fmt.Errorf("unexpected '%c', expected a key", p.peekRune())
+		}
+		if err := p.skipBlank(); err != nil {
+			return nil, err
+		}
+		if p.eof() || p.src[p.pos] != ':' {
+			return nil, fmt.Errorf("expected ':' after the key '%s'", key)
+		}
+		p.pos++
+		if out[key], err = p.value(); err != nil {
+			return nil, err
+		}
+		if err := p.skipBlank(); err != nil {
+			return nil, err
+		}
+		switch {
+		case p.eof():
+			return nil, fmt.Errorf("unterminated object")
+		case p.src[p.pos] == ',':
+			p.pos++
+		case p.src[p.pos] != '}':
+			return nil, fmt.Errorf("expected ',' or '}' after the value of '%s'", key)
+		}
+	}
+}
+
+func (p *json5Parser) array() (interface{}, error) {
+	out := []interface{}{}
+	for {
+		if err := p.skipBlank(); err != nil {
+			return nil, err
+		}
+		if !p.eof() && p.src[p.pos] == ']' {
+			p.pos++
+			return out, nil
+		}
+		value, err := p.value()
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, value)
+		if err := p.skipBlank(); err != nil {
+			return nil, err
+		}
+		switch {
+		case p.eof():
+			return nil, fmt.Errorf("unterminated array")
+		case p.src[p.pos] == ',':
+			p.pos++
+		case p.src[p.pos] != ']':
+			return nil, fmt.Errorf("expected ',' or ']' in the array")
+		}
+	}
+}
+
+// identifier parses an unquoted key or a literal like true.
+func (p *json5Parser) identifier() string {
+	start := p.pos
+	for !p.eof() {
+		r, size := utf8.DecodeRuneInString(p.src[p.pos:])
+		if !(r == '_' || r == '$' || unicode.IsLetter(r) || p.pos > start && (unicode.IsDigit(r) || unicode.In(r, unicode.Mn, unicode.Mc, unicode.Pc))) {
+			break
+		}
+		p.pos += size
+	}
+	return p.src[start:p.pos]
+}
+
+// str parses the rest of a string quoted with quote.
+func (p *json5Parser) str(quote byte) (string, error) {
+	var b strings.Builder
+	for {
+		if p.eof() {
+			return "", fmt.Errorf("unterminated string")
+		}
+		c := p.src[p.pos]
+		switch {
+		case c == quote:
+			p.pos++
+			return b.String(), nil
+		case c == '\n' || c == '\r':
+			return "", fmt.Errorf("unterminated string")
+		case c == '\\':
+			if err := p.escape(&b); err != nil {
+				return "", err
+			}
+		default:
+			b.WriteByte(c)
+			p.pos++
+		}
+	}
+}
+
+func (p *json5Parser) escape(b *strings.Builder) error {
+	p.pos++
+	if p.eof() {
+		return fmt.Errorf("unterminated string")
+	}
+	r, size := utf8.DecodeRuneInString(p.src[p.pos:])
+	p.pos += size
+	switch r {
+	case 'b':
+		b.WriteByte('\b')
+	case 'f':
+		b.WriteByte('\f')
+	case 'n':
+		b.WriteByte('\n')
+	case 'r':
+		b.WriteByte('\r')
+	case 't':
+		b.WriteByte('\t')
+	case 'v':
+		b.WriteByte('\v')
+	case '0':
+		if !p.eof() && p.src[p.pos] >= '0' && p.src[p.pos] <= '9' {
+			return fmt.Errorf("octal escapes are not allowed")
+		}
+		b.WriteByte(0)
+	case 'x', 'u':
+		size := 2
+		if r == 'u' {
+			size = 4
+		}
+		code, err := p.hexDigits(size)
+		if err != nil {
+			return err
+		}
+		// characters outside the basic plane are written as a pair of escaped surrogates
+		if utf16.IsSurrogate(rune(code)) && strings.HasPrefix(p.src[p.pos:], "\\u") {
+			p.pos += 2
+			low, err := p.hexDigits(4)
+			if err != nil {
+				return err
+			}
+			b.WriteRune(utf16.DecodeRune(rune(code), rune(low)))
+			return nil
+		}
+		b.WriteRune(rune(code))
+	case '\r':
+		// a backslash before a line break continues the string on the next line
+		if !p.eof() && p.src[p.pos] == '\n' {
+			p.pos++
+		}
+	case '\n', '\u2028', '\u2029':
+	default:
+		if r >= '1' && r <= '9' {
+			return fmt.Errorf("invalid escape sequence '\\%c'", r)
+		}
+		b.WriteRune(r)
+	}
+	return nil
+}
+
+func (p *json5Parser) hexDigits(size int) (uint64, error) {
+	if p.pos+size > len(p.src) {
+		return 0, fmt.Errorf("invalid hexadecimal escape")
+	}
+	code, err := strconv.ParseUint(p.src[p.pos:p.pos+size], 16, 32)
+	if err != nil {
+		return 0, fmt.Errorf("invalid hexadecimal escape '%s'", p.src[p.pos:p.pos+size])
+	}
+	p.pos += size
+	return code, nil
+}
+
+// number parses decimal and hexadecimal numbers, Infinity and NaN, with an optional sign. Numbers without a fraction or
+// exponent are integers when they fit in an int64.
+func (p *json5Parser) number() (interface{}, error) {
+	start := p.pos
+	sign := 1.0
+	if c := p.src[p.pos]; c == '+' || c == '-' {
+		if c == '-' {
+			sign = -1
+		}
+		p.pos++
+	}
+	rest := p.src[p.pos:]
+	switch {
+	case strings.HasPrefix(rest, "Infinity"):
+		p.pos += len("Infinity")
+		return math.Inf(int(sign)), nil
+	case strings.HasPrefix(rest, "NaN"):
+		p.pos += len("NaN")
+		return math.NaN(), nil
+	case strings.HasPrefix(rest, "0x") || strings.HasPrefix(rest, "0X"):
+		p.pos += 2
+		digits := p.pos
+		for !p.eof() && strings.IndexByte("0123456789abcdefABCDEF", p.src[p.pos]) >= 0 {
+			p.pos++
+		}
+		i, err := strconv.ParseInt(p.src[digits:p.pos], 16, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid number '%s'", p.src[start:p.pos])
+		}
+		return int64(sign) * i, nil
+	}
+	isFloat := false
+	for !p.eof() {
+		c := p.src[p.pos]
+		if c == '.' || c == 'e' || c == 'E' || (c == '+' || c == '-') && (p.src[p.pos-1] == 'e' || p.src[p.pos-1] == 'E') {
+			isFloat = true
+		} else if c < '0' || c > '9' {
+			break
+		}
+		p.pos++
+	}
+	token := p.src[start:p.pos]
+	plain := strings.TrimPrefix(token, "+")
+	if !isFloat {
+		if i, err := strconv.ParseInt(plain, 10, 64); err == nil {
+			return i, nil
+		}
+	}
+	// strconv accepts '.5' and '5.' like JSON5 does
+	f, err := strconv.ParseFloat(plain, 64)
+	// like JSON, leading zeros are not allowed
+	if digits := strings.TrimPrefix(plain, "-"); err != nil || len(digits) > 1 && digits[0] == '0' && digits[1] >= '0' && digits[1] <= '9' {
+		return nil, fmt.Errorf("invalid number '%s'", token)
+	}
+	return f, nil
+}
@@ -0,0 +1,610 @@
+// Package specformat decodes the spec file formats other than YAML and JSON: TOML and JSON5 (which includes JSONC).
+// Documents are decoded into the same types as YAML specs: maps with string keys, lists, strings, bools, int64 and
+// float64 values.
+package specformat
+
+import (
+	"fmt"
+	"math"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// DecodeTOML decodes a TOML v1.0 document. Dates and times are decoded as strings, like YAML timestamps in specs.
+func DecodeTOML(content []byte) (map[string]interface{}, error) {
+	p := &tomlParser{src: string(content), root: make(map[string]interface{}), defined: make(map[uintptr]bool)}
+	p.current = p.root
+	if err := p.parse(); err != nil {
+		return nil, fmt.Errorf("line %d: %s", p.line(), err.Error())
+	}
+	return p.root, nil
+}
+
+type tomlParser struct {
+	src     string
+	pos     int
+	root    map[string]interface{}
+	current map[string]interface{}
+	// defined records the tables created by a [table] header, which cannot be defined again
+	defined map[uintptr]bool
+	// frozen records the inline tables and static arrays, which cannot be extended
+	frozen map[uintptr]bool
+}
+
+func (p *tomlParser) line() int {
+	return 1 + strings.Count(p.src[:p.pos], "\n")
+}
+
+func (p *tomlParser) eof() bool {
+	return p.pos >= len(p.src)
+}
+
+func (p *tomlParser) peek() byte {
+	if p.eof() {
+		return 0
+	}
+	return p.src[p.pos]
+}
+
+func (p *tomlParser) skipSpace() {
+	for !p.eof() && (p.peek() == ' ' || p.peek() == '\t') {
+		p.pos++
+	}
+}
+
+// skipComment skips a '#' comment up to the end of the line.
+func (p *tomlParser) skipComment() {
+	if p.peek() == '#' {
+		for !p.eof() && p.peek() != '\n' {
+			p.pos++
+		}
+	}
+}
+
+// skipBlank skips whitespace, newlines and comments, as allowed inside arrays.
+func (p *tomlParser) skipBlank() {
+	for {
+		p.skipSpace()
+		p.skipComment()
+		if p.peek() == '\n' {
+			p.pos++
+		} else if strings.HasPrefix(p.src[p.pos:], "\r\n") {
+			p.pos += 2
+		} else {
+			return
+		}
+	}
+}
+
+// endOfLine expects nothing but a comment up to the end of the line.
+func (p *tomlParser) endOfLine() error {
+	p.skipSpace()
+	p.skipComment()
+	switch {
+	case p.eof():
+	case p.peek() == '\n':
+		p.pos++
+	case strings.HasPrefix(p.src[p.pos:], "\r\n"):
+		p.pos += 2
+	default:
+		return fmt.Errorf("unexpected '%c', expected the end of the line", p.peek())
+	}
+	return nil
+}
+
+func (p *tomlParser) parse() error {
+	for {
+		p.skipBlank()
+		if p.eof() {
+			return nil
+		}
+		var err error
+		switch {
+		case strings.HasPrefix(p.src[p.pos:], "[["):
+			p.pos += 2
+			err = p.arrayTableHeader()
+		case p.peek() == '[':
+			p.pos++
+			err = p.tableHeader()
+		default:
+			err = p.keyValue(p.current)
+		}
+		if err == nil {
+			err = p.endOfLine()
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+func mapID(m map[string]interface{}) uintptr {
+	return reflect.ValueOf(m).Pointer()
+}
+
+// table returns the table at a key inside another one, creating it when create is set. The last table of an array of
+// tables stands for the array.
+func (p *tomlParser) table(parent map[string]interface{}, key string, create bool) (map[string]interface{}, error) {
+	switch v := parent[key].(type) {
+	case nil:
+		if !create {
+			return nil, nil
+		}
+		t := make(map[string]interface{})
+		parent[key] = t
+		return t, nil
+	case map[string]interface{}:
+		if p.frozen[mapID(v)] {
+			return nil, fmt.Errorf("cannot extend the inline table '%s'", key)
+		}
+		return v, nil
+	case []interface{}:
+		if len(v) > 0 {
+			if t, ok := v[len(v)-1].(map[string]interface{}); ok && !p.frozen[mapID(t)] {
+				return t, nil
+			}
+		}
+		return nil, fmt.Errorf("'%s' is an array, not a table", key)
+	}
+	return nil, fmt.Errorf("'%s' is already set to a value, not a table", key)
+}
+
+func (p *tomlParser) tableHeader() error {
+	keys, err := p.key()
+	if err != nil {
+		return err
+	}
+	p.skipSpace()
+	if p.peek() != ']' {
+		return fmt.Errorf("expected ']' after the table name")
+	}
+	p.pos++
+	t := p.root
+	for _, k := range keys {
+		if t, err = p.table(t, k, true); err != nil {
+			return err
+		}
+	}
+	if _, isArray := p.parentValue(keys).([]interface{}); isArray || p.defined[mapID(t)] {
+		return fmt.Errorf("table '%s' is defined more than once", strings.Join(keys, "."))
+	}
+	p.defined[mapID(t)] = true
+	p.current = t
+	return nil
+}
+
+// parentValue returns the value at a table path, following the last table of arrays of tables.
+func (p *tomlParser) parentValue(keys []string) interface{} {
+	t := p.root
+	for i, k := range keys {
+		if i == len(keys)-1 {
+			return t[k]
+		}
+		t, _ = p.table(t, k, false)
+		if t == nil {
+			return nil
+		}
+	}
+	return nil
+}
+
+func (p *tomlParser) arrayTableHeader() error {
+	keys, err := p.key()
+	if err != nil {
+		return err
+	}
+	p.skipSpace()
+	if !strings.HasPrefix(p.src[p.pos:], "]]") {
+		return fmt.Errorf("expected ']]' after the array of tables name")
+	}
+	p.pos += 2
+	t := p.root
+	for _, k := range keys[:len(keys)-1] {
+		if t, err = p.table(t, k, true); err != nil {
+			return err
+		}
+	}
+	last := keys[len(keys)-1]
+	entry := make(map[string]interface{})
+	switch v := t[last].(type) {
+	case nil:
+		t[last] = []interface{}{entry}
+	case []interface{}:
+		if p.frozen[reflect.ValueOf(v).Pointer()] {
+			return fmt.Errorf("cannot append to the static array '%s'", strings.Join(keys, "."))
+		}
+		t[last] = append(v, entry)
+	default:
+		return fmt.Errorf("'%s' is already set to a value, not an array of tables", strings.Join(keys, "."))
+	}
+	p.current = entry
+	return nil
+}
+
+// keyValue parses 'key = value' into the table, dotted keys create the tables along the way.
+func (p *tomlParser) keyValue(t map[string]interface{}) error {
+	keys, err := p.key()
+	if err != nil {
+		return err
+	}
+	p.skipSpace()
+	if p.peek() != '=' {
+		return fmt.Errorf("expected '=' after the key '%s'", strings.Join(keys, "."))
+	}
+	p.pos++
+	p.skipSpace()
+	value, err := p.value()
+	if err != nil {
+		return err
+	}
+	for _, k := range keys[:len(keys)-1] {
+		next, err := p.table(t, k, true)
+		if err != nil {
+			return err
+		}
+		if p.defined[mapID(next)] && mapID(next) != mapID(p.current) {
+			return fmt.Errorf("cannot add keys to the table '%s' with dotted keys after it was defined", k)
+		}
+		t = next
+	}
+	last := keys[len(keys)-1]
+	if _, exists := t[last]; exists {
+		return fmt.Errorf("key '%s' is defined more than once", strings.Join(keys, "."))
+	}
+	t[last] = value
+	return nil
+}
+
+// key parses a bare, quoted or dotted key into its parts.
+func (p *tomlParser) key() ([]string, error) {
+	var keys []string
+	for {
+		p.skipSpace()
+		var k string
+		var err error
+		switch c := p.peek(); {
+		case c == '"':
+			p.pos++
+			k, err = p.basicString()
+		case c == '\'':
+			p.pos++
+			k, err = p.literalString()
+		default:
+			start := p.pos
+			for !p.eof() && isBareKeyChar(p.peek()) {
+				p.pos++
+			}
+			if start == p.pos {
+				if p.eof() {
+					return nil, fmt.Errorf("expected a key")
+				}
+				return nil, fmt.Errorf("unexpected '%c', expected a key", p.peek())
+			}
+			k = p.src[start:p.pos]
+		}
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, k)
+		p.skipSpace()
+		if p.peek() != '.' {
+			return keys, nil
+		}
+		p.pos++
+	}
+}
+
+func isBareKeyChar(c byte) bool {
+	return c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '_' || c == '-'
+}
+
+func (p *tomlParser) value() (interface{}, error) {
+	rest := p.src[p.pos:]
+	switch {
+	case strings.HasPrefix(rest, `"""`):
+		p.pos += 3
+		return p.multilineBasicString()
+	case strings.HasPrefix(rest, `'''`):
+		p.pos += 3
+		return p.multilineLiteralString()
+	case strings.HasPrefix(rest, `"`):
+		p.pos++
+		return p.basicString()
+	case strings.HasPrefix(rest, `'`):
+		p.pos++
+		return p.literalString()
+	case strings.HasPrefix(rest, "["):
+		p.pos++
+		return p.array()
+	case strings.HasPrefix(rest, "{"):
+		p.pos++
+		return p.inlineTable()
+	}
+	return p.scalar()
+}
+
+func (p *tomlParser) array() (interface{}, error) {
+	out := []interface{}{}
+	for {
+		p.skipBlank()
+		if p.peek() == ']' {
+			p.pos++
+			p.freeze(out)
+			return out, nil
+		}
+		value, err := p.value()
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, value)
+		p.skipBlank()
+		switch p.peek() {
+		case ',':
+			p.pos++
+		case ']':
+		default:
+			return nil, fmt.Errorf("expected ',' or ']' in the array")
+		}
+	}
+}
+
+// freeze marks an inline table or a static array, and the tables inside it, as complete.
+func (p *tomlParser) freeze(value interface{}) {
+	if p.frozen == nil {
+		p.frozen = make(map[uintptr]bool)
+	}
+	switch v := value.(type) {
+	case map[string]interface{}:
+		p.frozen[mapID(v)] = true
+	case []interface{}:
+		if len(v) > 0 {
+			p.frozen[reflect.ValueOf(v).Pointer()] = true
+		}
+		for _, item := range v {
+			p.freeze(item)
+		}
+	}
+}
+
+func (p *tomlParser) inlineTable() (interface{}, error) {
+	out := make(map[string]interface{})
+	p.skipSpace()
+	if p.peek() == '}' {
+		p.pos++
+		p.freeze(out)
+		return out, nil
+	}
+	for {
+		if err := p.keyValue(out); err != nil {
+			return nil, err
+		}
+		p.skipSpace()
+		switch p.peek() {
+		case ',':
+			p.pos++
+		case '}':
+			p.pos++
+			p.freeze(out)
+			return out, nil
+		default:
+			return nil, fmt.Errorf("expected ',' or '}' in the inline table")
+		}
+	}
+}
+
+// basicString parses the rest of a "string" with escapes.
+func (p *tomlParser) basicString() (string, error) {
+	var b strings.Builder
+	for {
+		if p.eof() || p.peek() == '\n' {
+			return "", fmt.Errorf("unterminated string")
+		}
+		c := p.src[p.pos]
+		switch c {
+		case '"':
+			p.pos++
+			return b.String(), nil
+		case '\\':
+			if err := p.escape(&b); err != nil {
+				return "", err
+			}
+		default:
+			b.WriteByte(c)
+			p.pos++
+		}
+	}
+}
+
+func (p *tomlParser) multilineBasicString() (string, error) {
+	var b strings.Builder
+	p.trimLeadingNewline()
+	for {
+		if p.eof() {
+			return "", fmt.Errorf("unterminated multi-line string")
+		}
+		rest := p.src[p.pos:]
+		switch {
+		case strings.HasPrefix(rest, `"""`):
+			// up to two quotes can come right before the closing ones
+			n := len(rest) - len(strings.TrimLeft(rest, `"`))
+			if n > 5 {
+				return "", fmt.Errorf("too many quotes at the end of a multi-line string")
+			}
+			b.WriteString(strings.Repeat(`"`, n-3))
+			p.pos += n
+			return b.String(), nil
+		case rest[0] == '\\' && isLineEndingBackslash(rest[1:]):
+			// a backslash at the end of a line trims the whitespace and newlines that follow it
+			p.pos++
+			for !p.eof() && strings.IndexByte(" \t\r\n", p.peek()) >= 0 {
+				p.pos++
+			}
+		case rest[0] == '\\':
+			if err := p.escape(&b); err != nil {
+				return "", err
+			}
+		default:
+			b.WriteByte(rest[0])
+			p.pos++
+		}
+	}
+}
+
+func isLineEndingBackslash(rest string) bool {
+	trimmed := strings.TrimLeft(rest, " \t")
+	return strings.HasPrefix(trimmed, "\n") || strings.HasPrefix(trimmed, "\r\n")
+}
+
+func (p *tomlParser) trimLeadingNewline() {
+	if p.peek() == '\n' {
+		p.pos++
+	} else if strings.HasPrefix(p.src[p.pos:], "\r\n") {
+		p.pos += 2
+	}
+}
+
+func (p *tomlParser) escape(b *strings.Builder) error {
+	if p.pos+1 >= len(p.src) {
+		return fmt.Errorf("unterminated escape sequence")
+	}
+	c := p.src[p.pos+1]
+	p.pos += 2
+	switch c {
+	case 'b':
+		b.WriteByte('\b')
+	case 't':
+		b.WriteByte('\t')
+	case 'n':
+		b.WriteByte('\n')
+	case 'f':
+		b.WriteByte('\f')
+	case 'r':
+		b.WriteByte('\r')
+	case '"':
+		b.WriteByte('"')
+	case '\\':
+		b.WriteByte('\\')
+	case 'u', 'U':
+		size := 4
+		if c == 'U' {
+			size = 8
+		}
+		if p.pos+size > len(p.src) {
+			return fmt.Errorf("invalid unicode escape")
+		}
+		code, err := strconv.ParseUint(p.src[p.pos:p.pos+size], 16, 32)
+		if err != nil || !utf8.ValidRune(rune(code)) {
+			return fmt.Errorf("invalid unicode escape '\\%c%s'", c, p.src[p.pos:p.pos+size])
+		}
+		b.WriteRune(rune(code))
+		p.pos += size
+	default:
+		return fmt.Errorf("invalid escape sequence '\\%c'", c)
+	}
+	return nil
+}
+
+// literalString parses the rest of a 'string' without escapes.
+func (p *tomlParser) literalString() (string, error) {
+	end := strings.IndexAny(p.src[p.pos:], "'\n")
+	if end < 0 || p.src[p.pos+end] != '\'' {
+		return "", fmt.Errorf("unterminated string")
+	}
+	s := p.src[p.pos : p.pos+end]
+	p.pos += end + 1
+	return s, nil
+}
+
+func (p *tomlParser) multilineLiteralString() (string, error) {
+	p.trimLeadingNewline()
+	end := strings.Index(p.src[p.pos:], "'''")
+	if end < 0 {
+		return "", fmt.Errorf("unterminated multi-line string")
+	}
+	// up to two quotes can come right before the closing ones
+	for extra := 0; extra < 2 && strings.HasPrefix(p.src[p.pos+end+1:], "'''"); extra++ {
+		end++
+	}
+	s := p.src[p.pos : p.pos+end]
+	p.pos += end + 3
+	return s, nil
+}
+
+var (
+	tomlDate     = regexp.MustCompile(`^\d{4}-\d{2}-\d{2}$`)
+	tomlDateTime = regexp.MustCompile(`^(\d{4}-\d{2}-\d{2}([Tt ]\d{2}:\d{2}:\d{2}(\.\d+)?([Zz]|[+-]\d{2}:\d{2})?)?|\d{2}:\d{2}:\d{2}(\.\d+)?)$`)
+	tomlInteger  = regexp.MustCompile(`^[+-]?(0|[1-9](_?[0-9])*)$`)
+	tomlHex      = regexp.MustCompile(`^0x[0-9A-Fa-f](_?[0-9A-Fa-f])*$`)
+	tomlOctal    = regexp.MustCompile(`^0o[0-7](_?[0-7])*$`)
+	tomlBinary   = regexp.MustCompile(`^0b[01](_?[01])*$`)
+	tomlFloat    = regexp.MustCompile(`^[+-]?(0|[1-9](_?[0-9])*)((\.[0-9](_?[0-9])*)([eE][+-]?[0-9](_?[0-9])*)?|[eE][+-]?[0-9](_?[0-9])*)$`)
+)
+
+// scalar parses booleans, numbers, dates and times.
+func (p *tomlParser) scalar() (interface{}, error) {
+	start := p.pos
+	for !p.eof() && (strings.IndexByte("+-._:", p.peek()) >= 0 || isBareKeyChar(p.peek())) {
+		p.pos++
+	}
+	token := p.src[start:p.pos]
+	// a date and a time can be separated by a space
+	if tomlDate.MatchString(token) && p.peek() == ' ' && p.pos+3 < len(p.src) && isDigit(p.src[p.pos+1]) && isDigit(p.src[p.pos+2]) && p.src[p.pos+3] == ':' {
+		p.pos++
+		for !p.eof() && (strings.IndexByte("+-.:Zz", p.peek()) >= 0 || isDigit(p.peek())) {
+			p.pos++
+		}
+		token = p.src[start:p.pos]
+	}
+	switch token {
+	case "true":
+		return true, nil
+	case "false":
+		return false, nil
+	case "inf", "+inf":
+		return math.Inf(1), nil
+	case "-inf":
+		return math.Inf(-1), nil
+	case "nan", "+nan", "-nan":
+		return math.NaN(), nil
+	case "":
+		if p.eof() {
+			return nil, fmt.Errorf("expected a value")
+		}
+		return nil, fmt.Errorf("unexpected '%c', expected a value", p.peek())
+	}
+	plain := strings.Replace(token, "_", "", -1)
+	switch {
+	case tomlDateTime.MatchString(token):
+		return token, nil
+	case tomlInteger.MatchString(token):
+		return parseTOMLInt(token, plain, 10)
+	case tomlHex.MatchString(token):
+		return parseTOMLInt(token, plain[2:], 16)
+	case tomlOctal.MatchString(token):
+		return parseTOMLInt(token, plain[2:], 8)
+	case tomlBinary.MatchString(token):
+		return parseTOMLInt(token, plain[2:], 2)
+	case tomlFloat.MatchString(token):
+		f, err := strconv.ParseFloat(plain, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid float '%s'", token)
+		}
+		return f, nil
+	}
+	return nil, fmt.Errorf("invalid value '%s'", token)
+}
+
+func parseTOMLInt(token string, digits string, base int) (interface{}, error) {
+	i, err := strconv.ParseInt(digits, base, 64)
+	if err != nil {
+		return nil, fmt.Errorf("invalid integer '%s'", token)
+	}
+	return i, nil
+}
+
+func isDigit(c byte) bool {
+	return c >= '0' && c <= '9'
+}
@@ -0,0 +1,135 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// parseSpecQuery parses a jq style path such as '.services[0].config' or '.["dotted.key"][-1]' into its steps: string
+// map keys and int list indexes. Negative indexes count from the end of a list. '.' on its own selects everything.
+func parseSpecQuery(query string) ([]interface{}, error) {
+	var steps []interface{}
+	rest := strings.TrimSpace(query)
+	if !strings.HasPrefix(rest, ".") && !strings.HasPrefix(rest, "[") {
+		return nil, fmt.Errorf("Invalid spec path '%s': it should start with '.'", query)
+	}
+	if rest == "." {
+		return nil, nil
+	}
+	for rest != "" {
+		switch {
+		case strings.HasPrefix(rest, ".["):
+			// like jq, '.[0]' is the same as '[0]'
+			rest = rest[1:]
+		case strings.HasPrefix(rest, ".\"") || strings.HasPrefix(rest, "[\""):
+			closing := "\""
+			if rest[0] == '[' {
+				closing = "\"]"
+			}
+			end := strings.Index(rest[2:], closing)
+			if end < 0 {
+				return nil, fmt.Errorf("Invalid spec path '%s': unterminated quoted key", query)
+			}
+			steps = append(steps, rest[2:2+end])
+			rest = rest[2+end+len(closing):]
+		case strings.HasPrefix(rest, "["):
+			end := strings.Index(rest, "]")
+			if end < 0 {
+				return nil, fmt.Errorf("Invalid spec path '%s': unterminated '['", query)
+			}
+			index, err := strconv.Atoi(strings.TrimSpace(rest[1:end]))
+			if err != nil {
+				return nil, fmt.Errorf("Invalid spec path '%s': '%s' is not a list index", query, rest[1:end])
+			}
+			steps = append(steps, index)
+			rest = rest[end+1:]
+		case strings.HasPrefix(rest, "."):
+			end := strings.IndexAny(rest[1:], ".[")
+			if end < 0 {
+				end = len(rest) - 1
+			}
+			if end == 0 {
+				return nil, fmt.Errorf("Invalid spec path '%s': empty key", query)
+			}
+			steps = append(steps, rest[1:1+end])
+			rest = rest[1+end:]
+		default:
+			return nil, fmt.Errorf("Invalid spec path '%s': unexpected '%s'", query, rest)
+		}
+	}
+	return steps, nil
+}
+
+// selectSpecQuery returns the part of the spec selected by a jq style path, which must be a map to be used as the
+// render context.
+func selectSpecQuery(spec map[string]interface{}, query string) (map[string]interface{}, error) {
+	steps, err := parseSpecQuery(query)
+	if err != nil {
+		return nil, err
+	}
+	var current interface{} = spec
+	for i, step := range steps {
+		parent, at := formatSpecQuery(steps[:i]), formatSpecQuery(steps[:i+1])
+		switch s := step.(type) {
+		case string:
+			m, ok := current.(map[string]interface{})
+			if !ok {
+				return nil, fmt.Errorf("Could not select '%s' from the spec: '%s' is %s, not a map", query, parent, describeSpecValue(current))
+			}
+			if current, ok = m[s]; !ok {
+				return nil, fmt.Errorf("Could not select '%s' from the spec: '%s' is not set", query, at)
+			}
+		case int:
+			l, ok := current.([]interface{})
+			if !ok {
+				return nil, fmt.Errorf("Could not select '%s' from the spec: '%s' is %s, not a list", query, parent, describeSpecValue(current))
+			}
+			if s < 0 {
+				s += len(l)
+			}
+			if s < 0 || s >= len(l) {
+				return nil, fmt.Errorf("Could not select '%s' from the spec: '%s' is out of range, the list has %d items", query, at, len(l))
+			}
+			current = l[s]
+		}
+	}
+	selected, ok := current.(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("Could not select '%s' from the spec: it is %s but the render context must be a map", query, describeSpecValue(current))
+	}
+	return selected, nil
+}
+
+// formatSpecQuery writes path steps back in jq style.
+func formatSpecQuery(steps []interface{}) string {
+	if len(steps) == 0 {
+		return "."
+	}
+	var b strings.Builder
+	for _, step := range steps {
+		switch s := step.(type) {
+		case int:
+			fmt.Fprintf(&b, "[%d]", s)
+		case string:
+			if strings.ContainsAny(s, ".[]\" ") {
+				fmt.Fprintf(&b, ".%q", s)
+			} else {
+				b.WriteString("." + s)
+			}
+		}
+	}
+	return b.String()
+}
+
+func describeSpecValue(value interface{}) string {
+	switch value.(type) {
+	case map[string]interface{}:
+		return "a map"
+	case []interface{}:
+		return "a list"
+	case nil:
+		return "null"
+	}
+	return fmt.Sprintf("a %T", value)
+}
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/AstromechZA/spiro/engine"
+	"github.com/AstromechZA/spiro/schema"
+)
+
+// specSchemaFileName is the JSON Schema at the root of a directory template that specs are validated against before
+// rendering, when the manifest sets spec_schema. Like the manifest it is then never copied to the output.
+const specSchemaFileName = engine.SpecSchemaFileName
+
+// loadSpecSchema loads the spec schema of a directory template, templates without one or whose manifest doesn't set
+// spec_schema get nil.
+func loadSpecSchema(inputTemplate string, manifest *templateManifest) (*schema.Schema, error) {
+	if !manifest.SpecSchema {
+		return nil, nil
+	}
+	path := filepath.Join(inputTemplate, specSchemaFileName)
+	if stat, err := os.Stat(path); err != nil || stat.IsDir() {
+		return nil, nil
+	}
+	s, err := schema.Load(path)
+	if err != nil {
+		return nil, fmt.Errorf("Could not load the spec schema '%s': %s", path, err.Error())
+	}
+	return s, nil
+}
+
+// warnUndeclaredSpecSchema warns about a spec schema in a template whose manifest doesn't set spec_schema, which is
+// copied into the output rather than used to validate the spec.
+func warnUndeclaredSpecSchema(inputTemplate string, manifest *templateManifest) {
+	if manifest.SpecSchema {
+		return
+	}
+	path := filepath.Join(inputTemplate, specSchemaFileName)
+	if stat, err := os.Stat(path); err == nil && !stat.IsDir() {
+		logs.Warnf("'%s' does not validate the spec and is copied like any other file, since %s does not set 'spec_schema: true'", path, manifestFileName)
+	}
+}
+
+// validateSpecs checks the spec of every run against the template's spec schema, reporting every violation with its
+// path in the spec so that a missing or mistyped value is caught before anything is rendered.
+func validateSpecs(s *schema.Schema, runs []matrixRun) error {
+	if s == nil {
+		return nil
+	}
+	var problems []string
+	for _, run := range runs {
+		for _, verr := range s.Validate(run.Spec) {
+			path := verr.Path
+			if path == "" {
+				path = "(root)"
+			}
+			if run.Name != "" {
+				path = run.Name + ": " + path
+			}
+			problems = append(problems, fmt.Sprintf("%s: %s", path, verr.Message))
+		}
+	}
+	if len(problems) > 0 {
+		return fmt.Errorf("The spec does not match the template's %s:\n  %s", specSchemaFileName, strings.Join(problems, "\n  "))
+	}
+	return nil
+}
@@ -0,0 +1,876 @@
+package main
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/base32"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"math"
+	"math/big"
+	"reflect"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// The functions in this file follow the names, argument order and behaviour of the Sprig library used by Helm and
+// many other Go template tools, so that snippets written for those work unchanged. As in Sprig, the value being
+// operated on is the last argument so that the functions work at the end of a pipeline, eg:
+// {{ .name | trimPrefix "x" }}.
+
+// sprigFunctions returns the Sprig compatible template functions.
+func sprigFunctions() map[string]interface{} {
+	return map[string]interface{}{
+		// strings
+		"trim":       strings.TrimSpace,
+		"trimAll":    func(cutset string, s string) string { return strings.Trim(s, cutset) },
+		"trimPrefix": func(prefix string, s string) string { return strings.TrimPrefix(s, prefix) },
+		"trimSuffix": func(suffix string, s string) string { return strings.TrimSuffix(s, suffix) },
+		"trunc":      Trunc,
+		"substr":     Substr,
+		"repeat":     func(count int, s string) string { return strings.Repeat(s, count) },
+		"nospace":    func(s string) string { return strings.Join(strings.Fields(s), "") },
+		"contains":   func(substr string, s string) bool { return strings.Contains(s, substr) },
+		"hasPrefix":  func(prefix string, s string) bool { return strings.HasPrefix(s, prefix) },
+		"hasSuffix":  func(suffix string, s string) bool { return strings.HasSuffix(s, suffix) },
+		"replace":    func(old string, new string, s string) string { return strings.Replace(s, old, new, -1) },
+		"quote":      Quote,
+		"squote":     Squote,
+		"cat":        Cat,
+		"indent":     Indent,
+		"nindent":    func(spaces int, s string) string { return "\n" + Indent(spaces, s) },
+		"plural":     Plural,
+		"untitle":    Untitle,
+		"camelcase":  CamelCase,
+		"snakecase":  SnakeCase,
+		"kebabcase":  KebabCase,
+		"split":      Split,
+		"splitList":  func(sep string, s string) []string { return strings.Split(s, sep) },
+		"join":       Join,
+		"sortAlpha":  SortAlpha,
+		"toString":   ToString,
+		"toStrings":  ToStrings,
+		"atoi":       func(s string) (int, error) { return strconv.Atoi(strings.TrimSpace(s)) },
+		"int":        ToInt,
+		"int64":      ToInt64,
+		"float64":    ToFloat64,
+
+		// regular expressions
+		"regexMatch":   func(pattern string, s string) (bool, error) { return regexp.MatchString(pattern, s) },
+		"regexFind":    RegexFind,
+		"regexFindAll": RegexFindAll,
+		"regexSplit":   RegexSplit,
+
+		// defaults and flow control
+		"default":  Default,
+		"empty":    Empty,
+		"coalesce": Coalesce,
+		"ternary":  Ternary,
+		"required": Required,
+		"fail":     func(msg string) (string, error) { return "", fmt.Errorf("%s", msg) },
+
+		// encoding and hashing
+		"b64enc":    func(s string) string { return base64.StdEncoding.EncodeToString([]byte(s)) },
+		"b64dec":    B64Dec,
+		"b32enc":    func(s string) string { return base32.StdEncoding.EncodeToString([]byte(s)) },
+		"b32dec":    B32Dec,
+		"sha1sum":   Sha1Sum,
+		"sha256sum": Sha256Sum,
+
+		// random values
+		"uuidv4":       UUIDv4,
+		"randAlphaNum": func(n int) (string, error) { return randomString(n, alphaNumChars) },
+		"randAlpha":    func(n int) (string, error) { return randomString(n, alphaChars) },
+		"randNumeric":  func(n int) (string, error) { return randomString(n, numericChars) },
+		"randAscii":    func(n int) (string, error) { return randomString(n, asciiChars) },
+
+		// math, in addition to add
+		"add1":  func(a interface{}) (interface{}, error) { return Add(a, 1) },
+		"sub":   Sub,
+		"mul":   Mul,
+		"div":   Div,
+		"mod":   Mod,
+		"max":   Max,
+		"min":   Min,
+		"floor": Floor,
+		"ceil":  Ceil,
+		"round": Round,
+		"until": Until,
+
+		// dates
+		"date":       Date,
+		"dateInZone": DateInZone,
+		"toDate":     ToDate,
+		"ago":        Ago,
+
+		// dicts
+		"dict":   Dict,
+		"get":    func(d map[string]interface{}, key string) interface{} { return d[key] },
+		"set":    Set,
+		"unset":  Unset,
+		"hasKey": HasKey,
+		"keys":   Keys,
+		"pick":   Pick,
+		"omit":   Omit,
+		"merge":  Merge,
+
+		// lists
+		"list":    func(items ...interface{}) []interface{} { return items },
+		"first":   First,
+		"last":    Last,
+		"rest":    Rest,
+		"initial": Initial,
+		"append":  Append,
+		"prepend": Prepend,
+		"concat":  Concat,
+		"uniq":    Uniq,
+		"has":     Has,
+		"without": Without,
+		"reverse": Reverse,
+		"compact": Compact,
+
+		// types, typeOf is registered with the debugging functions so that it can write to stderr under -trace
+		"kindOf": func(v interface{}) string { return reflect.ValueOf(v).Kind().String() },
+	}
+}
+
+// Trunc truncates a string to at most length characters, a negative length keeps the end of the string instead.
+func Trunc(length int, s string) string {
+	runes := []rune(s)
+	if length < 0 && len(runes)+length > 0 {
+		return string(runes[len(runes)+length:])
+	}
+	if length >= 0 && len(runes) > length {
+		return string(runes[:length])
+	}
+	return s
+}
+
+// Substr returns the characters from start up to (not including) end, a negative end means the end of the string.
+func Substr(start int, end int, s string) string {
+	runes := []rune(s)
+	if start < 0 {
+		start = 0
+	}
+	if end < 0 || end > len(runes) {
+		end = len(runes)
+	}
+	if start > end {
+		return ""
+	}
+	return string(runes[start:end])
+}
+
+// Quote wraps each value in double quotes (escaping them as Go strings) and joins them with spaces.
+func Quote(values ...interface{}) string {
+	out := make([]string, 0, len(values))
+	for _, v := range values {
+		if v != nil {
+			out = append(out, strconv.Quote(ToString(v)))
+		}
+	}
+	return strings.Join(out, " ")
+}
+
+// Squote wraps each value in single quotes and joins them with spaces.
+func Squote(values ...interface{}) string {
+	out := make([]string, 0, len(values))
+	for _, v := range values {
+		if v != nil {
+			out = append(out, "'"+ToString(v)+"'")
+		}
+	}
+	return strings.Join(out, " ")
+}
+
+// Cat joins the values with spaces, skipping nil values.
+func Cat(values ...interface{}) string {
+	out := make([]string, 0, len(values))
+	for _, v := range values {
+		if v != nil {
+			out = append(out, ToString(v))
+		}
+	}
+	return strings.Join(out, " ")
+}
+
+// Indent prefixes every line of the string with the given number of spaces.
+func Indent(spaces int, s string) string {
+	pad := strings.Repeat(" ", spaces)
+	return pad + strings.Replace(s, "\n", "\n"+pad, -1)
+}
+
+// Plural returns one when count is 1 and many otherwise.
+func Plural(one string, many string, count interface{}) (string, error) {
+	n, err := ToInt64(count)
+	if err != nil {
+		return "", err
+	}
+	if n == 1 {
+		return one, nil
+	}
+	return many, nil
+}
+
+// Untitle lower cases the first letter of every word.
+func Untitle(s string) string {
+	var b bytes.Buffer
+	start := true
+	for _, r := range s {
+		if start {
+			r = unicode.ToLower(r)
+		}
+		start = unicode.IsSpace(r)
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+// splitWords splits a string into words at separators and at case changes, keeping acronyms together, eg:
+// "HTTPServer_name" -> ["HTTP", "Server", "name"].
+func splitWords(s string) []string {
+	var words []string
+	for _, field := range strings.FieldsFunc(s, func(r rune) bool { return !unicode.IsLetter(r) && !unicode.IsDigit(r) }) {
+		runes := []rune(field)
+		start := 0
+		for i := 1; i < len(runes); i++ {
+			prev, cur := runes[i-1], runes[i]
+			nextLower := i+1 < len(runes) && unicode.IsLower(runes[i+1])
+			if (unicode.IsLower(prev) || unicode.IsDigit(prev)) && unicode.IsUpper(cur) ||
+				unicode.IsUpper(prev) && unicode.IsUpper(cur) && nextLower {
+				words = append(words, string(runes[start:i]))
+				start = i
+			}
+		}
+		words = append(words, string(runes[start:]))
+	}
+	return words
+}
+
+// CamelCase converts a string to UpperCamelCase, eg: "http_server" -> "HttpServer".
+func CamelCase(s string) string {
+	var b bytes.Buffer
+	for _, word := range splitWords(s) {
+		runes := []rune(strings.ToLower(word))
+		b.WriteString(string(unicode.ToUpper(runes[0])) + string(runes[1:]))
+	}
+	return b.String()
+}
+
+// SnakeCase converts a string to snake_case, eg: "HTTPServer" -> "http_server".
+func SnakeCase(s string) string {
+	return strings.ToLower(strings.Join(splitWords(s), "_"))
+}
+
+// KebabCase converts a string to kebab-case, eg: "HTTPServer" -> "http-server".
+func KebabCase(s string) string {
+	return strings.ToLower(strings.Join(splitWords(s), "-"))
+}
+
+// Split splits a string into a dict with the keys _0, _1 and so on, which makes the parts easy to pick out.
+func Split(sep string, s string) map[string]interface{} {
+	out := make(map[string]interface{})
+	for i, part := range strings.Split(s, sep) {
+		out["_"+strconv.Itoa(i)] = part
+	}
+	return out
+}
+
+// Join joins the items of a list with the separator.
+func Join(sep string, list interface{}) (string, error) {
+	items, err := ToStrings(list)
+	if err != nil {
+		return "", err
+	}
+	return strings.Join(items, sep), nil
+}
+
+// SortAlpha returns the items of a list as strings in lexical order.
+func SortAlpha(list interface{}) ([]string, error) {
+	items, err := ToStrings(list)
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(items)
+	return items, nil
+}
+
+// ToString converts any value to a string.
+func ToString(v interface{}) string {
+	switch s := v.(type) {
+	case string:
+		return s
+	case []byte:
+		return string(s)
+	case fmt.Stringer:
+		return s.String()
+	case nil:
+		return ""
+	}
+	return fmt.Sprint(v)
+}
+
+// ToStrings converts every item of a list to a string.
+func ToStrings(list interface{}) ([]string, error) {
+	items, err := toList(list)
+	if err != nil {
+		return nil, err
+	}
+	out := make([]string, len(items))
+	for i, item := range items {
+		out[i] = ToString(item)
+	}
+	return out, nil
+}
+
+// ToInt64 converts a number, or a string containing one, to an int64. Fractions are truncated.
+func ToInt64(v interface{}) (int64, error) {
+	if s, ok := v.(string); ok {
+		f, err := strconv.ParseFloat(strings.TrimSpace(s), 64)
+		if err != nil {
+			return 0, fmt.Errorf("expected a number but got %q", s)
+		}
+		return int64(f), nil
+	}
+	i, f, isFloat, err := toNumber(v)
+	if isFloat {
+		return int64(f), err
+	}
+	return i, err
+}
+
+// ToInt converts a number, or a string containing one, to an int. Fractions are truncated.
+func ToInt(v interface{}) (int, error) {
+	i, err := ToInt64(v)
+	return int(i), err
+}
+
+// ToFloat64 converts a number, or a string containing one, to a float64.
+func ToFloat64(v interface{}) (float64, error) {
+	if s, ok := v.(string); ok {
+		f, err := strconv.ParseFloat(strings.TrimSpace(s), 64)
+		if err != nil {
+			return 0, fmt.Errorf("expected a number but got %q", s)
+		}
+		return f, nil
+	}
+	i, f, isFloat, err := toNumber(v)
+	if isFloat {
+		return f, err
+	}
+	return float64(i), err
+}
+
+// RegexFind returns the first match of the pattern in the string, or an empty string.
+func RegexFind(pattern string, s string) (string, error) {
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return "", err
+	}
+	return re.FindString(s), nil
+}
+
+// RegexFindAll returns up to n matches of the pattern in the string, all of them when n is negative.
+func RegexFindAll(pattern string, s string, n int) ([]string, error) {
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return nil, err
+	}
+	return re.FindAllString(s, n), nil
+}
+
+// RegexSplit splits the string into at most n parts around matches of the pattern, all of them when n is negative.
+func RegexSplit(pattern string, s string, n int) ([]string, error) {
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return nil, err
+	}
+	return re.Split(s, n), nil
+}
+
+// Empty reports whether a value is the zero value of its type, an empty string, list or map, or nil.
+func Empty(v interface{}) bool {
+	rv := reflect.ValueOf(v)
+	if !rv.IsValid() {
+		return true
+	}
+	switch rv.Kind() {
+	case reflect.Array, reflect.Map, reflect.Slice, reflect.String:
+		return rv.Len() == 0
+	case reflect.Ptr, reflect.Interface:
+		return rv.IsNil()
+	case reflect.Bool:
+		return !rv.Bool()
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return rv.Int() == 0
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return rv.Uint() == 0
+	case reflect.Float32, reflect.Float64:
+		return rv.Float() == 0
+	case reflect.Struct:
+		return reflect.DeepEqual(v, reflect.Zero(rv.Type()).Interface())
+	}
+	return false
+}
+
+// Default returns the given value, or the default when the value is missing or empty, eg: {{ .port | default 8080 }}.
+func Default(def interface{}, given ...interface{}) interface{} {
+	if len(given) == 0 || Empty(given[0]) {
+		return def
+	}
+	return given[0]
+}
+
+// Coalesce returns the first value that is not empty, or nil.
+func Coalesce(values ...interface{}) interface{} {
+	for _, v := range values {
+		if !Empty(v) {
+			return v
+		}
+	}
+	return nil
+}
+
+// Ternary returns ifTrue when the condition holds and ifFalse otherwise, eg: {{ .debug | ternary "debug" "info" }}.
+func Ternary(ifTrue interface{}, ifFalse interface{}, condition bool) interface{} {
+	if condition {
+		return ifTrue
+	}
+	return ifFalse
+}
+
+// Required fails with the message when the value is empty and returns it otherwise.
+func Required(msg string, v interface{}) (interface{}, error) {
+	if Empty(v) {
+		return nil, fmt.Errorf("%s", msg)
+	}
+	return v, nil
+}
+
+// B64Dec decodes a standard base64 string.
+func B64Dec(s string) (string, error) {
+	out, err := base64.StdEncoding.DecodeString(s)
+	return string(out), err
+}
+
+// B32Dec decodes a standard base32 string.
+func B32Dec(s string) (string, error) {
+	out, err := base32.StdEncoding.DecodeString(s)
+	return string(out), err
+}
+
+// Sha1Sum returns the hex encoded SHA-1 digest of a string.
+func Sha1Sum(s string) string {
+	sum := sha1.Sum([]byte(s))
+	return hex.EncodeToString(sum[:])
+}
+
+// Sha256Sum returns the hex encoded SHA-256 digest of a string.
+func Sha256Sum(s string) string {
+	sum := sha256.Sum256([]byte(s))
+	return hex.EncodeToString(sum[:])
+}
+
+// UUIDv4 returns a new random (version 4) UUID.
+func UUIDv4() (string, error) {
+	var u [16]byte
+	if _, err := rand.Read(u[:]); err != nil {
+		return "", err
+	}
+	u[6] = u[6]&0x0f | 0x40
+	u[8] = u[8]&0x3f | 0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x", u[0:4], u[4:6], u[6:8], u[8:10], u[10:]), nil
+}
+
+const (
+	alphaChars    = "ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz"
+	numericChars  = "0123456789"
+	alphaNumChars = alphaChars + numericChars
+	asciiChars    = alphaNumChars + "!\"#$%&'()*+,-./:;<=>?@[\\]^_`{|}~ "
+)
+
+// randomString returns n characters picked uniformly at random from chars using a cryptographic random source.
+func randomString(n int, chars string) (string, error) {
+	if n < 0 {
+		return "", fmt.Errorf("the length cannot be negative")
+	}
+	out := make([]byte, n)
+	max := big.NewInt(int64(len(chars)))
+	for i := range out {
+		index, err := rand.Int(rand.Reader, max)
+		if err != nil {
+			return "", err
+		}
+		out[i] = chars[index.Int64()]
+	}
+	return string(out), nil
+}
+
+// Sub returns a - b.
+func Sub(a interface{}, b interface{}) (interface{}, error) {
+	return arithmetic(a, b, func(x, y int64) (int64, error) { return x - y, nil }, func(x, y float64) float64 { return x - y })
+}
+
+// Mul returns a * b.
+func Mul(a interface{}, b interface{}) (interface{}, error) {
+	return arithmetic(a, b, func(x, y int64) (int64, error) { return x * y, nil }, func(x, y float64) float64 { return x * y })
+}
+
+// Div returns a / b, which is an integer division when both numbers are integers.
+func Div(a interface{}, b interface{}) (interface{}, error) {
+	return arithmetic(a, b, func(x, y int64) (int64, error) {
+		if y == 0 {
+			return 0, fmt.Errorf("division by zero")
+		}
+		return x / y, nil
+	}, func(x, y float64) float64 { return x / y })
+}
+
+// Mod returns the remainder of a / b.
+func Mod(a interface{}, b interface{}) (interface{}, error) {
+	return arithmetic(a, b, func(x, y int64) (int64, error) {
+		if y == 0 {
+			return 0, fmt.Errorf("division by zero")
+		}
+		return x % y, nil
+	}, math.Mod)
+}
+
+// Max returns the largest of the numbers.
+func Max(first interface{}, rest ...interface{}) (interface{}, error) {
+	return extreme(first, rest, 1)
+}
+
+// Min returns the smallest of the numbers.
+func Min(first interface{}, rest ...interface{}) (interface{}, error) {
+	return extreme(first, rest, -1)
+}
+
+func extreme(best interface{}, rest []interface{}, sign float64) (interface{}, error) {
+	bestValue, err := ToFloat64(best)
+	if err != nil {
+		return nil, err
+	}
+	for _, v := range rest {
+		f, err := ToFloat64(v)
+		if err != nil {
+			return nil, err
+		}
+		if (f-bestValue)*sign > 0 {
+			best, bestValue = v, f
+		}
+	}
+	return best, nil
+}
+
+// Floor returns the greatest integer value less than or equal to a number.
+func Floor(a interface{}) (float64, error) {
+	f, err := ToFloat64(a)
+	return math.Floor(f), err
+}
+
+// Ceil returns the least integer value greater than or equal to a number.
+func Ceil(a interface{}) (float64, error) {
+	f, err := ToFloat64(a)
+	return math.Ceil(f), err
+}
+
+// Round rounds a number to the given number of decimal places.
+func Round(a interface{}, places int) (float64, error) {
+	f, err := ToFloat64(a)
+	if err != nil {
+		return 0, err
+	}
+	scale := math.Pow(10, float64(places))
+	if f < 0 {
+		return math.Ceil(f*scale-0.5) / scale, nil
+	}
+	return math.Floor(f*scale+0.5) / scale, nil
+}
+
+// Until returns the list of integers from 0 up to (not including) n.
+func Until(n int) []int {
+	out := make([]int, 0)
+	for i := 0; i < n; i++ {
+		out = append(out, i)
+	}
+	return out
+}
+
+// Date formats a time with a Go layout, eg: {{ now | date "2006-01-02" }}.
+func Date(layout string, t interface{}) (string, error) {
+	return DateInZone(layout, t, "Local")
+}
+
+// DateInZone formats a time with a Go layout in the named time zone, eg: "UTC" or "Europe/London".
+func DateInZone(layout string, t interface{}, zone string) (string, error) {
+	tt, err := toTime(t)
+	if err != nil {
+		return "", err
+	}
+	loc, err := time.LoadLocation(zone)
+	if err != nil {
+		return "", err
+	}
+	return tt.In(loc).Format(layout), nil
+}
+
+// ToDate parses a time in the local time zone with a Go layout, eg: {{ toDate "2006-01-02" .released }}.
+func ToDate(layout string, value string) (time.Time, error) {
+	return time.ParseInLocation(layout, value, time.Local)
+}
+
+// Ago returns how long ago a time was, rounded to the second.
+func Ago(t interface{}) (string, error) {
+	tt, err := toTime(t)
+	if err != nil {
+		return "", err
+	}
+	return time.Since(tt).Round(time.Second).String(), nil
+}
+
+// Dict builds a dict from alternating keys and values, eg: {{ dict "name" .name "port" 80 }}.
+func Dict(pairs ...interface{}) (map[string]interface{}, error) {
+	if len(pairs)%2 != 0 {
+		return nil, fmt.Errorf("expected alternating keys and values but got %d arguments", len(pairs))
+	}
+	out := make(map[string]interface{}, len(pairs)/2)
+	for i := 0; i < len(pairs); i += 2 {
+		out[ToString(pairs[i])] = pairs[i+1]
+	}
+	return out, nil
+}
+
+// Set sets a key of the dict and returns the dict.
+func Set(d map[string]interface{}, key string, value interface{}) map[string]interface{} {
+	d[key] = value
+	return d
+}
+
+// Unset removes a key from the dict and returns the dict.
+func Unset(d map[string]interface{}, key string) map[string]interface{} {
+	delete(d, key)
+	return d
+}
+
+// HasKey reports whether the dict contains the key.
+func HasKey(d map[string]interface{}, key string) bool {
+	_, ok := d[key]
+	return ok
+}
+
+// Keys returns the keys of one or more dicts in lexical order.
+func Keys(dicts ...map[string]interface{}) []string {
+	var out []string
+	for _, d := range dicts {
+		for k := range d {
+			out = append(out, k)
+		}
+	}
+	sort.Strings(out)
+	return out
+}
+
+// Pick returns a new dict with only the given keys.
+func Pick(d map[string]interface{}, keys ...string) map[string]interface{} {
+	out := make(map[string]interface{})
+	for _, k := range keys {
+		if v, ok := d[k]; ok {
+			out[k] = v
+		}
+	}
+	return out
+}
+
+// Omit returns a new dict without the given keys.
+func Omit(d map[string]interface{}, keys ...string) map[string]interface{} {
+	omit := make(map[string]bool, len(keys))
+	for _, k := range keys {
+		omit[k] = true
+	}
+	out := make(map[string]interface{})
+	for k, v := range d {
+		if !omit[k] {
+			out[k] = v
+		}
+	}
+	return out
+}
+
+// Merge deep merges the dicts into a new dict, values in earlier dicts take precedence like in Sprig.
+func Merge(dst map[string]interface{}, srcs ...map[string]interface{}) map[string]interface{} {
+	out := make(map[string]interface{})
+	for i := len(srcs) - 1; i >= 0; i-- {
+		out = mergeSpecs(out, srcs[i])
+	}
+	return mergeSpecs(out, dst)
+}
+
+// toList converts any slice or array into a []interface{}.
+func toList(list interface{}) ([]interface{}, error) {
+	if items, ok := list.([]interface{}); ok {
+		return items, nil
+	}
+	rv := reflect.ValueOf(list)
+	if !rv.IsValid() {
+		return nil, nil
+	}
+	if rv.Kind() != reflect.Slice && rv.Kind() != reflect.Array {
+		return nil, fmt.Errorf("expected a list but got %v (%T)", list, list)
+	}
+	out := make([]interface{}, rv.Len())
+	for i := range out {
+		out[i] = rv.Index(i).Interface()
+	}
+	return out, nil
+}
+
+// First returns the first item of a list, or nil when it is empty.
+func First(list interface{}) (interface{}, error) {
+	items, err := toList(list)
+	if err != nil || len(items) == 0 {
+		return nil, err
+	}
+	return items[0], nil
+}
+
+// Last returns the last item of a list, or nil when it is empty.
+func Last(list interface{}) (interface{}, error) {
+	items, err := toList(list)
+	if err != nil || len(items) == 0 {
+		return nil, err
+	}
+	return items[len(items)-1], nil
+}
+
+// Rest returns every item of a list except the first.
+func Rest(list interface{}) ([]interface{}, error) {
+	items, err := toList(list)
+	if err != nil || len(items) == 0 {
+		return []interface{}{}, err
+	}
+	return items[1:], nil
+}
+
+// Initial returns every item of a list except the last.
+func Initial(list interface{}) ([]interface{}, error) {
+	items, err := toList(list)
+	if err != nil || len(items) == 0 {
+		return []interface{}{}, err
+	}
+	return items[:len(items)-1], nil
+}
+
+// Append returns a new list with the value added to the end.
+func Append(list interface{}, v interface{}) ([]interface{}, error) {
+	items, err := toList(list)
+	if err != nil {
+		return nil, err
+	}
+	return append(append([]interface{}{}, items...), v), nil
+}
+
+// Prepend returns a new list with the value added to the start.
+func Prepend(list interface{}, v interface{}) ([]interface{}, error) {
+	items, err := toList(list)
+	if err != nil {
+		return nil, err
+	}
+	return append([]interface{}{v}, items...), nil
+}
+
+// Concat joins lists together.
+func Concat(lists ...interface{}) ([]interface{}, error) {
+	out := make([]interface{}, 0)
+	for _, list := range lists {
+		items, err := toList(list)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, items...)
+	}
+	return out, nil
+}
+
+// Uniq returns the items of a list without duplicates, keeping the first occurrence.
+func Uniq(list interface{}) ([]interface{}, error) {
+	items, err := toList(list)
+	if err != nil {
+		return nil, err
+	}
+	out := make([]interface{}, 0, len(items))
+	for _, item := range items {
+		if !containsValue(out, item) {
+			out = append(out, item)
+		}
+	}
+	return out, nil
+}
+
+// Has reports whether the list contains the value, eg: {{ if has "web" .roles }}.
+func Has(needle interface{}, list interface{}) (bool, error) {
+	items, err := toList(list)
+	if err != nil {
+		return false, err
+	}
+	return containsValue(items, needle), nil
+}
+
+// Without returns the items of a list except the given values.
+func Without(list interface{}, omit ...interface{}) ([]interface{}, error) {
+	items, err := toList(list)
+	if err != nil {
+		return nil, err
+	}
+	out := make([]interface{}, 0, len(items))
+	for _, item := range items {
+		if !containsValue(omit, item) {
+			out = append(out, item)
+		}
+	}
+	return out, nil
+}
+
+// Reverse returns the items of a list in reverse order.
+func Reverse(list interface{}) ([]interface{}, error) {
+	items, err := toList(list)
+	if err != nil {
+		return nil, err
+	}
+	out := make([]interface{}, len(items))
+	for i, item := range items {
+		out[len(items)-1-i] = item
+	}
+	return out, nil
+}
+
+// Compact returns the items of a list that are not empty.
+func Compact(list interface{}) ([]interface{}, error) {
+	items, err := toList(list)
+	if err != nil {
+		return nil, err
+	}
+	out := make([]interface{}, 0, len(items))
+	for _, item := range items {
+		if !Empty(item) {
+			out = append(out, item)
+		}
+	}
+	return out, nil
+}
+
+func containsValue(items []interface{}, v interface{}) bool {
+	for _, item := range items {
+		if reflect.DeepEqual(item, v) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,33 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+)
+
+// stdoutRoot is the output directory that the template is rendered into with -stdout-all. The rendered tree is
+// collected in memory and nothing is ever written there.
+const stdoutRoot = "/spiro-stdout"
+
+// writeStdoutAll prints every file collected in the sink under root, in path order, each after a '--- name ---' line
+// with its path relative to root. A newline is added to files that don't end with one so that every separator starts
+// a line.
+func writeStdoutAll(w io.Writer, root string, sink *memorySink) error {
+	for _, entry := range archiveEntries(root, sink) {
+		if entry.dir {
+			continue
+		}
+		if _, err := fmt.Fprintf(w, "--- %s ---\n", entry.name); err != nil {
+			return err
+		}
+		content := entry.content
+		if len(content) > 0 && !bytes.HasSuffix(content, []byte("\n")) {
+			content = append(content[:len(content):len(content)], '\n')
+		}
+		if _, err := w.Write(content); err != nil {
+			return err
+		}
+	}
+	return nil
+}
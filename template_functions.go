@@ -2,36 +2,32 @@ package main
 
 import (
 	"encoding/json"
+	"fmt"
 	"html/template"
-	"reflect"
+	"os"
 	"regexp"
 	"strings"
+	"time"
+
+	"github.com/AstromechZA/spiro/templatefactory"
 )
 
-func Jsonify(in map[interface{}]interface{}) string {
-	working := make(map[string]interface{})
-	s := reflect.ValueOf(in)
-	for _, k := range s.MapKeys() {
-		working[k.Interface().(string)] = s.MapIndex(k).Interface()
-	}
-	sb, err := json.Marshal(working)
+// Jsonify serializes any value (maps, lists, scalars or nested structures) as JSON.
+func Jsonify(in interface{}) (string, error) {
+	sb, err := json.Marshal(normalizeSpecValue(in))
 	if err != nil {
-		panic(err)
+		return "", err
 	}
-	return string(sb)
+	return string(sb), nil
 }
 
-func JsonifyIndent(in map[interface{}]interface{}) string {
-	working := make(map[string]interface{})
-	s := reflect.ValueOf(in)
-	for _, k := range s.MapKeys() {
-		working[k.Interface().(string)] = s.MapIndex(k).Interface()
-	}
-	sb, err := json.MarshalIndent(working, "", "    ")
+// JsonifyIndent is Jsonify with indentation.
+func JsonifyIndent(in interface{}) (string, error) {
+	sb, err := json.MarshalIndent(normalizeSpecValue(in), "", "    ")
 	if err != nil {
-		panic(err)
+		return "", err
 	}
-	return string(sb)
+	return string(sb), nil
 }
 
 func Unescape(in string) interface{} {
@@ -42,7 +38,170 @@ func StringReplace(subj string, old string, new string) string {
 	return strings.Replace(subj, old, new, -1)
 }
 
-func RegexReplace(subj string, pattern string, repl string) string {
-	re := regexp.MustCompile(pattern)
-	return re.ReplaceAllString(subj, repl)
+// RegexReplace replaces every match of the pattern, an invalid pattern is reported as a template error.
+func RegexReplace(subj string, pattern string, repl string) (string, error) {
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return "", err
+	}
+	return re.ReplaceAllString(subj, repl), nil
+}
+
+// toNumber converts the numeric types found in specs and template literals to an int64 or float64.
+func toNumber(in interface{}) (int64, float64, bool, error) {
+	switch v := in.(type) {
+	case int:
+		return int64(v), 0, false, nil
+	case int8:
+		return int64(v), 0, false, nil
+	case int16:
+		return int64(v), 0, false, nil
+	case int32:
+		return int64(v), 0, false, nil
+	case int64:
+		return v, 0, false, nil
+	case uint:
+		return int64(v), 0, false, nil
+	case uint8:
+		return int64(v), 0, false, nil
+	case uint16:
+		return int64(v), 0, false, nil
+	case uint32:
+		return int64(v), 0, false, nil
+	case uint64:
+		return int64(v), 0, false, nil
+	case float32:
+		return 0, float64(v), true, nil
+	case float64:
+		return 0, v, true, nil
+	}
+	return 0, 0, false, fmt.Errorf("expected a number but got %v (%T)", in, in)
+}
+
+// Add returns the sum of two numbers. The result is an integer unless either number has a fractional type.
+func Add(a interface{}, b interface{}) (interface{}, error) {
+	return arithmetic(a, b, func(x, y int64) (int64, error) { return x + y, nil }, func(x, y float64) float64 { return x + y })
+}
+
+// arithmetic applies an integer operation to two integers, or the float operation when either number has a fractional
+// type.
+func arithmetic(a interface{}, b interface{}, intOp func(x, y int64) (int64, error), floatOp func(x, y float64) float64) (interface{}, error) {
+	ai, af, aFloat, err := toNumber(a)
+	if err != nil {
+		return nil, err
+	}
+	bi, bf, bFloat, err := toNumber(b)
+	if err != nil {
+		return nil, err
+	}
+	if !aFloat && !bFloat {
+		v, err := intOp(ai, bi)
+		if err != nil {
+			return nil, err
+		}
+		return v, nil
+	}
+	if !aFloat {
+		af = float64(ai)
+	}
+	if !bFloat {
+		bf = float64(bi)
+	}
+	return floatOp(af, bf), nil
+}
+
+// templateFunctionContext holds the state of the current run that some template functions need.
+type templateFunctionContext struct {
+	allowNetwork bool
+	rawSpec      string
+	specFile     string
+	revision     func() templateRevision
+	prompts      *prompter
+	outputs      *renderedOutputs
+	snippets     *snippetLibrary
+	trace        bool
+}
+
+// registerTemplateFunctions registers every template function spiro provides. The Sprig compatible functions are
+// available in the 'sprig' namespace and, so that snippets written for Sprig work unchanged, at the top level too.
+func registerTemplateFunctions(tf *templatefactory.TemplateFactory, ctx templateFunctionContext) error {
+	if err := tf.RegisterTemplateFunctions(templateFunctions(ctx)); err != nil {
+		return err
+	}
+	if err := tf.RegisterNamespace("sprig", sprigFunctions()); err != nil {
+		return err
+	}
+	return tf.RegisterTemplateFunctions(sprigFunctions())
+}
+
+// templateFunctions returns every template function spiro provides.
+func templateFunctions(ctx templateFunctionContext) map[string]interface{} {
+	debug := debugFunctions{}
+	if ctx.trace {
+		debug.trace = os.Stderr
+	}
+	return map[string]interface{}{
+		"title":                    strings.Title,
+		"lower":                    strings.ToLower,
+		"upper":                    strings.ToUpper,
+		"now":                      time.Now,
+		"json":                     Jsonify,
+		"jsonindent":               JsonifyIndent,
+		"unescape":                 Unescape,
+		"stringreplace":            StringReplace,
+		"regexreplace":             RegexReplace,
+		"add":                      Add,
+		"formatNumber":             FormatNumber,
+		"humanBytes":               HumanBytes,
+		"thousands":                Thousands,
+		"ordinal":                  Ordinal,
+		"cidrhost":                 CidrHost,
+		"cidrsubnet":               CidrSubnet,
+		"ipAdd":                    IPAdd,
+		"genPrivateKey":            GenPrivateKey,
+		"genSelfSignedCert":        GenSelfSignedCert,
+		"genSelfSignedCertWithKey": GenSelfSignedCertWithKey,
+		"genCSR":                   GenCSR,
+		"bcrypt":                   Bcrypt,
+		"sha512crypt":              SHA512Crypt,
+		"apr1":                     APR1,
+		"htpasswd":                 Htpasswd,
+		"cronValid":                CronValid,
+		"cronNormalize":            CronNormalize,
+		"cronToSystemd":            CronToSystemd,
+		"systemdToCron":            SystemdToCron,
+		"toYaml":                   ToYaml,
+		"goModulePath":             GoModulePath,
+		"goIdent":                  GoIdent,
+		"ident":                    Ident,
+		"typeIdent":                TypeIdent,
+		"goLatestVersion":          GoLatestVersion(ctx.allowNetwork),
+		"licenseText":              LicenseText,
+		"gitignore":                Gitignore,
+		"rfc3339":                  RFC3339,
+		"unixTime":                 UnixTime,
+		"fromUnix":                 FromUnix,
+		"parseTime":                ParseTime,
+		"parseDuration":            ParseDuration,
+		"addDuration":              AddDuration,
+		"addDays":                  AddDays,
+		"addMonths":                AddMonths,
+		"addYears":                 AddYears,
+		"startOfDay":               StartOfDay,
+		"startOfMonth":             StartOfMonth,
+		"endOfMonth":               EndOfMonth,
+		"startOfYear":              StartOfYear,
+		"specRaw":                  func() string { return ctx.rawSpec },
+		"specPath":                 func() string { return ctx.specFile },
+		"env":                      os.Getenv,
+		"trimTrailingSpace":        TrimTrailingSpace,
+		"collapseBlankLines":       CollapseBlankLines,
+		"ensureTrailingNewline":    EnsureTrailingNewline,
+		"templateRevision":         ctx.revision,
+		"ask":                      ctx.prompts.Ask,
+		"output":                   ctx.outputs.Output,
+		"snippet":                  ctx.snippets.Snippet,
+		"debugDump":                debug.DebugDump,
+		"typeOf":                   debug.TypeOf,
+	}
 }
@@ -0,0 +1,90 @@
+package templatefactory
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+)
+
+// SpecParseError is returned when a spec cannot be decoded or contains invalid spiro settings.
+type SpecParseError struct {
+	Err error
+}
+
+func (e *SpecParseError) Error() string {
+	return "Could not parse spec file: " + e.Err.Error()
+}
+
+func (e *SpecParseError) Unwrap() error {
+	return e.Err
+}
+
+// TemplateParseError is returned when a template is not syntactically valid. Line is 0 when it is not known.
+type TemplateParseError struct {
+	File string
+	Line int
+	Err  error
+}
+
+func (e *TemplateParseError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *TemplateParseError) Unwrap() error {
+	return e.Err
+}
+
+// RenderError is returned when a template parses but fails while executing, for example due to a missing spec key or
+// a failing function. Line is 0 when it is not known. Column is the 0 based byte offset of the failing action in its
+// line, when the line is known.
+type RenderError struct {
+	File   string
+	Line   int
+	Column int
+	Err    error
+}
+
+func (e *RenderError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *RenderError) Unwrap() error {
+	return e.Err
+}
+
+// ConflictError is returned when registering a template function whose name is already taken.
+type ConflictError struct {
+	Name string
+	// With describes what the name conflicts with: "function", "builtin" or "namespace".
+	With string
+}
+
+func (e *ConflictError) Error() string {
+	switch e.With {
+	case "builtin":
+		return fmt.Sprintf("Template function '%s' would shadow the builtin function of the same name", e.Name)
+	case "namespace":
+		return fmt.Sprintf("Template function '%s' conflicts with the function namespace of the same name", e.Name)
+	}
+	return fmt.Sprintf("Template function '%s' is already registered", e.Name)
+}
+
+// errorLine extracts the line number from the 'template: name:line:...' prefix of template errors.
+func errorLine(name string, err error) int {
+	m := regexp.MustCompile(`^template: ` + regexp.QuoteMeta(name) + `:(\d+)`).FindStringSubmatch(err.Error())
+	if m == nil {
+		return 0
+	}
+	line, _ := strconv.Atoi(m[1])
+	return line
+}
+
+// errorColumn extracts the column from the 'template: name:line:column: ...' prefix of template execution errors.
+func errorColumn(name string, err error) int {
+	m := regexp.MustCompile(`^template: ` + regexp.QuoteMeta(name) + `:\d+:(\d+):`).FindStringSubmatch(err.Error())
+	if m == nil {
+		return 0
+	}
+	column, _ := strconv.Atoi(m[1])
+	return column
+}
@@ -0,0 +1,136 @@
+package templatefactory
+
+import (
+	"sort"
+	"strings"
+	"text/template"
+	"text/template/parse"
+)
+
+// SpecReference is a spec value read by a template: its dotted path and the 1 based line of the template reading it.
+type SpecReference struct {
+	Path string
+	Line int
+}
+
+// SpecReferences parses a template from the named file and returns the spec values it reads, such as 'database.host'
+// for '{{ .database.host }}', '{{ $.database.host }}' or '{{ index . "database" "host" }}', sorted by path and line.
+// Inside 'range' and 'with' the dot is no longer the spec, so only '$' references are found there. Errors are returned
+// as a *TemplateParseError.
+func (f *TemplateFactory) SpecReferences(name string, templateString string) ([]SpecReference, error) {
+	t := template.New(name).Funcs(f.funcMap).Delims(f.startDelim, f.endDelim)
+	if _, err := t.Parse(templateString); err != nil {
+		return nil, &TemplateParseError{File: name, Line: errorLine(name, err), Err: err}
+	}
+	found := make(map[SpecReference]bool)
+	if t.Tree != nil {
+		collectReferences(t.Tree.Root, true, func(path string, pos parse.Pos) {
+			found[SpecReference{Path: path, Line: 1 + strings.Count(templateString[:pos], "\n")}] = true
+		})
+	}
+	references := make([]SpecReference, 0, len(found))
+	for reference := range found {
+		references = append(references, reference)
+	}
+	sort.Slice(references, func(i, j int) bool {
+		if references[i].Path != references[j].Path {
+			return references[i].Path < references[j].Path
+		}
+		return references[i].Line < references[j].Line
+	})
+	return references, nil
+}
+
+// collectReferences calls found with the spec paths read by node, atRoot is whether the dot is still the spec.
+func collectReferences(node parse.Node, atRoot bool, found func(path string, pos parse.Pos)) {
+	switch n := node.(type) {
+	case *parse.ListNode:
+		if n != nil {
+			for _, child := range n.Nodes {
+				collectReferences(child, atRoot, found)
+			}
+		}
+	case *parse.ActionNode:
+		collectReferences(n.Pipe, atRoot, found)
+	case *parse.IfNode:
+		collectReferences(n.Pipe, atRoot, found)
+		collectReferences(n.List, atRoot, found)
+		collectReferences(n.ElseList, atRoot, found)
+	case *parse.RangeNode:
+		collectReferences(n.Pipe, atRoot, found)
+		collectReferences(n.List, false, found)
+		collectReferences(n.ElseList, atRoot, found)
+	case *parse.WithNode:
+		collectReferences(n.Pipe, atRoot, found)
+		collectReferences(n.List, false, found)
+		collectReferences(n.ElseList, atRoot, found)
+	case *parse.TemplateNode:
+		collectReferences(n.Pipe, atRoot, found)
+	case *parse.PipeNode:
+		if n != nil {
+			for _, cmd := range n.Cmds {
+				collectReferences(cmd, atRoot, found)
+			}
+		}
+	case *parse.CommandNode:
+		args := n.Args
+		if path, ok := indexReference(n, atRoot); ok {
+			found(path, n.Position())
+			// the keys can be references too, eg: 'index . .kind'
+			args = args[2:]
+		}
+		for _, arg := range args {
+			collectReferences(arg, atRoot, found)
+		}
+	case *parse.ChainNode:
+		collectReferences(n.Node, atRoot, found)
+	case *parse.FieldNode:
+		if atRoot {
+			found(strings.Join(n.Ident, "."), n.Position())
+		}
+	case *parse.VariableNode:
+		if n.Ident[0] == "$" && len(n.Ident) > 1 {
+			found(strings.Join(n.Ident[1:], "."), n.Position())
+		}
+	}
+}
+
+// indexReference returns the spec path read by a call like 'index . "database" "host"' or 'index $ "database"'.
+func indexReference(cmd *parse.CommandNode, atRoot bool) (string, bool) {
+	if len(cmd.Args) < 3 {
+		return "", false
+	}
+	if ident, ok := cmd.Args[0].(*parse.IdentifierNode); !ok || ident.Ident != "index" {
+		return "", false
+	}
+	var keys []string
+	switch n := cmd.Args[1].(type) {
+	case *parse.DotNode:
+		if !atRoot {
+			return "", false
+		}
+	case *parse.FieldNode:
+		if !atRoot {
+			return "", false
+		}
+		keys = append(keys, n.Ident...)
+	case *parse.VariableNode:
+		if n.Ident[0] != "$" {
+			return "", false
+		}
+		keys = append(keys, n.Ident[1:]...)
+	default:
+		return "", false
+	}
+	for _, arg := range cmd.Args[2:] {
+		key, ok := arg.(*parse.StringNode)
+		if !ok {
+			break
+		}
+		keys = append(keys, key.Text)
+	}
+	if len(keys) == 0 {
+		return "", false
+	}
+	return strings.Join(keys, "."), true
+}
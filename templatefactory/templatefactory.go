@@ -3,23 +3,41 @@ package templatefactory
 import (
 	"bytes"
 	"fmt"
-	"html/template"
+	htmltemplate "html/template"
+	"io"
 	"reflect"
+	"regexp"
+	"sort"
+	"strconv"
 	"strings"
+	"text/template"
+	"text/template/parse"
 )
 
 const SpecialDelimitersKey = "_spiro_delimiters_"
 
+// BuiltinFunctions are the functions provided by the template package itself.
+var BuiltinFunctions = []string{
+	"and", "call", "eq", "ge", "gt", "html", "index", "js", "le", "len", "lt", "ne", "not", "or", "print", "printf",
+	"println", "urlquery",
+}
+
 type TemplateFactory struct {
 	funcMap    template.FuncMap
+	namespaces map[string]bool
 	startDelim string
 	endDelim   string
-	spec       *map[string]interface{}
+	// lockedDelims makes SetSpec ignore the delimiters set by the spec
+	lockedDelims bool
+	spec         *map[string]interface{}
+	escapeHTML   bool
+	strict       bool
 }
 
 func NewTemplateFactory() *TemplateFactory {
 	return &TemplateFactory{
 		funcMap:    make(template.FuncMap),
+		namespaces: make(map[string]bool),
 		startDelim: "{{",
 		endDelim:   "}}",
 	}
@@ -27,7 +45,7 @@ func NewTemplateFactory() *TemplateFactory {
 
 func (f *TemplateFactory) SetSpec(in *map[string]interface{}) error {
 	f.spec = in
-	if delims, ok := (*in)[SpecialDelimitersKey]; ok {
+	if delims, ok := (*in)[SpecialDelimitersKey]; ok && !f.lockedDelims {
 		s := reflect.ValueOf(delims)
 		if s.Kind() == reflect.Slice && s.Len() == 2 {
 			var sok, eok bool
@@ -37,26 +55,389 @@ func (f *TemplateFactory) SetSpec(in *map[string]interface{}) error {
 				return nil
 			}
 		}
-		return fmt.Errorf("Overidding template delimiters with '%s' requires an array of two strings", SpecialDelimitersKey)
+		return &SpecParseError{Err: fmt.Errorf("Overidding template delimiters with '%s' requires an array of two strings", SpecialDelimitersKey)}
+	}
+	return nil
+}
+
+// SetDelimiters changes the characters that start and end template actions. A spec setting _spiro_delimiters_ still
+// overrides them, unless they are locked.
+func (f *TemplateFactory) SetDelimiters(start string, end string, locked bool) error {
+	if start == "" || end == "" {
+		return fmt.Errorf("Template delimiters cannot be empty")
 	}
+	f.startDelim, f.endDelim, f.lockedDelims = start, end, locked
 	return nil
 }
 
+// SetHTMLEscaping switches rendering to html/template, which escapes values for use in HTML documents. By default
+// templates are rendered as plain text.
+func (f *TemplateFactory) SetHTMLEscaping(enabled bool) {
+	f.escapeHTML = enabled
+}
+
+// SetStrict makes rendering fail when a null value (or a missing value looked up with index) would be inserted into
+// the output, where text/template writes '<no value>' and html/template an empty string. Missing map keys are always
+// an error.
+func (f *TemplateFactory) SetStrict(enabled bool) {
+	f.strict = enabled
+}
+
+// Spec returns the spec that templates are currently rendered with.
+func (f *TemplateFactory) Spec() *map[string]interface{} {
+	return f.spec
+}
+
+// Delimiters returns the characters that start and end template actions, '{{' and '}}' unless they were changed.
+func (f *TemplateFactory) Delimiters() (string, string) {
+	return f.startDelim, f.endDelim
+}
+
 func (f *TemplateFactory) StringContainsTemplating(in string) bool {
 	return strings.Contains(in, f.startDelim) && strings.Contains(in, f.endDelim)
 }
 
-func (f *TemplateFactory) RegisterTemplateFunction(name string, function interface{}) {
+// RegisterTemplateFunction adds a function to the templates. It is an error to register a name that is already used by
+// another function, a builtin or a namespace, so that function sets cannot silently shadow each other.
+func (f *TemplateFactory) RegisterTemplateFunction(name string, function interface{}) error {
+	if err := f.checkAvailable(name); err != nil {
+		return err
+	}
 	f.funcMap[name] = function
+	return nil
+}
+
+// RegisterTemplateFunctions registers every function in the map, see RegisterTemplateFunction.
+func (f *TemplateFactory) RegisterTemplateFunctions(functions map[string]interface{}) error {
+	names := make([]string, 0, len(functions))
+	for name := range functions {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if err := f.RegisterTemplateFunction(name, functions[name]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// RegisterNamespace adds a set of functions that templates call through the namespace, eg: registering 'b64enc' in the
+// 'sprig' namespace makes it available as '{{ sprig.b64enc "value" }}'. Functions in different namespaces never
+// collide with each other or with the top level functions.
+func (f *TemplateFactory) RegisterNamespace(namespace string, functions map[string]interface{}) error {
+	if !f.namespaces[namespace] {
+		if err := f.checkAvailable(namespace); err != nil {
+			return err
+		}
+		// the namespace itself must parse as a function, calling it directly is a mistake though
+		f.funcMap[namespace] = func(...interface{}) (string, error) {
+			return "", fmt.Errorf("'%s' is a function namespace, call its functions as %s.<name>", namespace, namespace)
+		}
+		f.namespaces[namespace] = true
+	}
+	for name, function := range functions {
+		internal := namespacedName(namespace, name)
+		if _, ok := f.funcMap[internal]; ok {
+			return &ConflictError{Name: namespace + "." + name, With: "function"}
+		}
+		f.funcMap[internal] = function
+	}
+	return nil
+}
+
+func (f *TemplateFactory) checkAvailable(name string) error {
+	if f.namespaces[name] {
+		return &ConflictError{Name: name, With: "namespace"}
+	}
+	if _, ok := f.funcMap[name]; ok {
+		return &ConflictError{Name: name, With: "function"}
+	}
+	for _, builtin := range BuiltinFunctions {
+		if builtin == name {
+			return &ConflictError{Name: name, With: "builtin"}
+		}
+	}
+	return nil
+}
+
+// namespacedName is the name a namespaced function is actually registered under in the function map. Template
+// identifiers cannot contain dots so calls to 'namespace.name' are rewritten to this name after parsing.
+func namespacedName(namespace, name string) string {
+	return "__" + namespace + "__" + name
+}
+
+// publicName is the inverse of namespacedName, names that are not namespaced are returned unchanged.
+func publicName(internal string) string {
+	if strings.HasPrefix(internal, "__") {
+		if parts := strings.SplitN(internal[2:], "__", 2); len(parts) == 2 {
+			return parts[0] + "." + parts[1]
+		}
+	}
+	return internal
+}
+
+// resolveNamespaces rewrites chains like 'sprig.b64enc' in the parse tree into calls to the namespaced function.
+func (f *TemplateFactory) resolveNamespaces(tree *parse.Tree, node parse.Node) {
+	switch n := node.(type) {
+	case *parse.ListNode:
+		if n != nil {
+			for _, child := range n.Nodes {
+				f.resolveNamespaces(tree, child)
+			}
+		}
+	case *parse.ActionNode:
+		f.resolveNamespaces(tree, n.Pipe)
+	case *parse.IfNode:
+		f.resolveBranch(tree, &n.BranchNode)
+	case *parse.RangeNode:
+		f.resolveBranch(tree, &n.BranchNode)
+	case *parse.WithNode:
+		f.resolveBranch(tree, &n.BranchNode)
+	case *parse.TemplateNode:
+		f.resolveNamespaces(tree, n.Pipe)
+	case *parse.PipeNode:
+		if n != nil {
+			for _, cmd := range n.Cmds {
+				f.resolveNamespaces(tree, cmd)
+			}
+		}
+	case *parse.CommandNode:
+		for i, arg := range n.Args {
+			if chain, ok := arg.(*parse.ChainNode); ok {
+				n.Args[i] = f.resolveChain(tree, chain)
+			} else {
+				f.resolveNamespaces(tree, arg)
+			}
+		}
+	}
+}
+
+func (f *TemplateFactory) resolveBranch(tree *parse.Tree, n *parse.BranchNode) {
+	f.resolveNamespaces(tree, n.Pipe)
+	f.resolveNamespaces(tree, n.List)
+	f.resolveNamespaces(tree, n.ElseList)
+}
+
+func (f *TemplateFactory) resolveChain(tree *parse.Tree, chain *parse.ChainNode) parse.Node {
+	ident, ok := chain.Node.(*parse.IdentifierNode)
+	if !ok || !f.namespaces[ident.Ident] || len(chain.Field) == 0 {
+		f.resolveNamespaces(tree, chain.Node)
+		return chain
+	}
+	internal := namespacedName(ident.Ident, chain.Field[0])
+	if _, ok := f.funcMap[internal]; !ok {
+		// leave it alone so that executing it reports the namespace misuse
+		return chain
+	}
+	replacement := parse.NewIdentifier(internal).SetTree(tree).SetPos(ident.Pos)
+	if len(chain.Field) == 1 {
+		return replacement
+	}
+	return &parse.ChainNode{NodeType: parse.NodeChain, Pos: chain.Pos, Node: replacement, Field: chain.Field[1:]}
+}
+
+// TemplateFunctionNames returns the names of the registered template functions in lexical order.
+func (f *TemplateFactory) TemplateFunctionNames() []string {
+	out := make([]string, 0, len(f.funcMap))
+	for k := range f.funcMap {
+		if !f.namespaces[k] {
+			out = append(out, publicName(k))
+		}
+	}
+	sort.Strings(out)
+	return out
+}
+
+// DisableTemplateFunction replaces a registered or builtin function with one that always fails, so that templates
+// using it still parse but produce a clear error when rendered.
+func (f *TemplateFactory) DisableTemplateFunction(name string) {
+	if parts := strings.SplitN(name, ".", 2); len(parts) == 2 {
+		name = namespacedName(parts[0], parts[1])
+	}
+	f.funcMap[name] = func(...interface{}) (string, error) {
+		return "", fmt.Errorf("this function has been disabled")
+	}
+}
+
+// Evaluate reports whether a template pipeline such as '.enabled' or 'eq .kind "service"' is true for the
+// current spec, using the same rules as the template 'if' action.
+func (f *TemplateFactory) Evaluate(pipeline string) (bool, error) {
+	condition := f.startDelim + " if " + pipeline + " " + f.endDelim
+	out, err := f.Render(condition + "true" + f.startDelim + " end " + f.endDelim)
+	return out == "true", err
+}
+
+// Parse checks that a template from the named file is syntactically valid and only calls known functions, without
+// rendering it. Errors are returned as a *TemplateParseError.
+func (f *TemplateFactory) Parse(name string, templateString string) error {
+	t := template.New(name).Funcs(f.funcMap).Delims(f.startDelim, f.endDelim)
+	if _, err := t.Parse(templateString); err != nil {
+		return &TemplateParseError{File: name, Line: errorLine(name, err), Err: err}
+	}
+	return nil
 }
 
 func (f *TemplateFactory) Render(templateString string) (string, error) {
-	t := template.New("").Option("missingkey=error").Funcs(f.funcMap).Delims(f.startDelim, f.endDelim)
-	if t, err := t.Parse(templateString); err != nil {
-		return "", err
+	return f.RenderNamed("", templateString)
+}
+
+// RenderNamed renders a template that came from the named file, errors are returned as a *TemplateParseError or
+// *RenderError carrying the file name and line.
+func (f *TemplateFactory) RenderNamed(name string, templateString string) (string, error) {
+	return f.render(name, templateString, f.escapeHTML, f.funcMap, f.spec)
+}
+
+// RenderData renders a template from the named file like RenderNamed, with data as the dot instead of the spec.
+func (f *TemplateFactory) RenderData(name string, templateString string, data interface{}) (string, error) {
+	return f.render(name, templateString, f.escapeHTML, f.funcMap, data)
+}
+
+// Pipe passes the input as the final argument of a template pipeline such as 'printf "# %s\n%s" .name' and returns
+// the result. Unlike Render, the result is never HTML escaped.
+func (f *TemplateFactory) Pipe(pipeline string, input string) (string, error) {
+	return f.render("", f.startDelim+" "+strconv.Quote(input)+" | "+pipeline+" "+f.endDelim, false, f.funcMap, f.spec)
+}
+
+// valueFunction is the internal template function used by Value to capture the result of a pipeline.
+const valueFunction = "_spiroValue"
+
+// Value evaluates a template pipeline such as '.services' or 'list "a" "b"' for the current spec and returns the
+// resulting value itself rather than its text.
+func (f *TemplateFactory) Value(pipeline string) (interface{}, error) {
+	var value interface{}
+	funcs := make(template.FuncMap, len(f.funcMap)+1)
+	for name, function := range f.funcMap {
+		funcs[name] = function
+	}
+	funcs[valueFunction] = func(v interface{}) string {
+		value = v
+		return ""
+	}
+	_, err := f.render("", f.startDelim+" "+valueFunction+" ("+pipeline+") "+f.endDelim, false, funcs, f.spec)
+	return value, err
+}
+
+func (f *TemplateFactory) render(name string, templateString string, escapeHTML bool, funcs template.FuncMap, data interface{}) (string, error) {
+	if f.strict {
+		strictFuncs := make(template.FuncMap, len(funcs)+1)
+		for name, function := range funcs {
+			strictFuncs[name] = function
+		}
+		strictFuncs[strictFunction] = checkInserted
+		funcs = strictFuncs
+	}
+	var trees []*parse.Tree
+	var execute func(w io.Writer) error
+	if escapeHTML {
+		t := htmltemplate.New(name).Option("missingkey=error").Funcs(htmltemplate.FuncMap(funcs)).Delims(f.startDelim, f.endDelim)
+		if _, err := t.Parse(templateString); err != nil {
+			return "", &TemplateParseError{File: name, Line: errorLine(name, err), Err: err}
+		}
+		for _, nt := range t.Templates() {
+			trees = append(trees, nt.Tree)
+		}
+		execute = func(w io.Writer) error { return t.Execute(w, data) }
 	} else {
-		var buf bytes.Buffer
-		err := t.Execute(&buf, f.spec)
-		return buf.String(), err
+		t := template.New(name).Option("missingkey=error").Funcs(funcs).Delims(f.startDelim, f.endDelim)
+		if _, err := t.Parse(templateString); err != nil {
+			return "", &TemplateParseError{File: name, Line: errorLine(name, err), Err: err}
+		}
+		for _, nt := range t.Templates() {
+			trees = append(trees, nt.Tree)
+		}
+		execute = func(w io.Writer) error { return t.Execute(w, data) }
+	}
+
+	for _, tree := range trees {
+		if tree == nil {
+			continue
+		}
+		if len(f.namespaces) > 0 {
+			f.resolveNamespaces(tree, tree.Root)
+		}
+		if f.strict {
+			checkActions(tree, tree.Root)
+		}
+	}
+	var buf bytes.Buffer
+	if err := execute(&buf); err != nil {
+		err = f.publicError(err)
+		return buf.String(), &RenderError{File: name, Line: errorLine(name, err), Column: errorColumn(name, err), Err: err}
+	}
+	return buf.String(), nil
+}
+
+// strictFunction is the internal template function that strict mode appends to the pipeline of every action that
+// inserts a value, to check the value before it is printed.
+const strictFunction = "_spiroStrict"
+
+// strictCall matches the part of an error naming the strictFunction call, which the pipeline it checks replaces.
+var strictCall = regexp.MustCompile(`at <` + strictFunction + ` "(?:[^"\\]|\\.)*">: error calling ` + strictFunction + `: `)
+
+// checkInserted passes on the value of an action's pipeline, failing when it is null instead.
+func checkInserted(pipeline string, value interface{}) (interface{}, error) {
+	if value == nil {
+		return nil, fmt.Errorf("<%s>: null or missing value", pipeline)
+	}
+	return value, nil
+}
+
+// checkActions appends strictFunction, given the original pipeline for the error message, to every action below node
+// that inserts the value of its pipeline. Actions that only declare or assign variables insert nothing, and pipelines
+// ending in the html or urlquery escapers always insert a string (html/template also requires them to come last).
+func checkActions(tree *parse.Tree, node parse.Node) {
+	switch n := node.(type) {
+	case *parse.ListNode:
+		if n != nil {
+			for _, child := range n.Nodes {
+				checkActions(tree, child)
+			}
+		}
+	case *parse.ActionNode:
+		if len(n.Pipe.Decl) > 0 || endsWithEscaper(n.Pipe) {
+			return
+		}
+		check := &parse.CommandNode{NodeType: parse.NodeCommand, Pos: n.Pipe.Pos, Args: []parse.Node{
+			parse.NewIdentifier(strictFunction).SetTree(tree).SetPos(n.Pipe.Pos),
+			&parse.StringNode{NodeType: parse.NodeString, Pos: n.Pipe.Pos, Quoted: strconv.Quote(n.Pipe.String()), Text: n.Pipe.String()},
+		}}
+		n.Pipe.Cmds = append(n.Pipe.Cmds, check)
+	case *parse.IfNode:
+		checkBranch(tree, &n.BranchNode)
+	case *parse.RangeNode:
+		checkBranch(tree, &n.BranchNode)
+	case *parse.WithNode:
+		checkBranch(tree, &n.BranchNode)
+	}
+}
+
+func endsWithEscaper(pipe *parse.PipeNode) bool {
+	if len(pipe.Cmds) == 0 {
+		return false
+	}
+	last := pipe.Cmds[len(pipe.Cmds)-1]
+	ident, ok := last.Args[0].(*parse.IdentifierNode)
+	return ok && (ident.Ident == "html" || ident.Ident == "urlquery")
+}
+
+func checkBranch(tree *parse.Tree, n *parse.BranchNode) {
+	checkActions(tree, n.List)
+	checkActions(tree, n.ElseList)
+}
+
+// publicError rewrites namespaced function names in template errors to the name used in the template.
+func (f *TemplateFactory) publicError(err error) error {
+	if len(f.namespaces) == 0 && !f.strict {
+		return err
+	}
+	msg := err.Error()
+	if f.strict {
+		// a null value caught by strict mode is reported at the action it was inserted by
+		msg = strictCall.ReplaceAllString(msg, "at ")
+	}
+	for namespace := range f.namespaces {
+		msg = strings.Replace(msg, namespacedName(namespace, ""), namespace+".", -1)
 	}
+	return fmt.Errorf("%s", msg)
 }
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/AstromechZA/spiro/templatefactory"
+)
+
+// templateTest is an assertion from the manifest 'tests' section: the template expression rendered with the spec
+// (merged over the spec file given to 'spiro test', if any) must produce the expected output or fail with an error
+// containing ExpectError.
+type templateTest struct {
+	Name        string                 `yaml:"name"`
+	Spec        map[string]interface{} `yaml:"spec"`
+	Expr        string                 `yaml:"expr"`
+	Expect      string                 `yaml:"expect"`
+	ExpectError string                 `yaml:"expect_error"`
+}
+
+// runTemplateTests runs the tests from the manifest of the template. Setup registers the template functions on every
+// template factory that is created.
+func runTemplateTests(inputTemplate string, specFile string, setup func(tf *templatefactory.TemplateFactory) error) error {
+	manifest, err := loadManifest(inputTemplate)
+	if err != nil {
+		return err
+	}
+	if len(manifest.Tests) == 0 {
+		return fmt.Errorf("The template '%s' does not define any tests in its %s", inputTemplate, manifestFileName)
+	}
+	setup = manifest.withDelimiters(setup)
+	base := make(map[string]interface{})
+	if specFile != "" {
+		if base, err = loadSpecFile(specFile); err != nil {
+			return err
+		}
+	}
+
+	failed := 0
+	for i, test := range manifest.Tests {
+		name := test.Name
+		if name == "" {
+			name = fmt.Sprintf("test %d", i+1)
+		}
+		if problem := runTemplateTest(test, base, setup); problem != "" {
+			fmt.Printf("FAIL %s: %s\n", name, problem)
+			failed++
+		} else {
+			fmt.Printf("PASS %s\n", name)
+		}
+	}
+	if failed > 0 {
+		return fmt.Errorf("%d of %d template tests failed", failed, len(manifest.Tests))
+	}
+	fmt.Printf("All %d template tests passed\n", len(manifest.Tests))
+	return nil
+}
+
+// runTemplateTest runs a single test and returns a description of the problem if it failed.
+func runTemplateTest(test templateTest, base map[string]interface{}, setup func(tf *templatefactory.TemplateFactory) error) string {
+	spec := base
+	if test.Spec != nil {
+		spec = mergeSpecs(base, normalizeSpecValue(test.Spec).(map[string]interface{}))
+	}
+	tf := templatefactory.NewTemplateFactory()
+	if err := setup(tf); err != nil {
+		return err.Error()
+	}
+	if err := tf.SetSpec(&spec); err != nil {
+		return err.Error()
+	}
+
+	out, err := tf.Render(test.Expr)
+	switch {
+	case test.ExpectError != "" && err == nil:
+		return fmt.Sprintf("expected an error containing %q but got output %q", test.ExpectError, out)
+	case test.ExpectError != "" && !strings.Contains(err.Error(), test.ExpectError):
+		return fmt.Sprintf("expected an error containing %q but got: %s", test.ExpectError, err.Error())
+	case test.ExpectError != "":
+		return ""
+	case err != nil:
+		return err.Error()
+	case out != test.Expect:
+		return fmt.Sprintf("expected %q but got %q", test.Expect, out)
+	}
+	return ""
+}
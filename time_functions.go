@@ -0,0 +1,198 @@
+package main
+
+import (
+	"fmt"
+	"reflect"
+	"time"
+)
+
+// toTime accepts the forms a timestamp might take in a spec or template: a time.Time, an RFC3339 string, a plain
+// date string or a unix timestamp.
+func toTime(in interface{}) (time.Time, error) {
+	switch v := in.(type) {
+	case time.Time:
+		return v, nil
+	case string:
+		for _, layout := range []string{time.RFC3339Nano, "2006-01-02T15:04:05", "2006-01-02 15:04:05", "2006-01-02"} {
+			if t, err := time.Parse(layout, v); err == nil {
+				return t, nil
+			}
+		}
+		return time.Time{}, fmt.Errorf("cannot parse %q as a timestamp", v)
+	}
+	if secs, err := toInt64(in); err == nil {
+		return time.Unix(secs, 0).UTC(), nil
+	}
+	return time.Time{}, fmt.Errorf("cannot use %v (%T) as a timestamp", in, in)
+}
+
+// toInt64 converts any integer type (or a whole float) into an int64.
+func toInt64(in interface{}) (int64, error) {
+	v := reflect.ValueOf(in)
+	switch v.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return v.Int(), nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return int64(v.Uint()), nil
+	case reflect.Float32, reflect.Float64:
+		if f := v.Float(); f == float64(int64(f)) {
+			return int64(f), nil
+		}
+	}
+	return 0, fmt.Errorf("cannot use %v (%T) as an integer", in, in)
+}
+
+// toDuration accepts a time.Duration, a duration string like "1h30m" or a number of seconds.
+func toDuration(in interface{}) (time.Duration, error) {
+	switch v := in.(type) {
+	case time.Duration:
+		return v, nil
+	case string:
+		return time.ParseDuration(v)
+	}
+	secs, err := toInt64(in)
+	if err != nil {
+		return 0, fmt.Errorf("cannot use %v (%T) as a duration", in, in)
+	}
+	return time.Duration(secs) * time.Second, nil
+}
+
+// RFC3339 formats a timestamp as RFC3339, eg: {{ now | rfc3339 }}.
+func RFC3339(t interface{}) (string, error) {
+	v, err := toTime(t)
+	if err != nil {
+		return "", err
+	}
+	return v.Format(time.RFC3339), nil
+}
+
+// UnixTime returns the unix timestamp (seconds) of a timestamp.
+func UnixTime(t interface{}) (int64, error) {
+	v, err := toTime(t)
+	if err != nil {
+		return 0, err
+	}
+	return v.Unix(), nil
+}
+
+// FromUnix converts unix seconds into a UTC timestamp.
+func FromUnix(secs interface{}) (time.Time, error) {
+	v, err := toInt64(secs)
+	if err != nil {
+		return time.Time{}, err
+	}
+	return time.Unix(v, 0).UTC(), nil
+}
+
+// ParseTime parses a timestamp using a Go reference layout, eg: {{ parseTime "2006-01-02" .release_date }}.
+func ParseTime(layout string, value string) (time.Time, error) {
+	return time.Parse(layout, value)
+}
+
+// ParseDuration parses a Go duration string such as "90m" or "1h30m".
+func ParseDuration(value string) (time.Duration, error) {
+	return time.ParseDuration(value)
+}
+
+// AddDuration adds a duration to a timestamp, eg: {{ now | addDuration "36h" }}.
+func AddDuration(d interface{}, t interface{}) (time.Time, error) {
+	dv, err := toDuration(d)
+	if err != nil {
+		return time.Time{}, err
+	}
+	tv, err := toTime(t)
+	if err != nil {
+		return time.Time{}, err
+	}
+	return tv.Add(dv), nil
+}
+
+// AddDays adds a number of calendar days (which may be negative) to a timestamp, eg: {{ now | addDays 30 }}.
+func AddDays(days interface{}, t interface{}) (time.Time, error) {
+	n, tv, err := dateArgs(days, t)
+	if err != nil {
+		return time.Time{}, err
+	}
+	return tv.AddDate(0, 0, n), nil
+}
+
+// AddMonths adds a number of calendar months (which may be negative) to a timestamp. Days past the end of the target
+// month are clamped to its last day, so one month after January 31st is the last day of February.
+func AddMonths(months interface{}, t interface{}) (time.Time, error) {
+	n, tv, err := dateArgs(months, t)
+	if err != nil {
+		return time.Time{}, err
+	}
+	return addCalendarMonths(tv, n), nil
+}
+
+// AddYears adds a number of calendar years (which may be negative) to a timestamp. February 29th becomes February 28th
+// in years that are not leap years.
+func AddYears(years interface{}, t interface{}) (time.Time, error) {
+	n, tv, err := dateArgs(years, t)
+	if err != nil {
+		return time.Time{}, err
+	}
+	return addCalendarMonths(tv, 12*n), nil
+}
+
+func dateArgs(amount interface{}, t interface{}) (int, time.Time, error) {
+	n, err := toInt64(amount)
+	if err != nil {
+		return 0, time.Time{}, err
+	}
+	tv, err := toTime(t)
+	if err != nil {
+		return 0, time.Time{}, err
+	}
+	return int(n), tv, nil
+}
+
+// addCalendarMonths moves a timestamp by a number of months, keeping its day unless the target month is shorter.
+// Unlike time.AddDate, which normalizes January 31st plus one month to March 3rd, it never overflows into the next
+// month.
+func addCalendarMonths(t time.Time, months int) time.Time {
+	first := time.Date(t.Year(), t.Month()+time.Month(months), 1, 0, 0, 0, 0, t.Location())
+	day := t.Day()
+	// day 0 of the following month is the last day of this one
+	if last := time.Date(first.Year(), first.Month()+1, 0, 0, 0, 0, 0, t.Location()).Day(); day > last {
+		day = last
+	}
+	return time.Date(first.Year(), first.Month(), day, t.Hour(), t.Minute(), t.Second(), t.Nanosecond(), t.Location())
+}
+
+// StartOfDay truncates a timestamp to midnight in its own location.
+func StartOfDay(t interface{}) (time.Time, error) {
+	tv, err := toTime(t)
+	if err != nil {
+		return time.Time{}, err
+	}
+	return time.Date(tv.Year(), tv.Month(), tv.Day(), 0, 0, 0, 0, tv.Location()), nil
+}
+
+// StartOfMonth returns midnight on the first day of the timestamp's month.
+func StartOfMonth(t interface{}) (time.Time, error) {
+	tv, err := toTime(t)
+	if err != nil {
+		return time.Time{}, err
+	}
+	return time.Date(tv.Year(), tv.Month(), 1, 0, 0, 0, 0, tv.Location()), nil
+}
+
+// EndOfMonth returns the last nanosecond of the timestamp's month.
+func EndOfMonth(t interface{}) (time.Time, error) {
+	start, err := StartOfMonth(t)
+	if err != nil {
+		return time.Time{}, err
+	}
+	return start.AddDate(0, 1, 0).Add(-time.Nanosecond), nil
+}
+
+// StartOfYear returns midnight on the first of January of the timestamp's year.
+func StartOfYear(t interface{}) (time.Time, error) {
+	tv, err := toTime(t)
+	if err != nil {
+		return time.Time{}, err
+	}
+	return time.Date(tv.Year(), time.January, 1, 0, 0, 0, 0, tv.Location()), nil
+}
@@ -0,0 +1,175 @@
+package main
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"fmt"
+	"math/big"
+	"net"
+	"time"
+)
+
+// certificate is a generated certificate and its private key, both PEM encoded, as returned by genSelfSignedCert.
+type certificate struct {
+	Cert string
+	Key  string
+}
+
+// GenPrivateKey generates a PEM encoded private key of the given type: "rsa" (2048 bit) or "ecdsa" (P-256).
+func GenPrivateKey(keyType string) (string, error) {
+	var key crypto.Signer
+	var err error
+	switch keyType {
+	case "rsa":
+		key, err = rsa.GenerateKey(rand.Reader, 2048)
+	case "ecdsa":
+		key, err = ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	default:
+		return "", fmt.Errorf("unknown key type '%s' (supported: rsa, ecdsa)", keyType)
+	}
+	if err != nil {
+		return "", err
+	}
+	return encodePrivateKey(key)
+}
+
+func encodePrivateKey(key crypto.Signer) (string, error) {
+	var block *pem.Block
+	switch k := key.(type) {
+	case *rsa.PrivateKey:
+		block = &pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(k)}
+	case *ecdsa.PrivateKey:
+		der, err := x509.MarshalECPrivateKey(k)
+		if err != nil {
+			return "", err
+		}
+		block = &pem.Block{Type: "EC PRIVATE KEY", Bytes: der}
+	default:
+		return "", fmt.Errorf("unsupported private key type %T", key)
+	}
+	var buf bytes.Buffer
+	pem.Encode(&buf, block)
+	return buf.String(), nil
+}
+
+// decodePrivateKey parses a PEM encoded RSA or ECDSA private key in PKCS#1, SEC 1 or PKCS#8 form.
+func decodePrivateKey(in string) (crypto.Signer, error) {
+	block, _ := pem.Decode([]byte(in))
+	if block == nil {
+		return nil, fmt.Errorf("no PEM encoded private key found")
+	}
+	if key, err := x509.ParsePKCS1PrivateKey(block.Bytes); err == nil {
+		return key, nil
+	}
+	if key, err := x509.ParseECPrivateKey(block.Bytes); err == nil {
+		return key, nil
+	}
+	key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("unable to parse the private key: %s", err.Error())
+	}
+	if signer, ok := key.(crypto.Signer); ok {
+		return signer, nil
+	}
+	return nil, fmt.Errorf("unsupported private key type %T", key)
+}
+
+// subjectAltNames splits the template lists of IP addresses and DNS names for a certificate or CSR.
+func subjectAltNames(ips interface{}, dnsNames interface{}) ([]net.IP, []string, error) {
+	ipStrings, err := ToStrings(ips)
+	if err != nil {
+		return nil, nil, err
+	}
+	names, err := ToStrings(dnsNames)
+	if err != nil {
+		return nil, nil, err
+	}
+	var addresses []net.IP
+	for _, s := range ipStrings {
+		ip := net.ParseIP(s)
+		if ip == nil {
+			return nil, nil, fmt.Errorf("invalid IP address '%s'", s)
+		}
+		addresses = append(addresses, ip)
+	}
+	return addresses, names, nil
+}
+
+// GenSelfSignedCert generates a new RSA key and a self-signed certificate for it that is valid for the given number
+// of days, eg: genSelfSignedCert "localhost" (list "127.0.0.1") (list "localhost") 365. The result has .Cert and .Key.
+func GenSelfSignedCert(commonName string, ips interface{}, dnsNames interface{}, days int) (*certificate, error) {
+	key, err := GenPrivateKey("rsa")
+	if err != nil {
+		return nil, err
+	}
+	return GenSelfSignedCertWithKey(commonName, ips, dnsNames, days, key)
+}
+
+// GenSelfSignedCertWithKey is genSelfSignedCert with an existing PEM encoded private key, such as one from
+// genPrivateKey.
+func GenSelfSignedCertWithKey(commonName string, ips interface{}, dnsNames interface{}, days int, privateKey string) (*certificate, error) {
+	key, err := decodePrivateKey(privateKey)
+	if err != nil {
+		return nil, err
+	}
+	addresses, names, err := subjectAltNames(ips, dnsNames)
+	if err != nil {
+		return nil, err
+	}
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	template := &x509.Certificate{
+		SerialNumber:          serial,
+		Subject:               pkix.Name{CommonName: commonName},
+		NotBefore:             now,
+		NotAfter:              now.Add(time.Duration(days) * 24 * time.Hour),
+		KeyUsage:              x509.KeyUsageKeyEncipherment | x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+		IPAddresses:           addresses,
+		DNSNames:              names,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, key.Public(), key)
+	if err != nil {
+		return nil, err
+	}
+	var buf bytes.Buffer
+	pem.Encode(&buf, &pem.Block{Type: "CERTIFICATE", Bytes: der})
+	encodedKey, err := encodePrivateKey(key)
+	if err != nil {
+		return nil, err
+	}
+	return &certificate{Cert: buf.String(), Key: encodedKey}, nil
+}
+
+// GenCSR generates a PEM encoded certificate signing request for a PEM encoded private key, eg: genCSR $key
+// "example.com" (list "example.com" "www.example.com").
+func GenCSR(privateKey string, commonName string, dnsNames interface{}) (string, error) {
+	key, err := decodePrivateKey(privateKey)
+	if err != nil {
+		return "", err
+	}
+	_, names, err := subjectAltNames([]string{}, dnsNames)
+	if err != nil {
+		return "", err
+	}
+	template := &x509.CertificateRequest{Subject: pkix.Name{CommonName: commonName}, DNSNames: names}
+	der, err := x509.CreateCertificateRequest(rand.Reader, template, key)
+	if err != nil {
+		return "", err
+	}
+	var buf bytes.Buffer
+	pem.Encode(&buf, &pem.Block{Type: "CERTIFICATE REQUEST", Bytes: der})
+	return buf.String(), nil
+}
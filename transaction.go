@@ -0,0 +1,226 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+)
+
+// fileBackup is the original state of an output path that a run changed.
+type fileBackup struct {
+	mode    os.FileMode
+	content []byte
+	// link is the target of a symbolic link
+	link string
+}
+
+// transactionSink passes everything through to another sink while recording which paths it creates and the original
+// content and permissions of the existing paths it changes, so that a failed run can be rolled back instead of leaving
+// a partially written output directory behind.
+type transactionSink struct {
+	outputSink
+	// created lists the paths that did not exist before the run, in the order they were created
+	created []string
+	backups map[string]*fileBackup
+	seen    map[string]bool
+}
+
+func newTransactionSink(inner outputSink) *transactionSink {
+	return &transactionSink{outputSink: inner, backups: make(map[string]*fileBackup), seen: make(map[string]bool)}
+}
+
+// track records the state of a path the first time the run touches it.
+func (s *transactionSink) track(file string) error {
+	if s.seen[file] {
+		return nil
+	}
+	info, err := os.Lstat(longPath(file))
+	if os.IsNotExist(err) {
+		s.seen[file] = true
+		s.created = append(s.created, file)
+		return nil
+	} else if err != nil {
+		return err
+	}
+	backup := &fileBackup{mode: info.Mode()}
+	if info.Mode().IsRegular() {
+		if backup.content, err = ioutil.ReadFile(longPath(file)); err != nil {
+			return err
+		}
+	} else if info.Mode()&os.ModeSymlink != 0 {
+		if backup.link, err = os.Readlink(longPath(file)); err != nil {
+			return err
+		}
+	}
+	s.seen[file] = true
+	s.backups[file] = backup
+	return nil
+}
+
+// trackTree records the state of a path and of everything below it.
+func (s *transactionSink) trackTree(root string) error {
+	return filepath.Walk(root, func(item string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		return s.track(item)
+	})
+}
+
+// makeDirs creates a directory and any missing parents, recording the ones it creates.
+func (s *transactionSink) makeDirs(dir string) error {
+	if _, err := os.Stat(longPath(dir)); err == nil {
+		return nil
+	}
+	if err := s.makeDirs(filepath.Dir(dir)); err != nil {
+		return err
+	}
+	return s.MakeDir(dir)
+}
+
+// rename moves src to dst, creating the missing parents of dst. Both are recorded so that a rollback puts src back and
+// removes what was moved to dst. A nil sink renames without recording anything.
+func (s *transactionSink) rename(src, dst string) error {
+	if s == nil {
+		if err := os.MkdirAll(longPath(filepath.Dir(dst)), 0755); err != nil {
+			return err
+		}
+		return os.Rename(longPath(src), longPath(dst))
+	}
+	if err := s.makeDirs(filepath.Dir(dst)); err != nil {
+		return err
+	}
+	if err := s.trackTree(src); err != nil {
+		return err
+	}
+	if _, err := os.Lstat(longPath(dst)); err == nil {
+		if err := s.trackTree(dst); err != nil {
+			return err
+		}
+	}
+	if err := os.Rename(longPath(src), longPath(dst)); err != nil {
+		return err
+	}
+	// everything below dst that wasn't there before is new
+	return filepath.Walk(dst, func(item string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if !s.seen[item] {
+			s.seen[item] = true
+			s.created = append(s.created, item)
+		}
+		return nil
+	})
+}
+
+// removeAll removes a path and everything below it, recording what it removes so that a rollback restores it. A nil
+// sink removes without recording anything.
+func (s *transactionSink) removeAll(file string) error {
+	if s != nil {
+		if _, err := os.Lstat(longPath(file)); err == nil {
+			if err := s.trackTree(file); err != nil {
+				return err
+			}
+		}
+	}
+	return os.RemoveAll(longPath(file))
+}
+
+func (s *transactionSink) MakeDir(dir string) error {
+	if err := s.track(dir); err != nil {
+		return err
+	}
+	return s.outputSink.MakeDir(dir)
+}
+
+func (s *transactionSink) WriteFile(file string, content []byte) error {
+	if err := s.track(file); err != nil {
+		return err
+	}
+	return s.outputSink.WriteFile(file, content)
+}
+
+func (s *transactionSink) Chmod(file string, mode os.FileMode) error {
+	if err := s.track(file); err != nil {
+		return err
+	}
+	return s.outputSink.Chmod(file, mode)
+}
+
+// rollback restores the changed and removed paths, parents first, and removes the created ones, newest first. It
+// carries on past failures and returns the first one.
+func (s *transactionSink) rollback() error {
+	var first error
+	fail := func(err error) {
+		if first == nil {
+			first = err
+		}
+	}
+	files := make([]string, 0, len(s.backups))
+	for file := range s.backups {
+		files = append(files, file)
+	}
+	sort.Strings(files)
+	// directory permissions are restored last, so that the content of a read-only directory can still be restored
+	var dirs []string
+	for _, file := range files {
+		backup := s.backups[file]
+		if err := os.MkdirAll(longPath(filepath.Dir(file)), 0755); err != nil {
+			fail(err)
+			continue
+		}
+		switch {
+		case backup.mode.IsDir():
+			if err := os.MkdirAll(longPath(file), 0755); err != nil {
+				fail(err)
+			}
+			dirs = append(dirs, file)
+			continue
+		case backup.mode&os.ModeSymlink != 0:
+			if _, err := os.Lstat(longPath(file)); os.IsNotExist(err) {
+				if err := os.Symlink(backup.link, longPath(file)); err != nil {
+					fail(err)
+				}
+			}
+			continue
+		case backup.mode.IsRegular():
+			if err := ioutil.WriteFile(longPath(file), backup.content, backup.mode.Perm()); err != nil {
+				fail(err)
+				continue
+			}
+		}
+		if err := os.Chmod(longPath(file), backup.mode.Perm()); err != nil {
+			fail(err)
+		}
+	}
+	for i := len(s.created) - 1; i >= 0; i-- {
+		if err := os.Remove(longPath(s.created[i])); err != nil && !os.IsNotExist(err) {
+			fail(err)
+		}
+	}
+	for _, dir := range dirs {
+		if err := os.Chmod(longPath(dir), s.backups[dir].mode.Perm()); err != nil {
+			fail(err)
+		}
+	}
+	return first
+}
+
+// changes returns how many paths the run created or changed.
+func (s *transactionSink) changes() int {
+	return len(s.created) + len(s.backups)
+}
+
+// rollbackOutput undoes the changes recorded by the sink after a failed run, reporting what happened.
+func rollbackOutput(tx *transactionSink) {
+	if tx.changes() == 0 {
+		return
+	}
+	if err := tx.rollback(); err != nil {
+		logs.Warnf("could not roll back every change to the output directory: %s", err.Error())
+		return
+	}
+	logs.Infof("Rolled back %d change(s) to the output directory", tx.changes())
+}
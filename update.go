@@ -0,0 +1,298 @@
+package main
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// baseFileName is written to the output directory next to the answers file. It is a tar.gz of the files exactly as
+// spiro rendered them, which 'spiro update' uses as the common ancestor when merging a new render with the edits made
+// to the output since.
+const baseFileName = ".spiro-base.tar.gz"
+
+// Conflicting changes are written between git style conflict markers.
+const (
+	conflictStartMarker = "<<<<<<< local"
+	conflictSepMarker   = "======="
+	conflictEndMarker   = ">>>>>>> template"
+)
+
+// isBaseFile reports whether a rendered file belongs in the base, spiro's own bookkeeping files don't.
+func isBaseFile(file string) bool {
+	name := path.Base(filepath.ToSlash(file))
+	return name != answersFileName && name != baseFileName
+}
+
+// writeBaseFile writes the rendered files below dir into the base file in dir.
+func writeBaseFile(sink outputSink, dir string, rendered map[string][]byte) error {
+	files := newMemorySink()
+	for file, content := range rendered {
+		if isBaseFile(file) {
+			files.Files[file] = &memoryFile{Content: content, Mode: 0644}
+		}
+	}
+	var buf bytes.Buffer
+	if err := writeTarGz(&buf, archiveEntries(dir, files)); err != nil {
+		return err
+	}
+	file := path.Join(dir, baseFileName)
+	if err := sink.WriteFile(file, buf.Bytes()); err != nil {
+		return fmt.Errorf("Error while writing base file '%s': %s", file, err.Error())
+	}
+	return nil
+}
+
+// readBaseFile reads the base file in dir, returning the content of the files it holds by their slash separated path
+// relative to dir.
+func readBaseFile(dir string) (map[string][]byte, error) {
+	file := path.Join(dir, baseFileName)
+	content, err := ioutil.ReadFile(longPath(file))
+	if os.IsNotExist(err) {
+		return nil, fmt.Errorf("There is no %s in '%s' to merge with, it is written with the %s when rendering with -prompt, -edit or -save-answers", baseFileName, dir, answersFileName)
+	} else if err != nil {
+		return nil, fmt.Errorf("Could not read base file '%s': %s", file, err.Error())
+	}
+	fail := func(err error) (map[string][]byte, error) {
+		return nil, fmt.Errorf("Could not read base file '%s': %s", file, err.Error())
+	}
+	gz, err := gzip.NewReader(bytes.NewReader(content))
+	if err != nil {
+		return fail(err)
+	}
+	base := make(map[string][]byte)
+	tr := tar.NewReader(gz)
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return fail(err)
+		}
+		if header.Typeflag != tar.TypeReg {
+			continue
+		}
+		if base[header.Name], err = ioutil.ReadAll(tr); err != nil {
+			return fail(err)
+		}
+	}
+	return base, nil
+}
+
+// lineMatches returns, for every line of base, the index of the same line in other, or -1 when other removed or
+// replaced it.
+func lineMatches(base, other []string) ([]int, error) {
+	ops, err := diffLines(base, other)
+	if err != nil {
+		return nil, err
+	}
+	matches := make([]int, len(base))
+	i, j := 0, 0
+	for _, op := range ops {
+		switch op.Kind {
+		case ' ':
+			matches[i] = j
+			i++
+			j++
+		case '-':
+			matches[i] = -1
+			i++
+		case '+':
+			j++
+		}
+	}
+	return matches, nil
+}
+
+func equalLines(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// mergeLines merges the changes that local and template each made to base, like diff3. The lines that both kept
+// unchanged split the files into chunks; a chunk changed on one side only takes that change, and a chunk changed
+// differently on both sides is written between conflict markers. It returns the merged content and the number of
+// conflicts.
+func mergeLines(base, local, template string) (string, int, error) {
+	baseLines, localLines, templateLines := splitLines(base), splitLines(local), splitLines(template)
+	localMatches, err := lineMatches(baseLines, localLines)
+	if err != nil {
+		return "", 0, err
+	}
+	templateMatches, err := lineMatches(baseLines, templateLines)
+	if err != nil {
+		return "", 0, err
+	}
+	var out strings.Builder
+	conflicts := 0
+	i, l, t := 0, 0, 0
+	for {
+		next := i
+		for next < len(baseLines) && (localMatches[next] < 0 || templateMatches[next] < 0) {
+			next++
+		}
+		localEnd, templateEnd := len(localLines), len(templateLines)
+		if next < len(baseLines) {
+			localEnd, templateEnd = localMatches[next], templateMatches[next]
+		}
+		b, lc, tc := baseLines[i:next], localLines[l:localEnd], templateLines[t:templateEnd]
+		switch {
+		case equalLines(lc, tc) || equalLines(b, tc):
+			out.WriteString(strings.Join(lc, ""))
+		case equalLines(b, lc):
+			out.WriteString(strings.Join(tc, ""))
+		default:
+			conflicts++
+			out.WriteString(conflictStartMarker + "\n")
+			writeConflictSide(&out, lc)
+			out.WriteString(conflictSepMarker + "\n")
+			writeConflictSide(&out, tc)
+			out.WriteString(conflictEndMarker + "\n")
+		}
+		if next == len(baseLines) {
+			break
+		}
+		out.WriteString(baseLines[next])
+		i, l, t = next+1, localEnd+1, templateEnd+1
+	}
+	return out.String(), conflicts, nil
+}
+
+// writeConflictSide writes one side of a conflict, ending it with a newline so that the next marker starts a line.
+func writeConflictSide(out *strings.Builder, lines []string) {
+	for _, line := range lines {
+		out.WriteString(line)
+	}
+	if len(lines) > 0 && !strings.HasSuffix(lines[len(lines)-1], "\n") {
+		out.WriteString("\n")
+	}
+}
+
+// updateOutput merges a new render, collected in memory, into the output directory for 'spiro update'. For every
+// rendered file the base is what spiro rendered last time and the local version is what is in the output directory
+// now: files changed only by the template are replaced, files changed only locally are kept, and files changed on
+// both sides are merged line by line with conflict markers where the changes overlap. Files the template no longer
+// generates are left in place. The run fails after writing everything when there are conflicts to resolve.
+func updateOutput(outputDir string, rendered *memorySink, base map[string][]byte, redact *redactor) (err error) {
+	tx := newTransactionSink(diskSink{})
+	defer func() {
+		if err != nil && err != errUpdateConflicts {
+			rollbackOutput(tx)
+		}
+	}()
+	var updated, merged, conflicted, kept, removed []string
+	dirs := make([]string, 0, len(rendered.Dirs))
+	for dir := range rendered.Dirs {
+		dirs = append(dirs, dir)
+	}
+	// parents sort before their children
+	sort.Strings(dirs)
+	for _, dir := range dirs {
+		if err := tx.MakeDir(dir); err != nil {
+			return fmt.Errorf("Error while creating directory '%s': %s", dir, err.Error())
+		}
+	}
+	generated := make(map[string]bool)
+	for _, file := range rendered.SortedFiles() {
+		f := rendered.Files[file]
+		rel, ok := archiveName(outputDir, file)
+		if !ok {
+			continue
+		}
+		generated[rel] = true
+		baseContent, inBase := base[rel]
+		local, err := ioutil.ReadFile(longPath(file))
+		switch {
+		case os.IsNotExist(err):
+			if inBase && bytes.Equal(baseContent, f.Content) {
+				// deleted locally and unchanged by the template
+				removed = append(removed, file)
+				continue
+			}
+		case err != nil:
+			return fmt.Errorf("Error while reading existing output '%s': %s", file, err.Error())
+		case bytes.Equal(local, f.Content):
+			continue
+		case !isBaseFile(file) || inBase && bytes.Equal(local, baseContent):
+		case inBase && bytes.Equal(baseContent, f.Content):
+			kept = append(kept, file)
+			continue
+		case isBinary(local) || isBinary(f.Content) || inBase && isBinary(baseContent):
+			logs.Warnf("'%s' was changed both locally and by the template and cannot be merged, keeping the local version", redact.Redact(file))
+			conflicted = append(conflicted, file)
+			continue
+		default:
+			// files added on both sides are merged as if they started out empty
+			content, conflicts, err := mergeLines(string(baseContent), string(local), string(f.Content))
+			if err != nil {
+				return fmt.Errorf("Error while merging '%s': %s", file, err.Error())
+			}
+			if conflicts > 0 {
+				conflicted = append(conflicted, file)
+			} else {
+				merged = append(merged, file)
+			}
+			if err := tx.WriteFile(file, []byte(content)); err != nil {
+				return fmt.Errorf("Error while writing '%s': %s", file, err.Error())
+			}
+			continue
+		}
+		if err := tx.WriteFile(file, f.Content); err != nil {
+			return fmt.Errorf("Error while writing '%s': %s", file, err.Error())
+		}
+		if err := tx.Chmod(file, f.Mode); err != nil {
+			return fmt.Errorf("Error while setting permissions on '%s': %s", file, err.Error())
+		}
+		if isBaseFile(file) {
+			updated = append(updated, file)
+		}
+	}
+	var stale []string
+	for rel := range base {
+		file := filepath.Join(outputDir, filepath.FromSlash(rel))
+		if _, err := os.Stat(longPath(file)); err == nil && !generated[rel] {
+			stale = append(stale, file)
+		}
+	}
+	sort.Strings(stale)
+
+	for _, group := range []struct {
+		message string
+		files   []string
+	}{
+		{"Updated %d file(s) from the template:%s", updated},
+		{"Merged local changes into %d updated file(s):%s", merged},
+		{"Kept %d file(s) changed locally and not by the template:%s", kept},
+		{"Left out %d file(s) deleted locally:%s", removed},
+		{"Left %d file(s) in place that the template no longer generates:%s", stale},
+	} {
+		if len(group.files) > 0 {
+			logs.Infof(group.message, len(group.files), fileList(group.files, redact))
+		}
+	}
+	if len(conflicted) > 0 {
+		logs.Warnf("%d file(s) have conflicting local and template changes:%s", len(conflicted), fileList(conflicted, redact))
+		return errUpdateConflicts
+	}
+	return nil
+}
+
+// errUpdateConflicts is returned by 'spiro update' once everything else has been written. The output is not rolled
+// back, the conflicts are resolved by hand.
+var errUpdateConflicts = errors.New("The update has conflicts, resolve them and remove the conflict markers")
@@ -0,0 +1,56 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	yaml "gopkg.in/yaml.v2"
+)
+
+// userConfig holds per user settings read from $XDG_CONFIG_HOME/spiro/config.yaml (usually
+// ~/.config/spiro/config.yaml), or from the file named by $SPIRO_CONFIG.
+type userConfig struct {
+	Telemetry telemetryConfig `yaml:"telemetry"`
+}
+
+// userConfigPath returns where the user config is read from, or an empty string if there is no home directory.
+func userConfigPath() string {
+	if path := os.Getenv("SPIRO_CONFIG"); path != "" {
+		return path
+	}
+	if dir := os.Getenv("XDG_CONFIG_HOME"); dir != "" {
+		return filepath.Join(dir, "spiro", "config.yaml")
+	}
+	if home := os.Getenv("HOME"); home != "" {
+		return filepath.Join(home, ".config", "spiro", "config.yaml")
+	}
+	return ""
+}
+
+// loadUserConfig reads the user config, a missing file is the same as an empty one.
+func loadUserConfig() (*userConfig, error) {
+	config := &userConfig{}
+	path := userConfigPath()
+	if path == "" {
+		return config, nil
+	}
+	content, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return config, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("Could not read user config '%s': %s", path, err.Error())
+	}
+	dec := yaml.NewDecoder(bytes.NewReader(content))
+	dec.SetStrict(true)
+	if err := dec.Decode(config); err != nil && err != io.EOF {
+		return nil, fmt.Errorf("Could not parse user config '%s': %s", path, err.Error())
+	}
+	if config.Telemetry.Enabled && config.Telemetry.URL == "" {
+		return nil, fmt.Errorf("Invalid user config '%s': telemetry requires a url", path)
+	}
+	return config, nil
+}
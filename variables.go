@@ -0,0 +1,145 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// templateVariable declares a spec value that the template needs, from the manifest 'variables' section. Values
+// missing from the spec are taken from the default or, with -prompt, asked for on the terminal.
+type templateVariable struct {
+	// Name is the dotted spec path of the value, eg: 'database.port'.
+	Name        string `yaml:"name"`
+	Description string `yaml:"description"`
+	// Type is one of string (the default), int, float or bool.
+	Type    string        `yaml:"type"`
+	Default interface{}   `yaml:"default"`
+	Choices []interface{} `yaml:"choices"`
+}
+
+// validate checks the declaration itself so that mistakes in the manifest are found before anything is asked.
+func (v *templateVariable) validate() error {
+	if v.Name == "" {
+		return fmt.Errorf("variables require a name")
+	}
+	switch v.Type {
+	case "", "string", "int", "float", "bool":
+	default:
+		return fmt.Errorf("variable '%s' has unknown type '%s', expected one of string, int, float, bool", v.Name, v.Type)
+	}
+	for _, choice := range v.Choices {
+		if _, err := v.parse(fmt.Sprint(choice)); err != nil {
+			return fmt.Errorf("variable '%s' has an invalid choice: %s", v.Name, err.Error())
+		}
+	}
+	if v.Default != nil {
+		if _, err := v.parse(fmt.Sprint(v.Default)); err != nil {
+			return fmt.Errorf("variable '%s' has an invalid default: %s", v.Name, err.Error())
+		}
+	}
+	return nil
+}
+
+// parse converts an answer into a value of the variable's type and checks it against the choices.
+func (v *templateVariable) parse(answer string) (interface{}, error) {
+	var value interface{}
+	var err error
+	switch v.Type {
+	case "int":
+		value, err = strconv.Atoi(answer)
+	case "float":
+		value, err = strconv.ParseFloat(answer, 64)
+	case "bool":
+		switch strings.ToLower(answer) {
+		case "y", "yes":
+			value = true
+		case "n", "no":
+			value = false
+		default:
+			value, err = strconv.ParseBool(answer)
+		}
+	default:
+		value = answer
+	}
+	if err != nil {
+		return nil, fmt.Errorf("'%s' is not a valid %s", answer, v.Type)
+	}
+	if len(v.Choices) > 0 {
+		choices := make([]string, len(v.Choices))
+		for i, choice := range v.Choices {
+			choices[i] = fmt.Sprint(choice)
+			if choices[i] == fmt.Sprint(value) {
+				return value, nil
+			}
+		}
+		return nil, fmt.Errorf("expected one of %s", strings.Join(choices, ", "))
+	}
+	return value, nil
+}
+
+// question is what the user is asked for the variable.
+func (v *templateVariable) question() string {
+	question := v.Name
+	if v.Description != "" {
+		question += " (" + v.Description + ")"
+	}
+	if len(v.Choices) > 0 {
+		choices := make([]string, len(v.Choices))
+		for i, choice := range v.Choices {
+			choices[i] = fmt.Sprint(choice)
+		}
+		question += " {" + strings.Join(choices, ", ") + "}"
+	}
+	return question
+}
+
+// setSpecPath sets the value at the dotted path of the spec, creating nested maps as needed.
+func setSpecPath(spec map[string]interface{}, dotted string, value interface{}) error {
+	keys := strings.Split(dotted, ".")
+	current := spec
+	for _, key := range keys[:len(keys)-1] {
+		next, ok := current[key]
+		if !ok {
+			next = make(map[string]interface{})
+			current[key] = next
+		}
+		if current, ok = next.(map[string]interface{}); !ok {
+			return fmt.Errorf("'%s' is not a map", key)
+		}
+	}
+	current[keys[len(keys)-1]] = value
+	return nil
+}
+
+// applyTemplateVariables fills in the declared variables that the spec does not set. With prompt the user is asked
+// for each of them (offering the default), otherwise the default is used and variables without one are an error.
+func applyTemplateVariables(spec map[string]interface{}, variables []templateVariable, prompts *prompter, prompt bool) error {
+	for i := range variables {
+		v := &variables[i]
+		if _, ok := lookupSpecPath(spec, v.Name); ok {
+			continue
+		}
+		var value interface{}
+		var err error
+		switch {
+		case prompt:
+			def := ""
+			if v.Default != nil {
+				def = fmt.Sprint(v.Default)
+			}
+			value, err = prompts.AskValid(v.question(), def, v.parse)
+		case v.Default != nil:
+			value, err = v.parse(fmt.Sprint(v.Default))
+		default:
+			err = fmt.Errorf("it is not set by the spec and has no default, use -prompt to be asked for it")
+		}
+		if err != nil {
+			return fmt.Errorf("Error while setting template variable '%s': %s", v.Name, err.Error())
+		}
+		if err := setSpecPath(spec, v.Name, value); err != nil {
+			return fmt.Errorf("Error while setting template variable '%s': %s", v.Name, err.Error())
+		}
+	}
+	return nil
+}
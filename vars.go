@@ -0,0 +1,119 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	"github.com/AstromechZA/spiro/templatefactory"
+)
+
+// specLocation is where a template reads a spec value: the template path and, for file content, the line.
+type specLocation struct {
+	path string
+	line int
+}
+
+func (l specLocation) String() string {
+	if l.line > 0 {
+		return fmt.Sprintf("%s:%d", l.path, l.line)
+	}
+	return l.path
+}
+
+// specReferences returns the spec paths read by the sources of a template, each with the places that read it. Sources
+// rendered once per list element are left out since the keys of the element can't be told apart from spec values.
+func specReferences(inputTemplate string, tf *templatefactory.TemplateFactory, manifest *templateManifest) (map[string][]specLocation, error) {
+	sources, err := templateSources(inputTemplate, tf, manifest)
+	if err != nil {
+		return nil, err
+	}
+	references := make(map[string][]specLocation)
+	for _, source := range sources {
+		if source.foreach {
+			continue
+		}
+		found, err := tf.SpecReferences(source.name, source.text)
+		if err != nil {
+			return nil, fmt.Errorf("Error while parsing %s: %s", source.what, err.Error())
+		}
+		for _, reference := range found {
+			location := specLocation{path: source.path}
+			if source.content {
+				location.line = reference.Line
+			}
+			locations := references[reference.Path]
+			if len(locations) == 0 || locations[len(locations)-1] != location {
+				references[reference.Path] = append(locations, location)
+			}
+		}
+	}
+	return references, nil
+}
+
+// runTemplateVars lists every spec key that a template reads for 'spiro vars', with the files and lines reading it.
+// When the template declares its inputs, with manifest variables or a spec schema, keys that neither declares are
+// flagged and fail the command, and declared variables that nothing reads are pointed out.
+func runTemplateVars(w io.Writer, inputTemplate string, setup func(tf *templatefactory.TemplateFactory) error) error {
+	manifest, err := loadManifest(inputTemplate)
+	if err != nil {
+		return err
+	}
+	tf := templatefactory.NewTemplateFactory()
+	if err := manifest.withDelimiters(setup)(tf); err != nil {
+		return err
+	}
+	references, err := specReferences(inputTemplate, tf, manifest)
+	if err != nil {
+		return err
+	}
+	specSchema, err := loadSpecSchema(inputTemplate, manifest)
+	if err != nil {
+		return err
+	}
+	checked := len(manifest.Variables) > 0 || specSchema != nil
+
+	paths := make([]string, 0, len(references))
+	for path := range references {
+		paths = append(paths, path)
+	}
+	for _, v := range manifest.Variables {
+		if !isReferenced(references, v.Name) {
+			paths = append(paths, v.Name)
+		}
+	}
+	sort.Strings(paths)
+	var undeclared []string
+	for _, path := range paths {
+		locations := references[path]
+		switch {
+		case len(locations) == 0:
+			fmt.Fprintf(w, "%s (declared, not read by any template)\n", path)
+		case checked && !declaresSpecPath(manifest.Variables, path) && !(specSchema != nil && specSchema.Declares(strings.Split(path, "."))):
+			fmt.Fprintf(w, "%s (not declared)\n", path)
+			undeclared = append(undeclared, path)
+		default:
+			fmt.Fprintln(w, path)
+		}
+		for _, location := range locations {
+			fmt.Fprintf(w, "  %s\n", location)
+		}
+	}
+	if len(undeclared) == 1 {
+		return fmt.Errorf("The spec key '%s' is read by '%s' but not declared by its variables or %s", undeclared[0], inputTemplate, specSchemaFileName)
+	} else if len(undeclared) > 1 {
+		return fmt.Errorf("%d spec keys are read by '%s' but not declared by its variables or %s: %s", len(undeclared), inputTemplate, specSchemaFileName, strings.Join(undeclared, ", "))
+	}
+	return nil
+}
+
+// isReferenced reports whether a template reads the spec path, a value inside it or a map containing it.
+func isReferenced(references map[string][]specLocation, path string) bool {
+	for reference := range references {
+		if declaresSpecPath([]templateVariable{{Name: path}}, reference) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// watchInterval is how often -watch checks the template and spec files for changes.
+const watchInterval = 500 * time.Millisecond
+
+// watchFingerprint summarizes the names, sizes, permissions and modification times of every file under the paths.
+// The directory at the absolute path skip (the output directory) and .git directories are left out.
+func watchFingerprint(paths []string, skip string) string {
+	h := sha256.New()
+	for _, p := range paths {
+		filepath.Walk(p, func(item string, info os.FileInfo, err error) error {
+			if err != nil {
+				fmt.Fprintf(h, "%s error\n", item)
+				return nil
+			}
+			if info.IsDir() && info.Name() == ".git" {
+				return filepath.SkipDir
+			} else if abs, err := filepath.Abs(item); err == nil && info.IsDir() && abs == skip {
+				return filepath.SkipDir
+			}
+			fmt.Fprintf(h, "%s %d %s %d\n", item, info.Size(), info.Mode(), info.ModTime().UnixNano())
+			return nil
+		})
+	}
+	return fmt.Sprintf("%x", h.Sum(nil))
+}
+
+// watchArgs returns the command line arguments without the -watch flag. Re-rendering an edited template is expected
+// to replace the files it rendered before, so -force is added unless another overwrite policy was chosen. It goes after
+// the subcommand when that is the first argument, where the subcommand's own flags are.
+func watchArgs(args []string, command string, force bool) []string {
+	out := make([]string, 0, len(args)+1)
+	if command != "" && len(args) > 0 && args[0] == command {
+		out, args = append(out, command), args[1:]
+	}
+	if force {
+		out = append(out, "-force")
+	}
+	for _, arg := range args {
+		switch strings.TrimLeft(arg, "-") {
+		case "watch", "watch=true":
+			continue
+		}
+		out = append(out, arg)
+	}
+	return out
+}
+
+// watchAndRender renders the template by running spiro with the given arguments, and again whenever one of the
+// watched paths changes, until it is interrupted. Each render runs in a new process so that nothing is carried over
+// from the previous one. Changes inside the output directory are ignored.
+func watchAndRender(paths []string, outputDir string, args []string) error {
+	executable, err := os.Executable()
+	if err != nil {
+		return fmt.Errorf("Could not find the spiro executable to re-run: %s", err.Error())
+	}
+	skip, err := filepath.Abs(outputDir)
+	if err != nil {
+		return err
+	}
+	for {
+		fingerprint := watchFingerprint(paths, skip)
+		cmd := exec.Command(executable, args...)
+		cmd.Stdin = os.Stdin
+		cmd.Stdout = os.Stdout
+		cmd.Stderr = os.Stderr
+		if err := cmd.Run(); err != nil {
+			if _, ok := err.(*exec.ExitError); !ok {
+				return fmt.Errorf("Could not re-run spiro: %s", err.Error())
+			}
+			logs.Infof("Rendering failed at %s, watching %s for changes", time.Now().Format("15:04:05"), strings.Join(paths, ", "))
+		} else {
+			logs.Infof("Rendered at %s, watching %s for changes", time.Now().Format("15:04:05"), strings.Join(paths, ", "))
+		}
+		for watchFingerprint(paths, skip) == fingerprint {
+			time.Sleep(watchInterval)
+		}
+		// give editors that save in several steps time to finish
+		time.Sleep(watchInterval)
+	}
+}
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"path/filepath"
+	"time"
+)
+
+// runReport is the JSON document posted to the -webhook URL after a successful generation, for inventory and audit
+// systems tracking what was scaffolded where.
+type runReport struct {
+	SpiroVersion     string            `json:"spiro_version"`
+	Template         string            `json:"template"`
+	TemplateRevision *templateRevision `json:"template_revision,omitempty"`
+	// SpecSHA256 identifies the spec that was used without disclosing its content.
+	SpecSHA256  string    `json:"spec_sha256"`
+	Output      string    `json:"output"`
+	Files       []string  `json:"files"`
+	GeneratedAt time.Time `json:"generated_at"`
+}
+
+// newRunReport builds the report of a run from its action plan, file paths are relative to the output directory.
+func newRunReport(template string, rev templateRevision, spec []byte, outputDir string, plan *actionPlan, redact *redactor) *runReport {
+	sum := sha256.Sum256(spec)
+	report := &runReport{
+		SpiroVersion: Version,
+		Template:     template,
+		SpecSHA256:   hex.EncodeToString(sum[:]),
+		Output:       outputDir,
+		Files:        []string{},
+		GeneratedAt:  time.Now().UTC(),
+	}
+	if abs, err := filepath.Abs(outputDir); err == nil {
+		report.Output = abs
+	}
+	if rev.Commit != "" {
+		report.TemplateRevision = &rev
+	}
+	for _, action := range plan.actions {
+		if action.Dir || action.Output == "" {
+			continue
+		}
+		if rel, err := filepath.Rel(outputDir, action.Output); err == nil {
+			report.Files = append(report.Files, redact.Redact(filepath.ToSlash(rel)))
+		}
+	}
+	return report
+}
+
+// postRunReport posts the report as JSON to the webhook URL, any response other than a 2xx status is an error.
+func postRunReport(url string, report *runReport) error {
+	body, err := json.Marshal(report)
+	if err != nil {
+		return fmt.Errorf("Error while building the run report: %s", err.Error())
+	}
+	client := &http.Client{Timeout: 15 * time.Second}
+	resp, err := client.Post(url, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("Error while sending the run report to '%s': %s", url, err.Error())
+	}
+	defer resp.Body.Close()
+	io.Copy(ioutil.Discard, resp.Body)
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("Error while sending the run report to '%s': the webhook responded with %s", url, resp.Status)
+	}
+	return nil
+}
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"regexp"
+	"strings"
+)
+
+// whitespaceConfig tidies the whitespace of rendered files so that templates don't need '{{-' and '-}}' everywhere.
+// Every option is on unless it is turned off, so 'whitespace: {}' in the manifest (or the -tidy flag) enables them all.
+type whitespaceConfig struct {
+	// TrimBlocks removes the indentation and newline around template lines that only hold a control action, such as
+	// {{ if .x }}, {{ else }} or {{ end }}, so that they leave no blank lines behind.
+	TrimBlocks *bool `yaml:"trim_blocks"`
+	// TrimTrailingSpace removes spaces and tabs from the end of every line.
+	TrimTrailingSpace *bool `yaml:"trim_trailing_space"`
+	// MaxBlankLines collapses longer runs of blank lines, it defaults to 1 and -1 keeps every blank line.
+	MaxBlankLines *int `yaml:"max_blank_lines"`
+	// FinalNewline makes sure that non-empty files end with a newline.
+	FinalNewline *bool `yaml:"final_newline"`
+	// Files limits tidying to paths matching the gitignore style patterns, relative to the root of the output.
+	Files []string `yaml:"files"`
+	files *ignoreRules
+}
+
+func optionEnabled(option *bool) bool {
+	return option == nil || *option
+}
+
+// appliesTo reports whether the rendered file at rel is tidied. It is safe to call on a nil config.
+func (w *whitespaceConfig) appliesTo(rel string) bool {
+	return w != nil && (w.files == nil || w.files.Ignored(rel, false))
+}
+
+// blockActionKeywords start the template actions that produce no output of their own.
+var blockActionKeywords = []string{"if", "else", "end", "range", "with", "define", "block", "break", "continue"}
+
+// trimBlocks removes the indentation before, and the newline after, every line of the template that only holds a
+// control action or a comment.
+func (w *whitespaceConfig) trimBlocks(template string, startDelim string, endDelim string) string {
+	if !optionEnabled(w.TrimBlocks) {
+		return template
+	}
+	start, end := regexp.QuoteMeta(startDelim), regexp.QuoteMeta(endDelim)
+	pattern := regexp.MustCompile(`(?m)^[ \t]*(` + start + `-?\s*(?:(?:` + strings.Join(blockActionKeywords, "|") +
+		`)\b|/\*)[^\n]*?` + end + `)[ \t]*(?:\r?\n|\z)`)
+	return pattern.ReplaceAllStringFunc(template, func(line string) string {
+		action := pattern.FindStringSubmatch(line)[1]
+		// a line holding several actions, such as {{ if .x }}text{{ end }}, produces output and is kept as it is
+		if strings.Count(action, startDelim) > 1 {
+			return line
+		}
+		return action
+	})
+}
+
+// tidy applies the remaining options to rendered content.
+func (w *whitespaceConfig) tidy(content string) string {
+	if optionEnabled(w.TrimTrailingSpace) {
+		content = TrimTrailingSpace(content)
+	}
+	maxBlankLines := 1
+	if w.MaxBlankLines != nil {
+		maxBlankLines = *w.MaxBlankLines
+	}
+	if maxBlankLines >= 0 {
+		content = CollapseBlankLines(maxBlankLines, content)
+	}
+	if optionEnabled(w.FinalNewline) {
+		content = EnsureTrailingNewline(content)
+	}
+	return content
+}